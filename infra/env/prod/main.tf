@@ -6,6 +6,8 @@ module "bot" {
   telegram_bot_token      = var.telegram_bot_token
   google_credentials_json = var.google_credentials_json
   google_spreadsheet_id   = var.google_spreadsheet_id
+  allowed_user_ids        = var.allowed_user_ids
+  allowed_chat_ids        = var.allowed_chat_ids
   log_retention_days      = 3
 
   tags = {
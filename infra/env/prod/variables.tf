@@ -16,6 +16,18 @@ variable "google_spreadsheet_id" {
   sensitive   = true
 }
 
+variable "allowed_user_ids" {
+  type        = string
+  description = "Comma-separated Telegram user IDs allowed to use the bot, the bot refuses everyone if this and allowed_chat_ids are empty"
+  default     = ""
+}
+
+variable "allowed_chat_ids" {
+  type        = string
+  description = "Comma-separated Telegram chat IDs allowed to use the bot"
+  default     = ""
+}
+
 variable "image_tag" {
   type        = string
   description = "Docker image tag to deploy"
@@ -134,6 +134,8 @@ resource "aws_lambda_function" "worker" {
       TELEGRAM_BOT_TOKEN      = var.telegram_bot_token
       GOOGLE_CREDENTIALS_JSON = var.google_credentials_json
       GOOGLE_SPREADSHEET_ID   = var.google_spreadsheet_id
+      ALLOWED_USER_IDS        = var.allowed_user_ids
+      ALLOWED_CHAT_IDS        = var.allowed_chat_ids
       LOG_LEVEL               = "INFO"
     }
   }
@@ -0,0 +1,37 @@
+package main
+
+// Allowlist restricts which Telegram users and chats may use the bot
+// An empty allowlist allows no one, so a deployment that forgets to set it stays closed
+type Allowlist struct {
+	userIDs map[int64]struct{}
+	chatIDs map[int64]struct{}
+}
+
+func NewAllowlist(userIDs, chatIDs []int64) *Allowlist {
+	a := &Allowlist{
+		userIDs: make(map[int64]struct{}, len(userIDs)),
+		chatIDs: make(map[int64]struct{}, len(chatIDs)),
+	}
+	for _, id := range userIDs {
+		a.userIDs[id] = struct{}{}
+	}
+	for _, id := range chatIDs {
+		a.chatIDs[id] = struct{}{}
+	}
+	return a
+}
+
+// Allows reports whether a message from userID in chatID may be processed
+// Either the user or the chat being listed is enough
+func (a *Allowlist) Allows(userID, chatID int64) bool {
+	if _, ok := a.userIDs[userID]; ok {
+		return true
+	}
+	_, ok := a.chatIDs[chatID]
+	return ok
+}
+
+// Empty reports whether no user or chat is listed, which refuses every message
+func (a *Allowlist) Empty() bool {
+	return len(a.userIDs) == 0 && len(a.chatIDs) == 0
+}
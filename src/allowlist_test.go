@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		userIDs []int64
+		chatIDs []int64
+		userID  int64
+		chatID  int64
+		want    bool
+	}{
+		{
+			name:   "empty allowlist allows no one",
+			userID: 1,
+			chatID: 2,
+			want:   false,
+		},
+		{
+			name:    "listed user",
+			userIDs: []int64{1},
+			userID:  1,
+			chatID:  2,
+			want:    true,
+		},
+		{
+			name:    "unlisted user",
+			userIDs: []int64{1},
+			userID:  3,
+			chatID:  2,
+			want:    false,
+		},
+		{
+			name:    "listed chat",
+			chatIDs: []int64{-100},
+			userID:  3,
+			chatID:  -100,
+			want:    true,
+		},
+		{
+			name:    "unlisted chat",
+			chatIDs: []int64{-100},
+			userID:  3,
+			chatID:  2,
+			want:    false,
+		},
+		{
+			name:    "user listed but chat not",
+			userIDs: []int64{1},
+			chatIDs: []int64{-100},
+			userID:  1,
+			chatID:  2,
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			a := NewAllowlist(tt.userIDs, tt.chatIDs)
+			if got := a.Allows(tt.userID, tt.chatID); got != tt.want {
+				t.Errorf("Allows(%d, %d) = %v, want %v", tt.userID, tt.chatID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}\s*|\s*[A-Z]{3}$`)
+	userAmountPattern   = regexp.MustCompile(`^\d[\d,.]*$`)
+)
+
+// AmountLocale decides how an amount with a single separator followed by three digits is read,
+// e.g. "1,200" or "1.200"
+type AmountLocale int
+
+const (
+	LocaleEuropean AmountLocale = iota // "1.234,56"
+	LocaleEnglish                      // "1,234.56"
+)
+
+// Parses a locale name from the configuration: "eu" or "en"
+func parseAmountLocale(name string) (AmountLocale, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "eu":
+		return LocaleEuropean, true
+	case "en":
+		return LocaleEnglish, true
+	default:
+		return LocaleEuropean, false
+	}
+}
+
+func (l AmountLocale) thousandsSeparator() byte {
+	if l == LocaleEnglish {
+		return ','
+	}
+	return '.'
+}
+
+// A non-empty amount cell that could not be read as a number
+type invalidAmount struct {
+	cell  string // A1 notation, e.g. "B12"
+	row   int
+	value string
+}
+
+// Parses an amount cell read unformatted, which is a number or text typed into the cell
+// Numbers are rounded to cents, so formula results such as =10/3 count as 3,33
+func parseSheetAmount(value any, locale AmountLocale) (Money, bool) {
+	switch v := value.(type) {
+	case float64:
+		return moneyFromFloat(v)
+	case string:
+		return parseSheetText(v, locale)
+	default:
+		return Money{}, false
+	}
+}
+
+// Rounds a number cell half away from zero to cents
+// The shortest decimal form of the number is rounded, so 1.005 gives 1,01 like it reads in the sheet
+func moneyFromFloat(value float64) (Money, bool) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Money{}, false
+	}
+	number, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	if !ok || !moneyFits(number) {
+		return Money{}, false
+	}
+	return moneyFromRat(number, defaultCurrency), true
+}
+
+// Parses an amount typed into a cell as text, e.g. "1 234,50", "€12,00" or "1.234,50"
+// Separators are read like in amounts typed by a user, so the locale decides whether "1.234" is
+// a thousand or a fraction. Amounts with more than two decimals are not rounded but rejected
+func parseSheetText(value string, locale AmountLocale) (Money, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return Money{}, false
+	}
+
+	// Drop currency codes and symbols, and thousands separators made of spaces or apostrophes
+	var cleaned strings.Builder
+	negative := false
+	for _, r := range currencyCodePattern.ReplaceAllString(value, "") {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',':
+			cleaned.WriteRune(r)
+		case r == '-', r == '−', r == '(' && cleaned.Len() == 0:
+			// Leading minus or accounting-style parentheses
+			if cleaned.Len() > 0 {
+				return Money{}, false
+			}
+			negative = true
+		case r == ')', r == '\'', r == '’', unicode.IsSpace(r), unicode.Is(unicode.Sc, r):
+		default:
+			return Money{}, false
+		}
+	}
+
+	amount, err := parseUserAmount(cleaned.String(), locale)
+	if err != nil {
+		return Money{}, false
+	}
+	if negative {
+		amount = amount.Neg()
+	}
+	return amount, true
+}
+
+// Parses an amount typed by a user, e.g. "12", "2,95", "1,200.00" or "1.299,90"
+// When both separators appear the last one is the decimal separator. A separator that repeats
+// separates thousands, and so does a single one followed by three digits if it is the locale's
+// thousands separator. Amounts with more than two decimals are rejected
+func parseUserAmount(value string, locale AmountLocale) (Money, error) {
+	digits, err := normalizeUserAmount(value, locale)
+	if err != nil {
+		return Money{}, err
+	}
+
+	amount, ok := parseMoney(digits)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// Rewrites an amount typed by a user as plain digits with an optional dot, e.g. "1.299,90" as "1299.90"
+func normalizeUserAmount(value string, locale AmountLocale) (string, error) {
+	if !userAmountPattern.MatchString(value) {
+		return "", fmt.Errorf("invalid amount %q", value)
+	}
+
+	integer, decimals, hasDecimals := value, "", false
+	if i := strings.LastIndexAny(value, ".,"); i >= 0 {
+		separator := value[i]
+		other := byte('.')
+		if separator == '.' {
+			other = ','
+		}
+
+		switch {
+		case strings.IndexByte(value, other) >= 0:
+			// "1,200.00": the other separator groups thousands
+			integer, decimals, hasDecimals = value[:i], value[i+1:], true
+			if strings.IndexByte(integer, separator) >= 0 {
+				return "", fmt.Errorf("invalid amount %q", value)
+			}
+		case strings.Count(value, string(separator)) > 1:
+			// "1.200.000"
+		case len(value)-i-1 == 3 && separator == locale.thousandsSeparator():
+			// "1.200" in European or "1,200" in English
+		default:
+			integer, decimals, hasDecimals = value[:i], value[i+1:], true
+		}
+	}
+
+	digits, ok := groupedDigits(integer)
+	if !ok {
+		return "", fmt.Errorf("invalid thousands separators in %q", value)
+	}
+	if hasDecimals {
+		if decimals == "" || len(decimals) > 2 {
+			return "", fmt.Errorf("amount %q must have one or two decimals", value)
+		}
+		digits += "." + decimals
+	}
+	return digits, nil
+}
+
+// Removes thousands separators from the integer part of an amount
+// Groups after the first must have exactly three digits, and all of them the same separator
+func groupedDigits(integer string) (string, bool) {
+	groups := strings.FieldsFunc(integer, func(r rune) bool { return r == '.' || r == ',' })
+	if len(groups) == 0 || strings.Count(integer, ".")+strings.Count(integer, ",") != len(groups)-1 {
+		return "", false
+	}
+	if len(groups) == 1 {
+		return integer, true
+	}
+
+	if strings.Contains(integer, ".") && strings.Contains(integer, ",") {
+		return "", false
+	}
+	if len(groups[0]) > 3 || groups[0][0] == '0' {
+		return "", false
+	}
+	for _, group := range groups[1:] {
+		if len(group) != 3 {
+			return "", false
+		}
+	}
+	return strings.Join(groups, ""), true
+}
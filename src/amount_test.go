@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestParseSheetAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value  string
+		locale AmountLocale
+		want   Money
+		wantOK bool
+	}{
+		{value: "12.5", want: Cents(1250), wantOK: true},
+		{value: "900", want: Cents(90000), wantOK: true},
+		{value: "12,50", want: Cents(1250), wantOK: true},
+		{value: "1 234,50", want: Cents(123450), wantOK: true},
+		{value: "1 234,50 €", want: Cents(123450), wantOK: true},
+		{value: "1 234,50", want: Cents(123450), wantOK: true},
+		{value: "€12,00", want: Cents(1200), wantOK: true},
+		{value: "$1,234.50", want: Cents(123450), wantOK: true},
+		{value: "1.234,50", want: Cents(123450), wantOK: true},
+		{value: "1,234,567", want: Cents(123456700), wantOK: true},
+		{value: "1.234.567", want: Cents(123456700), wantOK: true},
+		{value: "1'234.50", want: Cents(123450), wantOK: true},
+		{value: "EUR 12,00", want: Cents(1200), wantOK: true},
+		{value: "12,00 EUR", want: Cents(1200), wantOK: true},
+		{value: "-12,50 €", want: Cents(-1250), wantOK: true},
+		{value: "−12,50", want: Cents(-1250), wantOK: true},
+		{value: "(12,50)", want: Cents(-1250), wantOK: true},
+		{value: ""},
+		{value: "n/a"},
+		{value: "TBD"},
+		{value: "12 apples"},
+		{value: "1-2"},
+		{value: "NaN"},
+		{value: "Inf"},
+		{value: "€"},
+		{value: "1.234", want: Cents(123400), wantOK: true},
+		{value: "12.345", want: Cents(1234500), wantOK: true},
+		{value: "1,234"},
+		{value: "1,234", locale: LocaleEnglish, want: Cents(123400), wantOK: true},
+		{value: "1.234", locale: LocaleEnglish},
+		{value: "12.345", locale: LocaleEnglish},
+		{value: "12,3456"},
+		{value: "0.30000000000000004"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.value, tt.locale), func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseSheetAmount(tt.value, tt.locale)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseSheetAmount(%q, %d) = %v, %v, want %v, %v", tt.value, tt.locale, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseSheetAmountNumbers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value  any
+		want   Money
+		wantOK bool
+	}{
+		{value: 900.0, want: Cents(90000), wantOK: true},
+		{value: 1.234, want: Cents(123), wantOK: true},
+		{value: 3.3333333333333335, want: Cents(333), wantOK: true},
+		{value: 12.99 * 1.24, want: Cents(1611), wantOK: true},
+		{value: 0.1 + 0.2, want: Cents(30), wantOK: true},
+		{value: 1.005, want: Cents(101), wantOK: true},
+		{value: -2.675, want: Cents(-268), wantOK: true},
+		{value: 1.2345e+06, want: Cents(123450000), wantOK: true},
+		{value: math.NaN()},
+		{value: math.Inf(1)},
+		{value: 1e300},
+		{value: true},
+		{value: nil},
+	}
+
+	for _, tt := range tests {
+		for _, locale := range []AmountLocale{LocaleEuropean, LocaleEnglish} {
+			t.Run(fmt.Sprintf("%v/%d", tt.value, locale), func(t *testing.T) {
+				t.Parallel()
+
+				got, ok := parseSheetAmount(tt.value, locale)
+				if got != tt.want || ok != tt.wantOK {
+					t.Errorf("parseSheetAmount(%v, %d) = %v, %v, want %v, %v", tt.value, locale, got, ok, tt.want, tt.wantOK)
+				}
+			})
+		}
+	}
+}
+
+func TestParseUserAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		locale  AmountLocale
+		want    Money
+		wantErr bool
+	}{
+		{value: "12", want: Cents(1200)},
+		{value: "2.95", want: Cents(295)},
+		{value: "2,95", want: Cents(295)},
+		{value: "2.5", want: Cents(250)},
+		{value: "2,5", locale: LocaleEnglish, want: Cents(250)},
+		{value: "1,200.00", want: Cents(120000)},
+		{value: "1.299,90", want: Cents(129990)},
+		{value: "1.299,90", locale: LocaleEnglish, want: Cents(129990)},
+		{value: "1,200.00", locale: LocaleEnglish, want: Cents(120000)},
+		{value: "1,234,567.89", want: Cents(123456789)},
+		{value: "1.234.567", want: Cents(123456700)},
+		{value: "1,234,567", locale: LocaleEnglish, want: Cents(123456700)},
+		{value: "1.200", want: Cents(120000)},
+		{value: "1,200", locale: LocaleEnglish, want: Cents(120000)},
+		{value: "1,200", wantErr: true},
+		{value: "1.200", locale: LocaleEnglish, wantErr: true},
+		{value: "12.345", want: Cents(1234500)},
+		{value: "0.500", wantErr: true},
+		{value: "2.955", locale: LocaleEnglish, wantErr: true},
+		{value: "1,200.005", wantErr: true},
+		{value: "12.", wantErr: true},
+		{value: "1.2.3", wantErr: true},
+		{value: "12.34.56", wantErr: true},
+		{value: "1,20.00", wantErr: true},
+		{value: "1.200,300.00", wantErr: true},
+		{value: "1.200,00,00", wantErr: true},
+		{value: ".5", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "-2.95", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseUserAmount(tt.value, tt.locale)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUserAmount(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseUserAmount(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
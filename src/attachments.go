@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// The Bot API does not serve files larger than this
+const maxDownloadSize = 20 << 20
+
+// Attachments holds the optional services for messages with files, a nil service disables the feature
+type Attachments struct {
+	Files    FileDownloader
+	Receipts BlobStore
+	OCR      TextRecognizer // Suggests an expense for receipt photos sent without a caption
+	Voice    Transcriber    // Reads expenses from voice messages
+}
+
+// FileDownloader fetches files that users sent to the bot
+type FileDownloader interface {
+	// Download returns the contents of a file and its path on the Telegram server, e.g. "photos/file_1.jpg"
+	Download(ctx context.Context, fileID string) ([]byte, string, error)
+}
+
+// TelegramFiles downloads files through the Bot API
+type TelegramFiles struct {
+	bot    *bot.Bot
+	client *http.Client
+}
+
+func NewTelegramFiles(b *bot.Bot) *TelegramFiles {
+	return &TelegramFiles{bot: b, client: &http.Client{Timeout: 15 * time.Second}}
+}
+
+func (f *TelegramFiles) Download(ctx context.Context, fileID string) ([]byte, string, error) {
+	file, err := f.bot.GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, "", fmt.Errorf("get file: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.bot.FileDownloadLink(file), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download file: unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read file: %w", err)
+	}
+	if len(data) > maxDownloadSize {
+		return nil, "", fmt.Errorf("file is larger than %d bytes", maxDownloadSize)
+	}
+
+	return data, file.FilePath, nil
+}
+
+// A file attached to a message
+type attachment struct {
+	fileID   string
+	uniqueID string // Stays the same across bots and redeliveries, unlike fileID
+	name     string // Original file name of documents, empty for photos
+	mimeType string
+}
+
+// Returns the photo or document attached to a message
+// Photos come in several sizes and the largest one is used
+func messageAttachment(message *models.Message) (attachment, bool) {
+	if len(message.Photo) > 0 {
+		largest := message.Photo[0]
+		for _, photo := range message.Photo[1:] {
+			if photo.Width*photo.Height > largest.Width*largest.Height {
+				largest = photo
+			}
+		}
+		return attachment{fileID: largest.FileID, uniqueID: largest.FileUniqueID, mimeType: "image/jpeg"}, true
+	}
+	if doc := message.Document; doc != nil {
+		return attachment{fileID: doc.FileID, uniqueID: doc.FileUniqueID, name: doc.FileName, mimeType: doc.MimeType}, true
+	}
+	return attachment{}, false
+}
+
+// Returns the blob key of a receipt, e.g. "receipts/2026-03/AQADa1b2.jpg"
+// The key only depends on the file, so storing it again after a retry replaces the same blob
+func receiptKey(file attachment, serverPath string, date time.Time) string {
+	ext := path.Ext(file.name)
+	if ext == "" {
+		ext = path.Ext(serverPath)
+	}
+	return fmt.Sprintf("receipts/%s/%s%s", date.Format("2006-01"), file.uniqueID, strings.ToLower(ext))
+}
+
+// Returns the content type of a receipt, guessing it from the file extension if Telegram did not tell
+func receiptContentType(file attachment, key string) string {
+	if file.mimeType != "" {
+		return file.mimeType
+	}
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestMessageAttachment(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		want    attachment
+		wantOK  bool
+	}{
+		{
+			name:    "text message",
+			message: &models.Message{Text: "Lunch 12"},
+		},
+		{
+			name: "largest photo size",
+			message: &models.Message{Photo: []models.PhotoSize{
+				{FileID: "small", FileUniqueID: "s", Width: 90, Height: 160},
+				{FileID: "large", FileUniqueID: "l", Width: 720, Height: 1280},
+				{FileID: "medium", FileUniqueID: "m", Width: 320, Height: 569},
+			}},
+			want:   attachment{fileID: "large", uniqueID: "l", mimeType: "image/jpeg"},
+			wantOK: true,
+		},
+		{
+			name:    "document",
+			message: &models.Message{Document: &models.Document{FileID: "doc", FileUniqueID: "d", FileName: "receipt.pdf", MimeType: "application/pdf"}},
+			want:    attachment{fileID: "doc", uniqueID: "d", name: "receipt.pdf", mimeType: "application/pdf"},
+			wantOK:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := messageAttachment(tt.message)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("messageAttachment() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReceiptKey(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		file            attachment
+		serverPath      string
+		wantKey         string
+		wantContentType string
+	}{
+		{
+			name:            "photo",
+			file:            attachment{uniqueID: "AQAD1", mimeType: "image/jpeg"},
+			serverPath:      "photos/file_3.jpg",
+			wantKey:         "receipts/2026-03/AQAD1.jpg",
+			wantContentType: "image/jpeg",
+		},
+		{
+			name:            "document keeps its extension",
+			file:            attachment{uniqueID: "AQAD2", name: "Receipt.PDF"},
+			serverPath:      "documents/file_4",
+			wantKey:         "receipts/2026-03/AQAD2.pdf",
+			wantContentType: "application/pdf",
+		},
+		{
+			name:            "unknown type",
+			file:            attachment{uniqueID: "AQAD3"},
+			serverPath:      "documents/file_5",
+			wantKey:         "receipts/2026-03/AQAD3",
+			wantContentType: "application/octet-stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			key := receiptKey(tt.file, tt.serverPath, date)
+			if key != tt.wantKey {
+				t.Errorf("receiptKey() = %q, want %q", key, tt.wantKey)
+			}
+			if got := receiptContentType(tt.file, key); got != tt.wantContentType {
+				t.Errorf("receiptContentType() = %q, want %q", got, tt.wantContentType)
+			}
+		})
+	}
+}
+
+func TestTelegramFilesDownload(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/getFile":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok":true,"result":{"file_id":"photo","file_unique_id":"u","file_path":"photos/file_1.jpg"}}`)
+		case "/file/bottoken/photos/file_1.jpg":
+			fmt.Fprint(w, "jpeg data")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	b, err := bot.New("token", bot.WithServerURL(server.URL), bot.WithSkipGetMe())
+	if err != nil {
+		t.Fatalf("bot.New() unexpected error: %v", err)
+	}
+	files := NewTelegramFiles(b)
+
+	data, path, err := files.Download(context.Background(), "photo")
+	if err != nil {
+		t.Fatalf("Download() unexpected error: %v", err)
+	}
+	if string(data) != "jpeg data" || path != "photos/file_1.jpg" {
+		t.Errorf("Download() = %q, %q, want jpeg data, photos/file_1.jpg", data, path)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// BlobStore saves files such as receipt photos and returns a link to them
+type BlobStore interface {
+	// Put stores data under key, replacing any earlier file with the same key
+	Put(ctx context.Context, key, contentType string, data []byte) (string, error)
+}
+
+// LocalBlobStore keeps files in a directory on the local filesystem
+type LocalBlobStore struct {
+	dir     string
+	baseURL string // Prefix of the returned links, file:// links are returned if empty
+}
+
+func NewLocalBlobStore(dir, baseURL string) *LocalBlobStore {
+	return &LocalBlobStore{dir: dir, baseURL: baseURL}
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("write file: %w", err)
+	}
+
+	if s.baseURL != "" {
+		return blobLink(s.baseURL, key), nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve path: %w", err)
+	}
+	return "file://" + filepath.ToSlash(abs), nil
+}
+
+// S3BlobStore keeps files in an S3 bucket or a bucket of an S3-compatible service
+type S3BlobStore struct {
+	client  *s3.Client
+	bucket  string
+	baseURL string // Prefix of the returned links, s3:// links are returned if empty
+}
+
+// NewS3BlobStore creates a store using the default AWS credentials
+// A non-empty endpoint selects an S3-compatible service instead of AWS
+func NewS3BlobStore(ctx context.Context, bucket, endpoint, baseURL string) (*S3BlobStore, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load aws config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	return &S3BlobStore{client: client, bucket: bucket, baseURL: baseURL}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("put object: %w", err)
+	}
+
+	if s.baseURL != "" {
+		return blobLink(s.baseURL, key), nil
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+func blobLink(baseURL, key string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/" + key
+}
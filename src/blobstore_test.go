@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLocalBlobStorePut(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		baseURL  string
+		wantLink func(dir string) string
+	}{
+		{
+			name: "file link without base url",
+			wantLink: func(dir string) string {
+				return "file://" + filepath.ToSlash(filepath.Join(dir, "receipts", "2026-03", "abc.jpg"))
+			},
+		},
+		{
+			name:    "link under base url",
+			baseURL: "https://files.example.com/",
+			wantLink: func(dir string) string {
+				return "https://files.example.com/receipts/2026-03/abc.jpg"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			store := NewLocalBlobStore(dir, tt.baseURL)
+
+			// Storing again after a retry replaces the file
+			for _, data := range []string{"first", "receipt"} {
+				link, err := store.Put(context.Background(), "receipts/2026-03/abc.jpg", "image/jpeg", []byte(data))
+				if err != nil {
+					t.Fatalf("Put() unexpected error: %v", err)
+				}
+				if want := tt.wantLink(dir); link != want {
+					t.Errorf("Put() = %q, want %q", link, want)
+				}
+			}
+
+			got, err := os.ReadFile(filepath.Join(dir, "receipts", "2026-03", "abc.jpg"))
+			if err != nil {
+				t.Fatalf("read stored file: %v", err)
+			}
+			if string(got) != "receipt" {
+				t.Errorf("stored file = %q, want receipt", got)
+			}
+		})
+	}
+}
+
+func TestS3BlobStorePut(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "eu-north-1")
+
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	contentTypes := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.Path] = string(body)
+		contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		baseURL  string
+		wantLink string
+	}{
+		{name: "s3 link without base url", wantLink: "s3://receipts-bucket/receipts/2026-03/abc.jpg"},
+		{name: "link under base url", baseURL: "https://cdn.example.com", wantLink: "https://cdn.example.com/receipts/2026-03/abc.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewS3BlobStore(context.Background(), "receipts-bucket", server.URL, tt.baseURL)
+			if err != nil {
+				t.Fatalf("NewS3BlobStore() unexpected error: %v", err)
+			}
+
+			link, err := store.Put(context.Background(), "receipts/2026-03/abc.jpg", "image/jpeg", []byte("receipt"))
+			if err != nil {
+				t.Fatalf("Put() unexpected error: %v", err)
+			}
+			if link != tt.wantLink {
+				t.Errorf("Put() = %q, want %q", link, tt.wantLink)
+			}
+		})
+	}
+
+	const path = "/receipts-bucket/receipts/2026-03/abc.jpg"
+	if objects[path] != "receipt" {
+		t.Errorf("stored objects = %v, want receipt at %s", objects, path)
+	}
+	if contentTypes[path] != "image/jpeg" {
+		t.Errorf("content type = %q, want image/jpeg", contentTypes[path])
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+)
+
+// Percentages of a limit that trigger a warning when an expense crosses them, highest first
+var budgetThresholds = []int64{100, 80}
+
+// Budget holds monthly spending limits, a zero limit means no limit
+type Budget struct {
+	Total        Money
+	Fundamentals Money
+	Fun          Money
+}
+
+// Limit returns the limit for a category
+func (b Budget) Limit(category Category) Money {
+	if category == CategoryFun {
+		return b.Fun
+	}
+	return b.Fundamentals
+}
+
+// Merge fills the limits missing from b with the ones from fallback
+func (b Budget) Merge(fallback Budget) Budget {
+	if b.Total.Cents == 0 {
+		b.Total = fallback.Total
+	}
+	if b.Fundamentals.Cents == 0 {
+		b.Fundamentals = fallback.Fundamentals
+	}
+	if b.Fun.Cents == 0 {
+		b.Fun = fallback.Fun
+	}
+	return b
+}
+
+// Reads budget limits from label/amount rows above the expense table
+// Labels are "Budget", "Fundamentals budget" and "Fun budget" in the description column
+func parseBudget(labels []string, amounts []any, startRow int, locale AmountLocale) Budget {
+	var budget Budget
+
+	for i := 0; i < startRow-1 && i < len(labels) && i < len(amounts); i++ {
+		amount, ok := parseSheetAmount(amounts[i], locale)
+		if !ok || amount.Cents <= 0 {
+			continue
+		}
+
+		switch strings.ToLower(labels[i]) {
+		case "budget":
+			budget.Total = amount
+		case "fundamentals budget":
+			budget.Fundamentals = amount
+		case "fun budget":
+			budget.Fun = amount
+		}
+	}
+
+	return budget
+}
+
+// Reports whether a label names one of the budget rows read by parseBudget
+func isBudgetLabel(label string) bool {
+	switch strings.ToLower(label) {
+	case "budget", "fundamentals budget", "fun budget":
+		return true
+	}
+	return false
+}
+
+// Returns the highest threshold percentage that spending crossed when going from before to after
+func crossedThreshold(before, after, limit Money) (int64, bool) {
+	if limit.Cents <= 0 {
+		return 0, false
+	}
+	for _, threshold := range budgetThresholds {
+		if before.Cents*100 < limit.Cents*threshold && after.Cents*100 >= limit.Cents*threshold {
+			return threshold, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBudgetMerge(t *testing.T) {
+	t.Parallel()
+
+	got := Budget{Fun: Cents(10000)}.Merge(Budget{Total: Cents(100000), Fundamentals: Cents(80000), Fun: Cents(20000)})
+	want := Budget{Total: Cents(100000), Fundamentals: Cents(80000), Fun: Cents(10000)}
+	if got != want {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		labels   []string
+		amounts  []any
+		startRow int
+		want     Budget
+	}{
+		{
+			name:     "all labels",
+			labels:   []string{"Budget", "Fundamentals budget", "Fun budget", "Total Net income", "Header"},
+			amounts:  []any{"1500", "1200,50", "300", "", ""},
+			startRow: 5,
+			want:     Budget{Total: Cents(150000), Fundamentals: Cents(120050), Fun: Cents(30000)},
+		},
+		{
+			name:     "labels are case insensitive",
+			labels:   []string{"BUDGET", "Total Net income", "Header"},
+			amounts:  []any{"900", "", ""},
+			startRow: 3,
+			want:     Budget{Total: Cents(90000)},
+		},
+		{
+			name:     "ignores labels inside expense table",
+			labels:   []string{"Total Net income", "Header", "Budget"},
+			amounts:  []any{"", "", "50"},
+			startRow: 2,
+			want:     Budget{},
+		},
+		{
+			name:     "ignores unparseable and non-positive amounts",
+			labels:   []string{"Budget", "Fun budget", "Total Net income", "Header"},
+			amounts:  []any{"lots", "-5", "", ""},
+			startRow: 4,
+			want:     Budget{},
+		},
+		{
+			name:     "empty input",
+			startRow: 2,
+			want:     Budget{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseBudget(tt.labels, tt.amounts, tt.startRow, LocaleEuropean)
+			if got != tt.want {
+				t.Errorf("parseBudget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrossedThreshold(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		before    Money
+		after     Money
+		limit     Money
+		want      int64
+		wantCross bool
+	}{
+		{
+			name:   "below all thresholds",
+			before: Cents(1000),
+			after:  Cents(2000),
+			limit:  Cents(10000),
+		},
+		{
+			name:      "crosses 80 percent",
+			before:    Cents(7000),
+			after:     Cents(8500),
+			limit:     Cents(10000),
+			want:      80,
+			wantCross: true,
+		},
+		{
+			name:      "lands exactly on 80 percent",
+			before:    Cents(7000),
+			after:     Cents(8000),
+			limit:     Cents(10000),
+			want:      80,
+			wantCross: true,
+		},
+		{
+			name:      "crosses 100 percent",
+			before:    Cents(9000),
+			after:     Cents(11000),
+			limit:     Cents(10000),
+			want:      100,
+			wantCross: true,
+		},
+		{
+			name:      "jumps over both reports highest",
+			before:    Cents(5000),
+			after:     Cents(12000),
+			limit:     Cents(10000),
+			want:      100,
+			wantCross: true,
+		},
+		{
+			name:   "already over budget",
+			before: Cents(12000),
+			after:  Cents(13000),
+			limit:  Cents(10000),
+		},
+		{
+			name:   "no limit",
+			before: Cents(0),
+			after:  Cents(100000),
+			limit:  Cents(0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, crossed := crossedThreshold(tt.before, tt.after, tt.limit)
+			if crossed != tt.wantCross || got != tt.want {
+				t.Errorf("crossedThreshold(%v, %v, %v) = %v, %v, want %v, %v",
+					tt.before, tt.after, tt.limit, got, crossed, tt.want, tt.wantCross)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// Rows are claimed with an expense record before the expense is written. A writer only writes
+// after a search shows nobody else claimed its rows. Two writers can never both write the same
+// row: each would have to search before the other claimed. When claims collide, the earliest
+// one waits for the others to be released and the rest retry on other rows, so one always wins.
+
+const (
+	// Attempts AddExpenses makes to claim free rows before giving up
+	maxClaimAttempts = 5
+	// Searches the earliest of colliding claims makes while waiting for the others to be released
+	maxClaimChecks = 5
+	// Upper bound of the random wait before claiming again after losing rows to another writer
+	defaultClaimBackoff = 500 * time.Millisecond
+	// Claims on rows that are still empty after this long belong to writes that never finished
+	staleClaimAge = 2 * time.Minute
+)
+
+// An expense record and the 1-indexed row it is attached to
+type claimedRow struct {
+	metadataID int64
+	sheetID    int64
+	row        int
+	record     expenseRecord
+}
+
+// Snapshot of a worksheet's expense table: the description columns and the rows claimed by records
+type expenseTable struct {
+	startRow int // 1-indexed header row, expenses start below it
+	columns  map[Category][]string
+	claims   []claimedRow
+}
+
+// Reports whether the description cell of the row is filled
+func (t *expenseTable) hasData(category Category, row int) bool {
+	col := t.columns[category]
+	return row >= 1 && row <= len(col) && col[row-1] != ""
+}
+
+// Returns the Telegram updates whose expenses were written to the table
+// Claims on empty rows don't count, their write may have failed
+func (t *expenseTable) recordedUpdates() map[int64]bool {
+	recorded := make(map[int64]bool)
+	for _, claim := range t.claims {
+		if claim.record.UpdateID != 0 && t.hasData(claim.record.Category, claim.row) {
+			recorded[claim.record.UpdateID] = true
+		}
+	}
+	return recorded
+}
+
+// Reports whether an expense written to the table is linked to the bot message
+func (t *expenseTable) linked(link *messageLink) bool {
+	for _, claim := range t.claims {
+		if claim.record.ChatID == link.chatID && claim.record.MessageID == link.messageID &&
+			t.hasData(claim.record.Category, claim.row) {
+			return true
+		}
+	}
+	return false
+}
+
+// Picks a free row for each expense, in order
+// Empty rows claimed within staleClaimAge are taken, older claims are returned to be removed
+func (t *expenseTable) allocate(expenses []*Expense, now time.Time) ([]int, []int64) {
+	counts := make(map[Category]int)
+	for _, expense := range expenses {
+		counts[expense.Category]++
+	}
+
+	var stale []int64
+	allocated := make(map[Category][]int)
+	for _, category := range []Category{CategoryFundamentals, CategoryFun} {
+		if counts[category] == 0 {
+			continue
+		}
+
+		values := append([]string(nil), t.columns[category]...)
+		staleByRow := make(map[int][]int64)
+		for _, claim := range t.claims {
+			if claim.record.Category != category || t.hasData(category, claim.row) {
+				continue
+			}
+			if now.Sub(time.Unix(0, claim.record.AddedAt)) >= staleClaimAge {
+				staleByRow[claim.row] = append(staleByRow[claim.row], claim.metadataID)
+				continue
+			}
+			for len(values) < claim.row {
+				values = append(values, "")
+			}
+			values[claim.row-1] = "claimed"
+		}
+
+		allocated[category] = allocateRows(values, t.startRow, counts[category])
+		for _, row := range allocated[category] {
+			stale = append(stale, staleByRow[row]...)
+		}
+	}
+
+	rows := make([]int, len(expenses))
+	for i, expense := range expenses {
+		rows[i] = allocated[expense.Category][0]
+		allocated[expense.Category] = allocated[expense.Category][1:]
+	}
+
+	return rows, stale
+}
+
+// Reports whether a record other than the claims is attached to one of their rows,
+// and whether any such record was claimed before ours and wins the row
+func contest(records, claims []claimedRow) (contested, lost bool) {
+	ours := make(map[int64]bool, len(claims))
+	for _, claim := range claims {
+		ours[claim.metadataID] = true
+	}
+
+	for _, record := range records {
+		if ours[record.metadataID] {
+			continue
+		}
+		for _, claim := range claims {
+			if record.row != claim.row || record.record.Category != claim.record.Category {
+				continue
+			}
+			contested = true
+			if record.before(claim) {
+				lost = true
+			}
+		}
+	}
+	return contested, lost
+}
+
+// Orders claims by creation time, with the metadata ID breaking ties
+func (c claimedRow) before(other claimedRow) bool {
+	if c.record.AddedAt != other.record.AddedAt {
+		return c.record.AddedAt < other.record.AddedAt
+	}
+	return c.metadataID < other.metadataID
+}
+
+// Returns the expense records attached to rows of the given sheet
+func expenseRecords(matches []*sheets.MatchedDeveloperMetadata, sheetID int64) []claimedRow {
+	var records []claimedRow
+	for _, match := range matches {
+		record, ok := parseExpenseMetadata(match.DeveloperMetadata)
+		if ok && record.sheetID == sheetID {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Reads the description columns and the expense records of a worksheet
+// Column A locates the expense table, and is also the Fundamentals description column
+func (s *SheetsService) readExpenseTable(ctx context.Context, worksheet string, sheetID int64) (*expenseTable, error) {
+	funDescCol, _ := categoryColumns(CategoryFun)
+	colRanges := []string{
+		fmt.Sprintf("%s!A:A", worksheet),
+		fmt.Sprintf("%s!%s:%s", worksheet, funDescCol, funDescCol),
+	}
+
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
+		Ranges(colRanges...).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("get column values: %w", err)
+	}
+
+	if len(resp.ValueRanges) < 2 {
+		return nil, fmt.Errorf("expected 2 value ranges, got %d", len(resp.ValueRanges))
+	}
+
+	anchorValues := flattenColumn(resp.ValueRanges[0].Values)
+
+	startRow, ok := findExpenseStartRow(anchorValues)
+	if !ok {
+		return nil, fmt.Errorf("could not find expense start row")
+	}
+
+	matches, err := s.searchExpenseMetadata(ctx, sheetID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &expenseTable{
+		startRow: startRow,
+		columns: map[Category][]string{
+			CategoryFundamentals: anchorValues,
+			CategoryFun:          flattenColumn(resp.ValueRanges[1].Values),
+		},
+		claims: expenseRecords(matches, sheetID),
+	}, nil
+}
+
+// Drops the expenses whose Telegram update was already written to the table
+func (s *SheetsService) skipRecordedExpenses(worksheet string, table *expenseTable, expenses []*Expense) []*Expense {
+	recorded := table.recordedUpdates()
+
+	var pending []*Expense
+	for _, expense := range expenses {
+		if expense.UpdateID != 0 && recorded[expense.UpdateID] {
+			s.logger.Info("skipping already recorded expense",
+				slog.String("worksheet", worksheet),
+				slog.Int64("update_id", expense.UpdateID))
+			continue
+		}
+		pending = append(pending, expense)
+	}
+
+	return pending
+}
+
+// Attaches an expense record to each row and removes the stale claims on them in one atomic update
+// The records stay on the rows once written, so /undo and redeliveries can find them
+func (s *SheetsService) claimRows(ctx context.Context, sheetID int64, rows []int, expenses []*Expense, stale []int64, link *messageLink) ([]claimedRow, error) {
+	addedAt := time.Now().UnixNano()
+
+	claims := make([]claimedRow, len(expenses))
+	requests := make([]*sheets.Request, 0, len(expenses)+len(stale))
+	for i, expense := range expenses {
+		claims[i] = claimedRow{
+			row: rows[i],
+			record: expenseRecord{
+				UserID:   expense.UserID,
+				Category: expense.Category,
+				AddedAt:  addedAt + int64(i), // Keeps the message order for /undo
+				UpdateID: expense.UpdateID,
+			},
+		}
+		if link != nil {
+			claims[i].record.ChatID = link.chatID
+			claims[i].record.MessageID = link.messageID
+		}
+
+		record, err := json.Marshal(claims[i].record)
+		if err != nil {
+			return nil, fmt.Errorf("marshal expense record: %w", err)
+		}
+
+		requests = append(requests, &sheets.Request{
+			CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{
+				DeveloperMetadata: &sheets.DeveloperMetadata{
+					MetadataKey:   expenseMetadataKey,
+					MetadataValue: string(record),
+					Visibility:    "DOCUMENT",
+					Location: &sheets.DeveloperMetadataLocation{
+						DimensionRange: rowRange(sheetID, rows[i]),
+					},
+				},
+			},
+		})
+	}
+	requests = append(requests, deleteMetadataRequests(stale)...)
+
+	resp, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: requests,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("create developer metadata: %w", err)
+	}
+
+	for i := range claims {
+		if i >= len(resp.Replies) || resp.Replies[i].CreateDeveloperMetadata == nil ||
+			resp.Replies[i].CreateDeveloperMetadata.DeveloperMetadata == nil {
+			return nil, fmt.Errorf("missing created developer metadata in reply %d", i)
+		}
+		claims[i].metadataID = resp.Replies[i].CreateDeveloperMetadata.DeveloperMetadata.MetadataId
+	}
+
+	return claims, nil
+}
+
+// Waits until no other writer claims the rows
+// Returns false if the rows were lost to an earlier claim, or the other claims were never released
+func (s *SheetsService) awaitClaims(ctx context.Context, sheetID int64, claims []claimedRow) (bool, error) {
+	for check := 1; ; check++ {
+		matches, err := s.searchExpenseMetadata(ctx, sheetID)
+		if err != nil {
+			return false, err
+		}
+
+		contested, lost := contest(expenseRecords(matches, sheetID), claims)
+		if !contested {
+			return true, nil
+		}
+		if lost || check == maxClaimChecks {
+			return false, nil
+		}
+
+		if err := s.waitBeforeClaim(ctx); err != nil {
+			return false, err
+		}
+	}
+}
+
+// Removes claims that lost to another writer
+// A failure is only logged, the claims expire after staleClaimAge
+func (s *SheetsService) releaseClaims(ctx context.Context, claims []claimedRow) {
+	ids := make([]int64, 0, len(claims))
+	for _, claim := range claims {
+		ids = append(ids, claim.metadataID)
+	}
+
+	_, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: deleteMetadataRequests(ids),
+	}).Context(ctx).Do()
+	if err != nil {
+		s.logger.Warn("failed to release row claims", slog.String("error", err.Error()))
+	}
+}
+
+// Waits a random time up to claimBackoff so competing writers don't claim in lockstep
+func (s *SheetsService) waitBeforeClaim(ctx context.Context) error {
+	if s.claimBackoff <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(rand.N(s.claimBackoff))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func deleteMetadataRequests(ids []int64) []*sheets.Request {
+	requests := make([]*sheets.Request, 0, len(ids))
+	for _, id := range ids {
+		requests = append(requests, &sheets.Request{
+			DeleteDeveloperMetadata: &sheets.DeleteDeveloperMetadataRequest{
+				DataFilter: &sheets.DataFilter{
+					DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{MetadataId: id},
+				},
+			},
+		})
+	}
+	return requests
+}
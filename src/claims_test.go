@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpenseTableAllocate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	recent := now.Add(-10 * time.Second).UnixNano()
+	old := now.Add(-time.Hour).UnixNano()
+
+	table := &expenseTable{
+		startRow: 2,
+		columns: map[Category][]string{
+			CategoryFundamentals: {"Total Net income", "Header", "Rent"},
+			CategoryFun:          {"", "Header", "Movies"},
+		},
+		claims: []claimedRow{
+			{metadataID: 1, row: 3, record: expenseRecord{Category: CategoryFundamentals, AddedAt: old}},
+			{metadataID: 2, row: 4, record: expenseRecord{Category: CategoryFundamentals, AddedAt: recent}},
+			{metadataID: 3, row: 5, record: expenseRecord{Category: CategoryFundamentals, AddedAt: old}},
+			{metadataID: 4, row: 4, record: expenseRecord{Category: CategoryFun, AddedAt: old}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		expenses  []*Expense
+		wantRows  []int
+		wantStale []int64
+	}{
+		{
+			name:      "skips live claims and takes over stale ones",
+			expenses:  []*Expense{{Category: CategoryFundamentals}, {Category: CategoryFundamentals}},
+			wantRows:  []int{5, 6},
+			wantStale: []int64{3},
+		},
+		{
+			name:     "claims only block their own category",
+			expenses: []*Expense{{Category: CategoryFun}, {Category: CategoryFundamentals}, {Category: CategoryFun}},
+			// Row 4 of Fun only has a stale claim
+			wantRows:  []int{4, 5, 5},
+			wantStale: []int64{3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rows, stale := table.allocate(tt.expenses, now)
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("allocate() rows = %v, want %v", rows, tt.wantRows)
+			}
+			if !reflect.DeepEqual(stale, tt.wantStale) {
+				t.Errorf("allocate() stale = %v, want %v", stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestExpenseTableRecordedUpdates(t *testing.T) {
+	t.Parallel()
+
+	table := &expenseTable{
+		startRow: 2,
+		columns: map[Category][]string{
+			CategoryFundamentals: {"Total Net income", "Header", "Milk", "Bread", ""},
+			CategoryFun:          {"", "Header", "Movies"},
+		},
+		claims: []claimedRow{
+			{row: 3, record: expenseRecord{Category: CategoryFundamentals, UpdateID: 1001}},
+			{row: 4, record: expenseRecord{Category: CategoryFundamentals, UpdateID: 1001}},
+			{row: 3, record: expenseRecord{Category: CategoryFun, UpdateID: 1002}},
+			{row: 5, record: expenseRecord{Category: CategoryFundamentals, UpdateID: 1003}},
+			{row: 4, record: expenseRecord{Category: CategoryFun, UpdateID: 1004}},
+			{row: 4, record: expenseRecord{Category: CategoryFundamentals}},
+		},
+	}
+
+	got := table.recordedUpdates()
+	want := map[int64]bool{1001: true, 1002: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recordedUpdates() = %v, want %v", got, want)
+	}
+}
+
+func TestContest(t *testing.T) {
+	t.Parallel()
+
+	claims := []claimedRow{
+		{metadataID: 10, row: 4, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 500}},
+		{metadataID: 11, row: 5, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 501}},
+	}
+
+	tests := []struct {
+		name          string
+		records       []claimedRow
+		wantContested bool
+		wantLost      bool
+	}{
+		{
+			name:    "only our claims",
+			records: claims,
+		},
+		{
+			name: "other rows",
+			records: append([]claimedRow{
+				{metadataID: 3, row: 3, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 100}},
+			}, claims...),
+		},
+		{
+			name: "same row in another category",
+			records: append([]claimedRow{
+				{metadataID: 3, row: 4, record: expenseRecord{Category: CategoryFun, AddedAt: 100}},
+			}, claims...),
+		},
+		{
+			name: "later claim on our row",
+			records: append([]claimedRow{
+				{metadataID: 12, row: 5, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 900}},
+			}, claims...),
+			wantContested: true,
+		},
+		{
+			name: "earlier claim on our row",
+			records: append([]claimedRow{
+				{metadataID: 12, row: 5, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 100}},
+			}, claims...),
+			wantContested: true,
+			wantLost:      true,
+		},
+		{
+			name: "simultaneous claim with a lower id",
+			records: append([]claimedRow{
+				{metadataID: 9, row: 4, record: expenseRecord{Category: CategoryFundamentals, AddedAt: 500}},
+			}, claims...),
+			wantContested: true,
+			wantLost:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			contested, lost := contest(tt.records, claims)
+			if contested != tt.wantContested || lost != tt.wantLost {
+				t.Errorf("contest() = %v, %v, want %v, %v", contested, lost, tt.wantContested, tt.wantLost)
+			}
+		})
+	}
+}
+
+func TestAddExpensesConcurrentWriters(t *testing.T) {
+	t.Parallel()
+
+	const writers = 4
+
+	fake := newFakeSheets("March 2026")
+
+	// Every writer's first read sees the table before anyone claimed a row
+	var reads sync.WaitGroup
+	var calls atomic.Int32
+	reads.Add(writers)
+	fake.afterBatchGet = func() {
+		if calls.Add(1) <= writers {
+			reads.Done()
+			reads.Wait()
+		}
+	}
+
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := newFakeSheetsService(t, server)
+			errs <- s.AddExpense(context.Background(), "March 2026", &Expense{
+				Desc:     fmt.Sprintf("Writer %d", i),
+				Amount:   Cents(int64(i+1) * 100),
+				UpdateID: int64(100 + i),
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AddExpense() unexpected error: %v", err)
+		}
+	}
+
+	fake.assertExpenses(t, CategoryFundamentals, 4, writers)
+}
+
+func TestAddExpensesClaimAfterStaleRead(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// The first writer completes between the second writer's read and its claim
+	var calls atomic.Int32
+	fake.afterBatchGet = func() {
+		if calls.Add(1) != 1 {
+			return
+		}
+		first := newFakeSheetsService(t, server)
+		if err := first.AddExpense(context.Background(), "March 2026", &Expense{Desc: "First", Amount: Cents(100)}); err != nil {
+			t.Errorf("first AddExpense() unexpected error: %v", err)
+		}
+	}
+
+	second := newFakeSheetsService(t, server)
+	if err := second.AddExpense(context.Background(), "March 2026", &Expense{Desc: "Second", Amount: Cents(200)}); err != nil {
+		t.Fatalf("second AddExpense() unexpected error: %v", err)
+	}
+
+	if got := fake.cell("A4"); got != "First" {
+		t.Errorf("A4 = %v, want First", got)
+	}
+	if got := fake.cell("A5"); got != "Second" {
+		t.Errorf("A5 = %v, want Second", got)
+	}
+	fake.assertExpenses(t, CategoryFundamentals, 4, 2)
+}
+
+func TestAddExpensesRedelivery(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	expenses := func() []*Expense {
+		return []*Expense{
+			{Desc: "Milk", Amount: Cents(120), UpdateID: 7},
+			{Desc: "Movies", Amount: Cents(1200), Category: CategoryFun, UpdateID: 7},
+		}
+	}
+
+	for range 2 {
+		if err := s.AddExpenses(context.Background(), "March 2026", expenses()); err != nil {
+			t.Fatalf("AddExpenses() unexpected error: %v", err)
+		}
+	}
+
+	fake.assertExpenses(t, CategoryFundamentals, 4, 1)
+	fake.assertExpenses(t, CategoryFun, 4, 1)
+}
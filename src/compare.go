@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+)
+
+// Complete months before the current one that make up the trailing average
+const averagedMonths = 3
+
+// Averages the totals of the months that have a worksheet and returns how many there were
+func averageTotals(months []MonthTotals) (MonthlyTotals, int) {
+	var sum MonthlyTotals
+	var count int
+	for _, month := range months {
+		if !month.Found {
+			continue
+		}
+		sum.Fundamentals = sum.Fundamentals.Add(month.Totals.Fundamentals)
+		sum.Fun = sum.Fun.Add(month.Totals.Fun)
+		count++
+	}
+
+	if count == 0 {
+		return MonthlyTotals{}, 0
+	}
+	return MonthlyTotals{Fundamentals: sum.Fundamentals.Div(int64(count)), Fun: sum.Fun.Div(int64(count))}, count
+}
+
+// Formats this month, last month and the trailing average per category as a table
+// history starts with the current month, followed by the months before it
+func formatComparison(history []MonthTotals) string {
+	current := history[0]
+	var previous MonthTotals
+	if len(history) > 1 {
+		previous = history[1]
+	}
+	average, averaged := averageTotals(history[1:])
+
+	column := func(found bool, amount Money) string {
+		if !found {
+			return "–"
+		}
+		return formatAmount(amount)
+	}
+	row := func(name string, amount func(MonthlyTotals) Money) []string {
+		return []string{
+			name,
+			formatAmount(amount(current.Totals)),
+			column(previous.Found, amount(previous.Totals)),
+			column(averaged > 0, amount(average)),
+		}
+	}
+
+	rows := [][]string{
+		{"", "This month", "Last month", fmt.Sprintf("%d-mo avg", averagedMonths)},
+		row(CategoryFundamentals.String(), func(t MonthlyTotals) Money { return t.Fundamentals }),
+		row(CategoryFun.String(), func(t MonthlyTotals) Money { return t.Fun }),
+	}
+	total := row("Total", MonthlyTotals.Total)
+
+	response := fmt.Sprintf("📊 %s compared to earlier months\n\n%s", html.EscapeString(current.Title), formatTable(rows, total))
+
+	if averaged > 0 && average.Total().Cents > 0 {
+		response += "\n" + describeChange(current.Totals.Total(), average.Total(), averaged)
+	}
+
+	return response
+}
+
+// Describes how far spending is from the trailing average
+func describeChange(current, average Money, months int) string {
+	reference := fmt.Sprintf("the average of the last %d months", months)
+	if months == 1 {
+		reference = "last month"
+	}
+
+	change := math.Round(current.Sub(average).Ratio(average) * 100)
+	switch {
+	case change > 0:
+		return fmt.Sprintf("This month is %.0f%% above %s.", change, reference)
+	case change < 0:
+		return fmt.Sprintf("This month is %.0f%% below %s.", -change, reference)
+	default:
+		return fmt.Sprintf("This month is level with %s.", reference)
+	}
+}
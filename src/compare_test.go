@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAverageTotals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		months    []MonthTotals
+		want      MonthlyTotals
+		wantCount int
+	}{
+		{
+			name: "averages found months",
+			months: []MonthTotals{
+				{Found: true, Totals: MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(6000)}},
+				{Found: true, Totals: MonthlyTotals{Fundamentals: Cents(50000), Fun: Cents(3000)}},
+				{Found: true, Totals: MonthlyTotals{Fundamentals: Cents(70000), Fun: Cents(0)}},
+			},
+			want:      MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(3000)},
+			wantCount: 3,
+		},
+		{
+			name: "skips missing worksheets",
+			months: []MonthTotals{
+				{Found: true, Totals: MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(6000)}},
+				{Totals: MonthlyTotals{Fundamentals: Cents(99900)}},
+				{Found: true, Totals: MonthlyTotals{Fundamentals: Cents(40000), Fun: Cents(2000)}},
+			},
+			want:      MonthlyTotals{Fundamentals: Cents(50000), Fun: Cents(4000)},
+			wantCount: 2,
+		},
+		{
+			name:   "no months",
+			months: []MonthTotals{{}, {}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, count := averageTotals(tt.months)
+			if got != tt.want || count != tt.wantCount {
+				t.Errorf("averageTotals() = %+v, %d, want %+v, %d", got, count, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestFormatComparison(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		history []MonthTotals
+		want    string
+	}{
+		{
+			name: "full history",
+			history: []MonthTotals{
+				{Title: "March 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(66000), Fun: Cents(4550)}},
+				{Title: "February 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(6000)}},
+				{Title: "January 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(50000), Fun: Cents(3000)}},
+				{Title: "December 2025", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(70000)}},
+			},
+			want: "📊 March 2026 compared to earlier months\n\n<pre>" +
+				"             This month Last month 3-mo avg\n" +
+				"Fundamentals     660,00     600,00   600,00\n" +
+				"Fun               45,50      60,00    30,00\n" +
+				"-------------------------------------------\n" +
+				"Total            705,50     660,00   630,00\n" +
+				"</pre>\nThis month is 12% above the average of the last 3 months.",
+		},
+		{
+			name: "first month",
+			history: []MonthTotals{
+				{Title: "March 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(1000)}},
+				{Title: "February 2026"},
+				{Title: "January 2026"},
+				{Title: "December 2025"},
+			},
+			want: "📊 March 2026 compared to earlier months\n\n<pre>" +
+				"             This month Last month 3-mo avg\n" +
+				"Fundamentals      10,00          –        –\n" +
+				"Fun                0,00          –        –\n" +
+				"-------------------------------------------\n" +
+				"Total             10,00          –        –\n" +
+				"</pre>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := formatComparison(tt.history); got != tt.want {
+				t.Errorf("formatComparison() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDescribeChange(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		current Money
+		average Money
+		months  int
+		want    string
+	}{
+		{
+			name:    "above",
+			current: Cents(15000),
+			average: Cents(10000),
+			months:  3,
+			want:    "This month is 50% above the average of the last 3 months.",
+		},
+		{
+			name:    "below last month",
+			current: Cents(7500),
+			average: Cents(10000),
+			months:  1,
+			want:    "This month is 25% below last month.",
+		},
+		{
+			name:    "level",
+			current: Cents(10020),
+			average: Cents(10000),
+			months:  2,
+			want:    "This month is level with the average of the last 2 months.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := describeChange(tt.current, tt.average, tt.months); got != tt.want {
+				t.Errorf("describeChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,14 +4,66 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+var columnPattern = regexp.MustCompile(`^[A-Z]{1,3}$`)
+
+const (
+	defaultWorksheetTitleFormat = "January 2006"
+	defaultTimezone             = "UTC"
+)
+
+// Where receipt files are stored, receipts are not stored if empty
+const (
+	ReceiptStoreLocal = "local"
+	ReceiptStoreS3    = "s3"
+)
+
+// Engine that reads receipt photos sent without a caption, photos are not read if empty
+const OCREngineTesseract = "tesseract"
+
+// Service that transcribes voice messages, voice messages are ignored if empty
+const TranscriberWhisper = "whisper"
+
 type Config struct {
-	TelegramBotToken      string
-	GoogleCredentialsJSON string
-	GoogleSpreadsheetID   string
-	LogLevel              slog.Level
+	TelegramBotToken       string
+	GoogleCredentialsJSON  string
+	GoogleSpreadsheetID    string
+	LogLevel               slog.Level
+	AllowedUserIDs         []int64
+	AllowedChatIDs         []int64
+	Budget                 Budget
+	WorksheetTitleFormat   string
+	Location               *time.Location
+	AmountLocale           AmountLocale
+	TemplateWorksheet      string
+	FundamentalsDateColumn string
+	FunDateColumn          string
+
+	FundamentalsOriginalColumn string
+	FunOriginalColumn          string
+	ExchangeRatesFile          string
+
+	ReceiptStore    string
+	ReceiptDir      string
+	ReceiptBucket   string
+	ReceiptEndpoint string
+	ReceiptBaseURL  string
+
+	FundamentalsReceiptColumn string
+	FunReceiptColumn          string
+
+	OCREngine     string
+	TesseractPath string
+	OCRLanguages  string
+
+	Transcriber     string
+	WhisperURL      string
+	WhisperLanguage string
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,14 +84,199 @@ func LoadConfig() (*Config, error) {
 
 	logLevel := getLogLevel(os.Getenv("LOG_LEVEL"))
 
+	allowedUserIDs, err := parseIDList(os.Getenv("ALLOWED_USER_IDS"))
+	if err != nil {
+		return nil, fmt.Errorf("parse ALLOWED_USER_IDS: %w", err)
+	}
+
+	allowedChatIDs, err := parseIDList(os.Getenv("ALLOWED_CHAT_IDS"))
+	if err != nil {
+		return nil, fmt.Errorf("parse ALLOWED_CHAT_IDS: %w", err)
+	}
+
+	budget, err := loadBudget()
+	if err != nil {
+		return nil, err
+	}
+
+	titleFormat := os.Getenv("WORKSHEET_TITLE_FORMAT")
+	if titleFormat == "" {
+		titleFormat = defaultWorksheetTitleFormat
+	}
+
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("load TIMEZONE: %w", err)
+	}
+
+	amountLocale, ok := parseAmountLocale(os.Getenv("AMOUNT_LOCALE"))
+	if !ok {
+		return nil, fmt.Errorf("AMOUNT_LOCALE must be \"eu\" or \"en\", got %q", os.Getenv("AMOUNT_LOCALE"))
+	}
+
+	fundDateCol, err := parseColumn("FUNDAMENTALS_DATE_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
+	funDateCol, err := parseColumn("FUN_DATE_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
+	fundOrigCol, err := parseColumn("FUNDAMENTALS_ORIGINAL_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
+	funOrigCol, err := parseColumn("FUN_ORIGINAL_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
+	receiptStore := strings.ToLower(os.Getenv("RECEIPT_STORE"))
+	receiptDir := os.Getenv("RECEIPT_DIR")
+	receiptBucket := os.Getenv("RECEIPT_BUCKET")
+	switch receiptStore {
+	case "":
+	case ReceiptStoreLocal:
+		if receiptDir == "" {
+			return nil, fmt.Errorf("RECEIPT_DIR environment variable is required for the local receipt store")
+		}
+	case ReceiptStoreS3:
+		if receiptBucket == "" {
+			return nil, fmt.Errorf("RECEIPT_BUCKET environment variable is required for the s3 receipt store")
+		}
+	default:
+		return nil, fmt.Errorf("RECEIPT_STORE must be \"local\" or \"s3\", got %q", receiptStore)
+	}
+
+	ocrEngine := strings.ToLower(os.Getenv("OCR_ENGINE"))
+	if ocrEngine != "" && ocrEngine != OCREngineTesseract {
+		return nil, fmt.Errorf("OCR_ENGINE must be \"tesseract\", got %q", ocrEngine)
+	}
+
+	transcriber := strings.ToLower(os.Getenv("TRANSCRIBER"))
+	whisperURL := os.Getenv("WHISPER_URL")
+	switch transcriber {
+	case "":
+	case TranscriberWhisper:
+		if whisperURL == "" {
+			return nil, fmt.Errorf("WHISPER_URL environment variable is required for the whisper transcriber")
+		}
+	default:
+		return nil, fmt.Errorf("TRANSCRIBER must be \"whisper\", got %q", transcriber)
+	}
+
+	fundReceiptCol, err := parseColumn("FUNDAMENTALS_RECEIPT_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
+	funReceiptCol, err := parseColumn("FUN_RECEIPT_COLUMN")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		TelegramBotToken:      telegramToken,
-		GoogleCredentialsJSON: googleCreds,
-		GoogleSpreadsheetID:   spreadsheetID,
-		LogLevel:              logLevel,
+		TelegramBotToken:       telegramToken,
+		GoogleCredentialsJSON:  googleCreds,
+		GoogleSpreadsheetID:    spreadsheetID,
+		LogLevel:               logLevel,
+		AllowedUserIDs:         allowedUserIDs,
+		AllowedChatIDs:         allowedChatIDs,
+		Budget:                 budget,
+		WorksheetTitleFormat:   titleFormat,
+		Location:               location,
+		AmountLocale:           amountLocale,
+		TemplateWorksheet:      os.Getenv("TEMPLATE_WORKSHEET"),
+		FundamentalsDateColumn: fundDateCol,
+		FunDateColumn:          funDateCol,
+
+		FundamentalsOriginalColumn: fundOrigCol,
+		FunOriginalColumn:          funOrigCol,
+		ExchangeRatesFile:          os.Getenv("EXCHANGE_RATES_FILE"),
+
+		ReceiptStore:    receiptStore,
+		ReceiptDir:      receiptDir,
+		ReceiptBucket:   receiptBucket,
+		ReceiptEndpoint: os.Getenv("RECEIPT_ENDPOINT"),
+		ReceiptBaseURL:  os.Getenv("RECEIPT_BASE_URL"),
+
+		FundamentalsReceiptColumn: fundReceiptCol,
+		FunReceiptColumn:          funReceiptCol,
+
+		OCREngine:     ocrEngine,
+		TesseractPath: os.Getenv("TESSERACT_PATH"),
+		OCRLanguages:  os.Getenv("OCR_LANGUAGES"),
+
+		Transcriber:     transcriber,
+		WhisperURL:      whisperURL,
+		WhisperLanguage: os.Getenv("WHISPER_LANGUAGE"),
 	}, nil
 }
 
+// Loads the default monthly budget, used when the worksheet does not set one
+func loadBudget() (Budget, error) {
+	var budget Budget
+	limits := []struct {
+		key   string
+		limit *Money
+	}{
+		{"BUDGET_TOTAL", &budget.Total},
+		{"BUDGET_FUNDAMENTALS", &budget.Fundamentals},
+		{"BUDGET_FUN", &budget.Fun},
+	}
+
+	for _, l := range limits {
+		value := os.Getenv(l.key)
+		if value == "" {
+			continue
+		}
+		limit, ok := parseMoney(strings.ReplaceAll(value, ",", "."))
+		if !ok || limit.Cents < 0 {
+			return Budget{}, fmt.Errorf("%s must be a non-negative number, got %q", l.key, value)
+		}
+		*l.limit = limit
+	}
+
+	return budget, nil
+}
+
+// Reads an optional spreadsheet column letter such as "E" from the environment
+func parseColumn(key string) (string, error) {
+	column := strings.ToUpper(strings.TrimSpace(os.Getenv(key)))
+	if column == "" {
+		return "", nil
+	}
+	if !columnPattern.MatchString(column) {
+		return "", fmt.Errorf("%s must be a column letter, got %q", key, column)
+	}
+	return column, nil
+}
+
+// Parses a comma-separated list of Telegram IDs, e.g. "123,-456"
+func parseIDList(value string) ([]int64, error) {
+	var ids []int64
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", part, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 func getLogLevel(level string) slog.Level {
 	switch strings.ToUpper(level) {
 	case "DEBUG":
@@ -2,11 +2,21 @@ package main
 
 import (
 	"log/slog"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
-	envKeys := []string{"TELEGRAM_BOT_TOKEN", "GOOGLE_CREDENTIALS_JSON", "GOOGLE_SPREADSHEET_ID", "LOG_LEVEL"}
+	envKeys := []string{
+		"TELEGRAM_BOT_TOKEN", "GOOGLE_CREDENTIALS_JSON", "GOOGLE_SPREADSHEET_ID", "LOG_LEVEL",
+		"ALLOWED_USER_IDS", "ALLOWED_CHAT_IDS", "BUDGET_TOTAL", "BUDGET_FUNDAMENTALS", "BUDGET_FUN",
+		"WORKSHEET_TITLE_FORMAT", "TIMEZONE", "AMOUNT_LOCALE", "TEMPLATE_WORKSHEET",
+		"FUNDAMENTALS_DATE_COLUMN", "FUN_DATE_COLUMN", "FUNDAMENTALS_ORIGINAL_COLUMN", "FUN_ORIGINAL_COLUMN",
+		"EXCHANGE_RATES_FILE", "RECEIPT_STORE", "RECEIPT_DIR", "RECEIPT_BUCKET", "RECEIPT_ENDPOINT", "RECEIPT_BASE_URL",
+		"FUNDAMENTALS_RECEIPT_COLUMN", "FUN_RECEIPT_COLUMN", "OCR_ENGINE", "TESSERACT_PATH", "OCR_LANGUAGES",
+		"TRANSCRIBER", "WHISPER_URL", "WHISPER_LANGUAGE",
+	}
 
 	tests := []struct {
 		name    string
@@ -26,6 +36,8 @@ func TestLoadConfig(t *testing.T) {
 				GoogleCredentialsJSON: `{"type":"service_account"}`,
 				GoogleSpreadsheetID:   "sheet-123",
 				LogLevel:              slog.LevelInfo,
+				WorksheetTitleFormat:  "January 2006",
+				Location:              time.UTC,
 			},
 		},
 		{
@@ -41,7 +53,274 @@ func TestLoadConfig(t *testing.T) {
 				GoogleCredentialsJSON: `{"type":"service_account"}`,
 				GoogleSpreadsheetID:   "sheet-123",
 				LogLevel:              slog.LevelDebug,
+				WorksheetTitleFormat:  "January 2006",
+				Location:              time.UTC,
+			},
+		},
+		{
+			name: "valid config with allowlist",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"ALLOWED_USER_IDS":        "123, 456",
+				"ALLOWED_CHAT_IDS":        "-1001234",
+			},
+			want: &Config{
+				TelegramBotToken:      "test-token",
+				GoogleCredentialsJSON: `{"type":"service_account"}`,
+				GoogleSpreadsheetID:   "sheet-123",
+				LogLevel:              slog.LevelInfo,
+				AllowedUserIDs:        []int64{123, 456},
+				AllowedChatIDs:        []int64{-1001234},
+				WorksheetTitleFormat:  "January 2006",
+				Location:              time.UTC,
+			},
+		},
+		{
+			name: "invalid allowed user id",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"ALLOWED_USER_IDS":        "123,abc",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config with budget",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"BUDGET_TOTAL":            "1500",
+				"BUDGET_FUN":              "250,50",
+			},
+			want: &Config{
+				TelegramBotToken:      "test-token",
+				GoogleCredentialsJSON: `{"type":"service_account"}`,
+				GoogleSpreadsheetID:   "sheet-123",
+				LogLevel:              slog.LevelInfo,
+				Budget:                Budget{Total: Cents(150000), Fun: Cents(25050)},
+				WorksheetTitleFormat:  "January 2006",
+				Location:              time.UTC,
+			},
+		},
+		{
+			name: "invalid budget",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"BUDGET_FUNDAMENTALS":     "-1",
 			},
+			wantErr: true,
+		},
+		{
+			name: "valid config with worksheet settings",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":       "test-token",
+				"GOOGLE_CREDENTIALS_JSON":  `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":    "sheet-123",
+				"WORKSHEET_TITLE_FORMAT":   "Jan 2006",
+				"TIMEZONE":                 "Europe/Helsinki",
+				"AMOUNT_LOCALE":            "EN",
+				"TEMPLATE_WORKSHEET":       "Template",
+				"FUNDAMENTALS_DATE_COLUMN": "e",
+				"FUN_DATE_COLUMN":          "F",
+
+				"FUNDAMENTALS_ORIGINAL_COLUMN": "g",
+				"FUN_ORIGINAL_COLUMN":          "H",
+				"EXCHANGE_RATES_FILE":          "/etc/rates.json",
+			},
+			want: &Config{
+				TelegramBotToken:       "test-token",
+				GoogleCredentialsJSON:  `{"type":"service_account"}`,
+				GoogleSpreadsheetID:    "sheet-123",
+				LogLevel:               slog.LevelInfo,
+				WorksheetTitleFormat:   "Jan 2006",
+				Location:               mustLoadLocation(t, "Europe/Helsinki"),
+				AmountLocale:           LocaleEnglish,
+				TemplateWorksheet:      "Template",
+				FundamentalsDateColumn: "E",
+				FunDateColumn:          "F",
+
+				FundamentalsOriginalColumn: "G",
+				FunOriginalColumn:          "H",
+				ExchangeRatesFile:          "/etc/rates.json",
+			},
+		},
+		{
+			name: "invalid timezone",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"TIMEZONE":                "Mars/Olympus_Mons",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid amount locale",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"AMOUNT_LOCALE":           "fr",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid date column",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"FUN_DATE_COLUMN":         "F1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config with s3 receipt store",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":          "test-token",
+				"GOOGLE_CREDENTIALS_JSON":     `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":       "sheet-123",
+				"RECEIPT_STORE":               "S3",
+				"RECEIPT_BUCKET":              "receipts",
+				"RECEIPT_ENDPOINT":            "https://storage.example.com",
+				"RECEIPT_BASE_URL":            "https://files.example.com",
+				"FUNDAMENTALS_RECEIPT_COLUMN": "i",
+				"FUN_RECEIPT_COLUMN":          "J",
+			},
+			want: &Config{
+				TelegramBotToken:          "test-token",
+				GoogleCredentialsJSON:     `{"type":"service_account"}`,
+				GoogleSpreadsheetID:       "sheet-123",
+				LogLevel:                  slog.LevelInfo,
+				WorksheetTitleFormat:      defaultWorksheetTitleFormat,
+				Location:                  time.UTC,
+				ReceiptStore:              ReceiptStoreS3,
+				ReceiptBucket:             "receipts",
+				ReceiptEndpoint:           "https://storage.example.com",
+				ReceiptBaseURL:            "https://files.example.com",
+				FundamentalsReceiptColumn: "I",
+				FunReceiptColumn:          "J",
+			},
+		},
+		{
+			name: "valid config with ocr",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"OCR_ENGINE":              "Tesseract",
+				"TESSERACT_PATH":          "/opt/bin/tesseract",
+				"OCR_LANGUAGES":           "eng+fin",
+			},
+			want: &Config{
+				TelegramBotToken:      "test-token",
+				GoogleCredentialsJSON: `{"type":"service_account"}`,
+				GoogleSpreadsheetID:   "sheet-123",
+				LogLevel:              slog.LevelInfo,
+				WorksheetTitleFormat:  defaultWorksheetTitleFormat,
+				Location:              time.UTC,
+				OCREngine:             OCREngineTesseract,
+				TesseractPath:         "/opt/bin/tesseract",
+				OCRLanguages:          "eng+fin",
+			},
+		},
+		{
+			name: "unknown ocr engine",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"OCR_ENGINE":              "cloud",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid config with transcriber",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"TRANSCRIBER":             "Whisper",
+				"WHISPER_URL":             "http://localhost:8080",
+				"WHISPER_LANGUAGE":        "fi",
+			},
+			want: &Config{
+				TelegramBotToken:      "test-token",
+				GoogleCredentialsJSON: `{"type":"service_account"}`,
+				GoogleSpreadsheetID:   "sheet-123",
+				LogLevel:              slog.LevelInfo,
+				WorksheetTitleFormat:  defaultWorksheetTitleFormat,
+				Location:              time.UTC,
+				Transcriber:           TranscriberWhisper,
+				WhisperURL:            "http://localhost:8080",
+				WhisperLanguage:       "fi",
+			},
+		},
+		{
+			name: "unknown transcriber",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"TRANSCRIBER":             "cloud",
+			},
+			wantErr: true,
+		},
+		{
+			name: "whisper transcriber without url",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"TRANSCRIBER":             "whisper",
+			},
+			wantErr: true,
+		},
+		{
+			name: "local receipt store without directory",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"RECEIPT_STORE":           "local",
+			},
+			wantErr: true,
+		},
+		{
+			name: "s3 receipt store without bucket",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"RECEIPT_STORE":           "s3",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown receipt store",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":      "test-token",
+				"GOOGLE_CREDENTIALS_JSON": `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":   "sheet-123",
+				"RECEIPT_STORE":           "dropbox",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid original column",
+			envVars: map[string]string{
+				"TELEGRAM_BOT_TOKEN":           "test-token",
+				"GOOGLE_CREDENTIALS_JSON":      `{"type":"service_account"}`,
+				"GOOGLE_SPREADSHEET_ID":        "sheet-123",
+				"FUNDAMENTALS_ORIGINAL_COLUMN": "G-H",
+			},
+			wantErr: true,
 		},
 		{
 			name: "missing telegram token",
@@ -90,13 +369,22 @@ func TestLoadConfig(t *testing.T) {
 			if err != nil {
 				t.Fatalf("LoadConfig() unexpected error: %v", err)
 			}
-			if *config != *tt.want {
+			if !reflect.DeepEqual(config, tt.want) {
 				t.Errorf("LoadConfig() = %+v, want %+v", *config, *tt.want)
 			}
 		})
 	}
 }
 
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load location %q: %v", name, err)
+	}
+	return location
+}
+
 func TestGetLogLevel(t *testing.T) {
 	t.Parallel()
 
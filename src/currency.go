@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNoRate is returned when there is no exchange rate for a currency
+var ErrNoRate = errors.New("no exchange rate")
+
+// Currencies accepted in messages by their ISO 4217 code
+var knownCurrencies = map[string]bool{
+	"AED": true, "AUD": true, "BGN": true, "BRL": true, "CAD": true, "CHF": true, "CNY": true,
+	"CZK": true, "DKK": true, "EUR": true, "GBP": true, "HKD": true, "HUF": true, "INR": true,
+	"ISK": true, "JPY": true, "KRW": true, "MXN": true, "NOK": true, "NZD": true, "PLN": true,
+	"RON": true, "SEK": true, "SGD": true, "THB": true, "TRY": true, "USD": true, "ZAR": true,
+}
+
+// Currencies accepted in messages by their symbol
+var currencySymbols = map[string]string{
+	"€": "EUR",
+	"$": "USD",
+	"£": "GBP",
+	"¥": "JPY",
+}
+
+const (
+	currencyMarker = `([€$£¥]|[A-Z]{3})`
+	amountToken    = `([\d(][\d,.+\-*/()]*)`
+)
+
+var (
+	// "Taxi 250 SEK" or "Coffee 12$"
+	currencySuffixPattern = regexp.MustCompile(`^(.*[\d)])\s*` + currencyMarker + `$`)
+	// "Coffee $12", "Taxi SEK 250" or a bare "$12"
+	currencyPrefixPattern = regexp.MustCompile(`^((?:.+\s)?)` + currencyMarker + `\s*` + amountToken + `$`)
+	// "$12 Coffee" or "250 SEK Taxi"
+	leadingPrefixPattern = regexp.MustCompile(`^` + currencyMarker + `\s*` + amountToken + `\s+(.+)$`)
+	leadingSuffixPattern = regexp.MustCompile(`^` + amountToken + `\s*` + currencyMarker + `\s+(.+)$`)
+)
+
+// Returns the ISO code of a currency code or symbol such as "SEK" or "$"
+// Codes must be upper case, so words like "try" or "Gas" are never read as currencies
+func lookupCurrency(marker string) (string, bool) {
+	if code, ok := currencySymbols[marker]; ok {
+		return code, true
+	}
+	return marker, knownCurrencies[marker]
+}
+
+// Strips a currency code or symbol next to the amount and returns the message as "<Desc> <Amount>"
+// An amount with a currency may also come first, as in "$12 Coffee"
+// Returns the default currency if the message names none
+func extractCurrency(message string) (string, string) {
+	if matches := currencySuffixPattern.FindStringSubmatch(message); matches != nil {
+		if code, ok := lookupCurrency(matches[2]); ok {
+			return strings.TrimSpace(matches[1]), code
+		}
+	}
+	if matches := currencyPrefixPattern.FindStringSubmatch(message); matches != nil {
+		if code, ok := lookupCurrency(matches[2]); ok {
+			return matches[1] + matches[3], code
+		}
+	}
+	if matches := leadingPrefixPattern.FindStringSubmatch(message); matches != nil {
+		if code, ok := lookupCurrency(matches[1]); ok {
+			return matches[3] + " " + matches[2], code
+		}
+	}
+	if matches := leadingSuffixPattern.FindStringSubmatch(message); matches != nil {
+		if code, ok := lookupCurrency(matches[2]); ok {
+			return matches[3] + " " + matches[1], code
+		}
+	}
+	return message, defaultCurrency
+}
+
+// RateProvider supplies exchange rates, so a live source can replace the static one
+type RateProvider interface {
+	// Rate returns the worth of one unit of from in units of to on the given date
+	// Returns an error wrapping ErrNoRate if either currency is unknown
+	Rate(ctx context.Context, from, to string, date time.Time) (*big.Rat, error)
+}
+
+// StaticRates holds fixed rates into a base currency, for use without network access
+type StaticRates struct {
+	base  string
+	rates map[string]*big.Rat // Units of the base currency per unit of each currency
+}
+
+func NewStaticRates(base string, rates map[string]*big.Rat) *StaticRates {
+	return &StaticRates{base: base, rates: rates}
+}
+
+// Rates file layout, e.g. {"base": "EUR", "rates": {"SEK": "0.087", "USD": 0.92}}
+type ratesFile struct {
+	Base  string                 `json:"base"`
+	Rates map[string]json.Number `json:"rates"`
+}
+
+// LoadStaticRates reads fixed rates from a JSON file
+// An empty path gives rates that only know the default currency
+func LoadStaticRates(path string) (*StaticRates, error) {
+	if path == "" {
+		return NewStaticRates(defaultCurrency, nil), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open rates file: %w", err)
+	}
+	defer f.Close()
+
+	var file ratesFile
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse rates file: %w", err)
+	}
+
+	base := strings.ToUpper(file.Base)
+	if base == "" {
+		base = defaultCurrency
+	}
+
+	rates := make(map[string]*big.Rat, len(file.Rates))
+	for code, value := range file.Rates {
+		rate, ok := new(big.Rat).SetString(value.String())
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("rate for %s must be a positive number, got %q", code, value)
+		}
+		rates[strings.ToUpper(code)] = rate
+	}
+
+	return NewStaticRates(base, rates), nil
+}
+
+// Rate returns the fixed rate between two currencies, going through the base currency if needed
+func (r *StaticRates) Rate(ctx context.Context, from, to string, date time.Time) (*big.Rat, error) {
+	fromRate, err := r.toBase(from)
+	if err != nil {
+		return nil, err
+	}
+	toRate, err := r.toBase(to)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Rat).Quo(fromRate, toRate), nil
+}
+
+func (r *StaticRates) toBase(currency string) (*big.Rat, error) {
+	if currency == r.base {
+		return big.NewRat(1, 1), nil
+	}
+	rate, ok := r.rates[currency]
+	if !ok {
+		return nil, fmt.Errorf("%w for %s", ErrNoRate, currency)
+	}
+	return rate, nil
+}
+
+// Formats an amount paid in another currency for its sheet cell, e.g. "250.00 SEK"
+func originalCellValue(amount Money) string {
+	return amount.Decimal() + " " + amount.Currency
+}
+
+// Parses a cell written by originalCellValue
+func parseOriginalCell(value string) (Money, bool) {
+	number, currency, ok := strings.Cut(strings.TrimSpace(value), " ")
+	if !ok || !knownCurrencies[currency] {
+		return Money{}, false
+	}
+	amount, ok := parseMoney(number)
+	if !ok {
+		return Money{}, false
+	}
+	amount.Currency = currency
+	return amount, true
+}
+
+// Converts an amount into another currency, rounding to whole cents
+func convertMoney(ctx context.Context, rates RateProvider, amount Money, currency string, date time.Time) (Money, error) {
+	if amount.Currency == currency || amount.Currency == "" {
+		return Money{Cents: amount.Cents, Currency: currency}, nil
+	}
+
+	rate, err := rates.Rate(ctx, amount.Currency, currency, date)
+	if err != nil {
+		return Money{}, err
+	}
+	return moneyFromRat(new(big.Rat).Mul(big.NewRat(amount.Cents, 100), rate), currency), nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractCurrency(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		input        string
+		wantMessage  string
+		wantCurrency string
+	}{
+		{
+			name:         "no currency",
+			input:        "Lunch 12.50",
+			wantMessage:  "Lunch 12.50",
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "code after amount",
+			input:        "Taxi 250 SEK",
+			wantMessage:  "Taxi 250",
+			wantCurrency: "SEK",
+		},
+		{
+			name:         "code without space",
+			input:        "Taxi 250SEK",
+			wantMessage:  "Taxi 250",
+			wantCurrency: "SEK",
+		},
+		{
+			name:         "lowercase code is a word",
+			input:        "Coffee 3 try",
+			wantMessage:  "Coffee 3 try",
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "capitalized code is a word",
+			input:        "Taxi 250 Sek",
+			wantMessage:  "Taxi 250 Sek",
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "symbol after amount",
+			input:        "Coffee 12€",
+			wantMessage:  "Coffee 12",
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "symbol before amount",
+			input:        "Coffee $12",
+			wantMessage:  "Coffee 12",
+			wantCurrency: "USD",
+		},
+		{
+			name:         "code before amount",
+			input:        "Taxi SEK 250",
+			wantMessage:  "Taxi 250",
+			wantCurrency: "SEK",
+		},
+		{
+			name:         "bare amount with symbol",
+			input:        "$12",
+			wantMessage:  "12",
+			wantCurrency: "USD",
+		},
+		{
+			name:         "amount with symbol first",
+			input:        "$12 Coffee",
+			wantMessage:  "Coffee 12",
+			wantCurrency: "USD",
+		},
+		{
+			name:         "amount with code first",
+			input:        "250 SEK Taxi to airport",
+			wantMessage:  "Taxi to airport 250",
+			wantCurrency: "SEK",
+		},
+		{
+			name:         "calculation with currency",
+			input:        "Dinner (45+15)/2 £",
+			wantMessage:  "Dinner (45+15)/2",
+			wantCurrency: "GBP",
+		},
+		{
+			name:         "unknown code is left alone",
+			input:        "Bus 3 XYZ",
+			wantMessage:  "Bus 3 XYZ",
+			wantCurrency: "EUR",
+		},
+		{
+			name:         "word ending the description is not a currency",
+			input:        "Bag 2 for Tim",
+			wantMessage:  "Bag 2 for Tim",
+			wantCurrency: "EUR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message, currency := extractCurrency(tt.input)
+			if message != tt.wantMessage || currency != tt.wantCurrency {
+				t.Errorf("extractCurrency(%q) = %q, %q, want %q, %q", tt.input, message, currency, tt.wantMessage, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestStaticRatesRate(t *testing.T) {
+	t.Parallel()
+
+	rates := NewStaticRates("EUR", map[string]*big.Rat{
+		"SEK": big.NewRat(87, 1000),
+		"USD": big.NewRat(92, 100),
+	})
+	date := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to string
+		want     *big.Rat
+		wantErr  bool
+	}{
+		{name: "into base", from: "SEK", to: "EUR", want: big.NewRat(87, 1000)},
+		{name: "out of base", from: "EUR", to: "USD", want: big.NewRat(100, 92)},
+		{name: "through base", from: "SEK", to: "USD", want: big.NewRat(87, 920)},
+		{name: "same currency", from: "EUR", to: "EUR", want: big.NewRat(1, 1)},
+		{name: "unknown currency", from: "JPY", to: "EUR", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := rates.Rate(context.Background(), tt.from, tt.to, date)
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoRate) {
+					t.Errorf("Rate() error = %v, want ErrNoRate", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rate() unexpected error: %v", err)
+			}
+			if got.Cmp(tt.want) != 0 {
+				t.Errorf("Rate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadStaticRates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		contents string
+		wantRate *big.Rat
+		wantErr  bool
+	}{
+		{
+			name:     "string and number rates",
+			contents: `{"base": "eur", "rates": {"sek": "0.087", "USD": 0.92}}`,
+			wantRate: big.NewRat(87, 1000),
+		},
+		{
+			name:     "base defaults to euros",
+			contents: `{"rates": {"SEK": 0.087}}`,
+			wantRate: big.NewRat(87, 1000),
+		},
+		{
+			name:     "negative rate",
+			contents: `{"rates": {"SEK": -1}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "invalid json",
+			contents: `{"rates":`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "rates.json")
+			if err := os.WriteFile(path, []byte(tt.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			rates, err := LoadStaticRates(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadStaticRates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got, err := rates.Rate(context.Background(), "SEK", "EUR", time.Time{})
+			if err != nil {
+				t.Fatalf("Rate() unexpected error: %v", err)
+			}
+			if got.Cmp(tt.wantRate) != 0 {
+				t.Errorf("Rate() = %v, want %v", got, tt.wantRate)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		t.Parallel()
+
+		if _, err := LoadStaticRates(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+			t.Error("LoadStaticRates() expected error for a missing file")
+		}
+	})
+
+	t.Run("no file only knows euros", func(t *testing.T) {
+		t.Parallel()
+
+		rates, err := LoadStaticRates("")
+		if err != nil {
+			t.Fatalf("LoadStaticRates() unexpected error: %v", err)
+		}
+		if _, err := rates.Rate(context.Background(), "SEK", "EUR", time.Time{}); !errors.Is(err, ErrNoRate) {
+			t.Errorf("Rate() error = %v, want ErrNoRate", err)
+		}
+	})
+}
+
+func TestConvertMoney(t *testing.T) {
+	t.Parallel()
+
+	rates := NewStaticRates("EUR", map[string]*big.Rat{"SEK": big.NewRat(87, 1000)})
+
+	tests := []struct {
+		name    string
+		amount  Money
+		want    Money
+		wantErr bool
+	}{
+		{name: "converts and rounds to cents", amount: Money{Cents: 25050, Currency: "SEK"}, want: Cents(2179)},
+		{name: "already in target currency", amount: Cents(1250), want: Cents(1250)},
+		{name: "zero amount", amount: Money{}, want: Money{Currency: "EUR"}},
+		{name: "unknown currency", amount: Money{Cents: 100, Currency: "JPY"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := convertMoney(context.Background(), rates, tt.amount, "EUR", time.Time{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertMoney() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("convertMoney() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOriginalCell(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value  string
+		want   Money
+		wantOK bool
+	}{
+		{value: originalCellValue(Money{Cents: 25000, Currency: "SEK"}), want: Money{Cents: 25000, Currency: "SEK"}, wantOK: true},
+		{value: "12.5 USD", want: Money{Cents: 1250, Currency: "USD"}, wantOK: true},
+		{value: "12.50"},
+		{value: "abc SEK"},
+		{value: "12.50 XYZ"},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseOriginalCell(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseOriginalCell(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -5,40 +5,215 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var expensePattern = regexp.MustCompile(`^(.+?)\s+([\d,.]+)$`)
+var (
+	expensePattern      = regexp.MustCompile(`^(.+?)\s+([\d,.+\-*/()]+(?:\s*[+\-*/]\s*[\d,.+\-*/()]+)*)$`)
+	funPrefixPattern    = regexp.MustCompile(`(?i)^fun\s+`)
+	funTagPattern       = regexp.MustCompile(`(?i)(^|\s)#fun\b`)
+	datePattern         = regexp.MustCompile(`\s+(\d{1,2})\.(\d{1,2})\.(\d{4})?$`)
+	relativeDatePattern = regexp.MustCompile(`(?i)(^(today|yesterday)\s+|\s+(today|yesterday)$)`)
+)
+
+type Category int
+
+const (
+	CategoryFundamentals Category = iota
+	CategoryFun
+)
+
+func (c Category) String() string {
+	switch c {
+	case CategoryFun:
+		return "Fun"
+	default:
+		return "Fundamentals"
+	}
+}
+
+// Parses a category name such as "fun", ignoring case
+func parseCategory(name string) (Category, bool) {
+	for _, category := range []Category{CategoryFundamentals, CategoryFun} {
+		if strings.EqualFold(name, category.String()) {
+			return category, true
+		}
+	}
+	return CategoryFundamentals, false
+}
 
 type Expense struct {
-	Desc   string
-	Amount float64
+	Desc       string
+	Amount     Money
+	Original   Money  // Amount as paid in another currency before conversion, zero if paid in euros
+	Expression string // Arithmetic the amount was typed as, e.g. "45/2", empty for a plain number
+	Category   Category
+	Date       time.Time // Day the money was spent, zero if the message did not say
+	Receipt    string    // Link to the stored receipt photo, empty if there is none
+	UserID     int64     // Telegram user who sent the expense, set by the handler
+	UpdateID   int64     // Telegram update that carried the expense, set by the handler
 }
 
 // ParseExpense parses an expense from a message in the format "<Desc> <Amount>"
-// Example message: "Lunch 2.95"
-func ParseExpense(message string) (*Expense, error) {
+// A "fun" prefix or a "#fun" tag anywhere in the message files it under Fun
+// An optional "D.M." or "D.M.YYYY" suffix, or a "today"/"yesterday" prefix or suffix, back-dates it
+// Relative dates and dates without a year are resolved against now
+// Example message: "Lunch 2.95", "fun Movies 12", "Movies 12 #fun", "Lunch 2.95 12.3." or "yesterday Taxi 14"
+// The amount may be a calculation such as "Dinner 45/2" or "Groceries 12.40+3.99"
+// A currency code or symbol next to the amount, as in "Taxi 250 SEK" or "$12 Coffee", sets its currency
+// The locale decides whether ambiguous amounts like "1,200" use a thousands separator
+func ParseExpense(message string, now time.Time, locale AmountLocale) (*Expense, error) {
 	message = strings.TrimSpace(message)
 	if message == "" {
 		return nil, fmt.Errorf("empty message")
 	}
 
+	message, date, err := extractDate(message, now)
+	if err != nil {
+		return nil, err
+	}
+
+	message, category := extractCategory(message)
+
+	if date.IsZero() {
+		// The date may have been hidden behind a "fun" prefix
+		message, date, err = extractDate(message, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	message, currency := extractCurrency(message)
+
+	desc, amountText, ok := splitAmount(message)
+	if !ok {
+		return nil, fmt.Errorf("invalid expense format")
+	}
+
+	amount, err := parseAmount(amountText, locale)
+	if err != nil {
+		return nil, err
+	}
+	amount.Currency = currency
+
+	expense := &Expense{
+		Desc:     desc,
+		Amount:   amount,
+		Category: category,
+		Date:     date,
+	}
+	if isAmountExpression(amountText) {
+		expense.Expression = amountText
+	}
+	return expense, nil
+}
+
+// Splits a message into the description and the amount at its end
+// Spaces around operators belong to the amount, so "Dinner 45 / 2" is read as "Dinner" and "45/2"
+func splitAmount(message string) (string, string, bool) {
 	matches := expensePattern.FindStringSubmatch(message)
 	if matches == nil {
-		return nil, fmt.Errorf("invalid expense format")
+		return "", "", false
 	}
+	return strings.TrimSpace(matches[1]), strings.Join(strings.Fields(matches[2]), ""), true
+}
 
-	amountStr := strings.ReplaceAll(matches[2], ",", ".")
-	amount, err := strconv.ParseFloat(amountStr, 64)
+// Parses a positive amount such as "2.95", "2,95", "1.299,90" or "45/2"
+func parseAmount(value string, locale AmountLocale) (Money, error) {
+	value = strings.TrimSpace(value)
+
+	var amount Money
+	var err error
+	if isAmountExpression(value) {
+		amount, err = evaluateAmount(value, locale)
+	} else {
+		amount, err = parseUserAmount(value, locale)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("parse amount: %w", err)
+		return Money{}, fmt.Errorf("parse amount: %w", err)
+	}
+
+	if amount.Cents <= 0 {
+		return Money{}, fmt.Errorf("amount must be positive")
+	}
+
+	return amount, nil
+}
+
+// ParseExpenses parses a message with one expense per line, e.g. "Milk 1.20\nBread 2.50"
+// Returns the parsed expenses and the non-empty lines that could not be parsed
+func ParseExpenses(message string, now time.Time, locale AmountLocale) ([]*Expense, []string) {
+	var expenses []*Expense
+	var failed []string
+
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		expense, err := ParseExpense(line, now, locale)
+		if err != nil {
+			failed = append(failed, line)
+			continue
+		}
+		expenses = append(expenses, expense)
+	}
+
+	return expenses, failed
+}
+
+// Strips a date from the start or end of the message and returns it, or a zero time if there is none
+func extractDate(message string, now time.Time) (string, time.Time, error) {
+	if matches := datePattern.FindStringSubmatch(message); matches != nil {
+		day, _ := strconv.Atoi(matches[1])
+		month, _ := strconv.Atoi(matches[2])
+
+		year := now.Year()
+		if matches[3] != "" {
+			year, _ = strconv.Atoi(matches[3])
+		}
+
+		date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+		if date.Day() != day || int(date.Month()) != month {
+			return "", time.Time{}, fmt.Errorf("invalid date %s.%s.", matches[1], matches[2])
+		}
+
+		// Without a year, a date in the future refers to last year, e.g. "28.12." sent in January
+		if matches[3] == "" && date.After(now) {
+			date = date.AddDate(-1, 0, 0)
+		}
+		if date.After(now) {
+			return "", time.Time{}, fmt.Errorf("date %s.%s.%s is in the future", matches[1], matches[2], matches[3])
+		}
+
+		return strings.TrimSpace(datePattern.ReplaceAllString(message, "")), date, nil
 	}
 
-	if amount <= 0 {
-		return nil, fmt.Errorf("amount must be positive")
+	if matches := relativeDatePattern.FindStringSubmatch(message); matches != nil {
+		word := strings.ToLower(matches[2] + matches[3])
+		date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if word == "yesterday" {
+			date = date.AddDate(0, 0, -1)
+		}
+		return strings.TrimSpace(relativeDatePattern.ReplaceAllString(message, "")), date, nil
+	}
+
+	return message, time.Time{}, nil
+}
+
+// Strips the category marker from the message and returns the matching category
+func extractCategory(message string) (string, Category) {
+	category := CategoryFundamentals
+
+	if funPrefixPattern.MatchString(message) {
+		message = funPrefixPattern.ReplaceAllString(message, "")
+		category = CategoryFun
+	}
+	if funTagPattern.MatchString(message) {
+		message = funTagPattern.ReplaceAllString(message, " ")
+		category = CategoryFun
 	}
 
-	return &Expense{
-		Desc:   strings.TrimSpace(matches[1]),
-		Amount: amount,
-	}, nil
+	return strings.TrimSpace(message), category
 }
@@ -1,48 +1,259 @@
 package main
 
 import (
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestParseExpense(t *testing.T) {
 	t.Parallel()
 
+	now := time.Date(2026, time.March, 15, 18, 30, 0, 0, time.UTC)
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+
 	tests := []struct {
 		name       string
 		input      string
+		locale     AmountLocale
 		wantDesc   string
-		wantAmount float64
+		wantAmount Money
+		wantExpr   string
+		wantCat    Category
+		wantDate   time.Time
 		wantErr    bool
 	}{
 		{
 			name:       "simple expense",
 			input:      "Lunch 2.95",
 			wantDesc:   "Lunch",
-			wantAmount: 2.95,
+			wantAmount: Cents(295),
 		},
 		{
 			name:       "expense with multiple words",
 			input:      "Gym membership 31.99",
 			wantDesc:   "Gym membership",
-			wantAmount: 31.99,
+			wantAmount: Cents(3199),
 		},
 		{
 			name:       "expense with comma decimal",
 			input:      "Groceries 15,50",
 			wantDesc:   "Groceries",
-			wantAmount: 15.5,
+			wantAmount: Cents(1550),
 		},
 		{
 			name:       "expense with whole number",
 			input:      "Movie ticket 12",
 			wantDesc:   "Movie ticket",
-			wantAmount: 12.0,
+			wantAmount: Cents(1200),
 		},
 		{
 			name:       "expense with extra whitespace",
 			input:      "  Lunch   2.95  ",
 			wantDesc:   "Lunch",
-			wantAmount: 2.95,
+			wantAmount: Cents(295),
+		},
+		{
+			name:       "fun prefix",
+			input:      "fun Movies 12",
+			wantDesc:   "Movies",
+			wantAmount: Cents(1200),
+			wantCat:    CategoryFun,
+		},
+		{
+			name:       "fun prefix is case insensitive",
+			input:      "Fun Concert tickets 45,00",
+			wantDesc:   "Concert tickets",
+			wantAmount: Cents(4500),
+			wantCat:    CategoryFun,
+		},
+		{
+			name:       "fun tag at end",
+			input:      "Movies 12 #fun",
+			wantDesc:   "Movies",
+			wantAmount: Cents(1200),
+			wantCat:    CategoryFun,
+		},
+		{
+			name:       "fun tag in middle",
+			input:      "Movies #fun 12",
+			wantDesc:   "Movies",
+			wantAmount: Cents(1200),
+			wantCat:    CategoryFun,
+		},
+		{
+			name:       "word starting with fun is not a marker",
+			input:      "Funeral flowers 30",
+			wantDesc:   "Funeral flowers",
+			wantAmount: Cents(3000),
+			wantCat:    CategoryFundamentals,
+		},
+		{
+			name:       "tag prefix of longer word is not a marker",
+			input:      "Tickets #funfair 8",
+			wantDesc:   "Tickets #funfair",
+			wantAmount: Cents(800),
+			wantCat:    CategoryFundamentals,
+		},
+		{
+			name:       "english thousands separator",
+			input:      "Rent 1,200.00",
+			wantDesc:   "Rent",
+			wantAmount: Cents(120000),
+		},
+		{
+			name:       "european thousands separator",
+			input:      "Laptop 1.299,90",
+			wantDesc:   "Laptop",
+			wantAmount: Cents(129990),
+		},
+		{
+			name:       "ambiguous amount in european locale",
+			input:      "Rent 1.200",
+			wantDesc:   "Rent",
+			wantAmount: Cents(120000),
+		},
+		{
+			name:       "ambiguous amount in english locale",
+			input:      "Rent 1,200",
+			locale:     LocaleEnglish,
+			wantDesc:   "Rent",
+			wantAmount: Cents(120000),
+		},
+		{
+			name:    "more than two decimals",
+			input:   "Rent 1,200",
+			wantErr: true,
+		},
+		{
+			name:       "split bill",
+			input:      "Dinner 45/2",
+			wantDesc:   "Dinner",
+			wantAmount: Cents(2250),
+			wantExpr:   "45/2",
+		},
+		{
+			name:       "split bill with spaces",
+			input:      "Dinner 45 / 2",
+			wantDesc:   "Dinner",
+			wantAmount: Cents(2250),
+			wantExpr:   "45/2",
+		},
+		{
+			name:       "sum with spaces",
+			input:      "Groceries 12.40 + 3.99",
+			wantDesc:   "Groceries",
+			wantAmount: Cents(1639),
+			wantExpr:   "12.40+3.99",
+		},
+		{
+			name:    "trailing operator",
+			input:   "Dinner 45 /",
+			wantErr: true,
+		},
+		{
+			name:       "sum with comma decimals and fun tag",
+			input:      "Groceries 12,40+3,99 #fun",
+			wantDesc:   "Groceries",
+			wantAmount: Cents(1639),
+			wantExpr:   "12,40+3,99",
+			wantCat:    CategoryFun,
+		},
+		{
+			name:       "calculation with date",
+			input:      "Taxi (30+12)/3 12.3.",
+			wantDesc:   "Taxi",
+			wantAmount: Cents(1400),
+			wantExpr:   "(30+12)/3",
+			wantDate:   day(2026, time.March, 12),
+		},
+		{
+			name:    "calculation below zero",
+			input:   "Lunch 5-8",
+			wantErr: true,
+		},
+		{
+			name:    "division by zero",
+			input:   "Lunch 5/0",
+			wantErr: true,
+		},
+		{
+			name:    "fun prefix without description",
+			input:   "fun 12",
+			wantErr: true,
+		},
+		{
+			name:       "date suffix without year",
+			input:      "Lunch 2.95 12.3.",
+			wantDesc:   "Lunch",
+			wantAmount: Cents(295),
+			wantDate:   day(2026, time.March, 12),
+		},
+		{
+			name:       "date suffix with year",
+			input:      "Lunch 2.95 28.2.2025",
+			wantDesc:   "Lunch",
+			wantAmount: Cents(295),
+			wantDate:   day(2025, time.February, 28),
+		},
+		{
+			name:       "future date without year means last year",
+			input:      "Gifts 40 24.12.",
+			wantDesc:   "Gifts",
+			wantAmount: Cents(4000),
+			wantDate:   day(2025, time.December, 24),
+		},
+		{
+			name:    "mistyped future year",
+			input:   "Lunch 2.95 1.4.2062",
+			wantErr: true,
+		},
+		{
+			name:    "tomorrow with year",
+			input:   "Lunch 2.95 16.3.2026",
+			wantErr: true,
+		},
+		{
+			name:       "yesterday prefix",
+			input:      "yesterday Taxi 14",
+			wantDesc:   "Taxi",
+			wantAmount: Cents(1400),
+			wantDate:   day(2026, time.March, 14),
+		},
+		{
+			name:       "today suffix",
+			input:      "Taxi 14 Today",
+			wantDesc:   "Taxi",
+			wantAmount: Cents(1400),
+			wantDate:   day(2026, time.March, 15),
+		},
+		{
+			name:       "date with fun prefix",
+			input:      "fun yesterday Movies 12",
+			wantDesc:   "Movies",
+			wantAmount: Cents(1200),
+			wantCat:    CategoryFun,
+			wantDate:   day(2026, time.March, 14),
+		},
+		{
+			name:       "date with fun tag",
+			input:      "Movies 12 #fun 1.3.",
+			wantDesc:   "Movies",
+			wantAmount: Cents(1200),
+			wantCat:    CategoryFun,
+			wantDate:   day(2026, time.March, 1),
+		},
+		{
+			name:    "invalid date",
+			input:   "Lunch 2.95 31.2.",
+			wantErr: true,
+		},
+		{
+			name:    "date without amount",
+			input:   "Lunch 12.3.",
+			wantErr: true,
 		},
 		{
 			name:    "empty string",
@@ -84,13 +295,46 @@ func TestParseExpense(t *testing.T) {
 			input:   "Lunch 1.2.3",
 			wantErr: true,
 		},
+		{
+			name:       "currency code after the amount",
+			input:      "Taxi 250 SEK",
+			wantDesc:   "Taxi",
+			wantAmount: Money{Cents: 25000, Currency: "SEK"},
+		},
+		{
+			name:       "currency symbol before an amount that comes first",
+			input:      "$12 Coffee",
+			wantDesc:   "Coffee",
+			wantAmount: Money{Cents: 1200, Currency: "USD"},
+		},
+		{
+			name:       "currency code with category and date",
+			input:      "fun Museum 15,50 USD 12.3.",
+			wantDesc:   "Museum",
+			wantAmount: Money{Cents: 1550, Currency: "USD"},
+			wantCat:    CategoryFun,
+			wantDate:   day(2026, time.March, 12),
+		},
+		{
+			name:       "currency with a calculation",
+			input:      "Dinner 45/2 $",
+			wantDesc:   "Dinner",
+			wantAmount: Money{Cents: 2250, Currency: "USD"},
+			wantExpr:   "45/2",
+		},
+		{
+			name:       "unknown code stays in the description",
+			input:      "Bus XYZ 3",
+			wantDesc:   "Bus XYZ",
+			wantAmount: Cents(300),
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			result, err := ParseExpense(tt.input)
+			result, err := ParseExpense(tt.input, now, tt.locale)
 
 			if tt.wantErr {
 				if err == nil {
@@ -117,6 +361,74 @@ func TestParseExpense(t *testing.T) {
 			if result.Amount != tt.wantAmount {
 				t.Errorf("ParseExpense().Amount = %v, want %v", result.Amount, tt.wantAmount)
 			}
+			if result.Expression != tt.wantExpr {
+				t.Errorf("ParseExpense().Expression = %v, want %v", result.Expression, tt.wantExpr)
+			}
+			if result.Category != tt.wantCat {
+				t.Errorf("ParseExpense().Category = %v, want %v", result.Category, tt.wantCat)
+			}
+			if !result.Date.Equal(tt.wantDate) {
+				t.Errorf("ParseExpense().Date = %v, want %v", result.Date, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestParseExpenses(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		input      string
+		wantDescs  []string
+		wantFailed []string
+	}{
+		{
+			name:      "single line",
+			input:     "Lunch 2.95",
+			wantDescs: []string{"Lunch"},
+		},
+		{
+			name:      "receipt",
+			input:     "Milk 1.20\nBread 2.50\nfun Cheese 4.10",
+			wantDescs: []string{"Milk", "Bread", "Cheese"},
+		},
+		{
+			name:      "blank lines and padding are skipped",
+			input:     "\n  Milk 1.20  \n\n\nBread 2.50\n",
+			wantDescs: []string{"Milk", "Bread"},
+		},
+		{
+			name:       "invalid lines are reported",
+			input:      "Milk 1.20\nsomething\nBread 2.50\n12",
+			wantDescs:  []string{"Milk", "Bread"},
+			wantFailed: []string{"something", "12"},
+		},
+		{
+			name:       "nothing valid",
+			input:      "hello\nworld",
+			wantFailed: []string{"hello", "world"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expenses, failed := ParseExpenses(tt.input, now, LocaleEuropean)
+
+			var descs []string
+			for _, expense := range expenses {
+				descs = append(descs, expense.Desc)
+			}
+			if !reflect.DeepEqual(descs, tt.wantDescs) {
+				t.Errorf("ParseExpenses() descs = %v, want %v", descs, tt.wantDescs)
+			}
+			if !reflect.DeepEqual(failed, tt.wantFailed) {
+				t.Errorf("ParseExpenses() failed = %v, want %v", failed, tt.wantFailed)
+			}
 		})
 	}
 }
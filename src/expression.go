@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Longest amount expression that is evaluated, which also bounds the nesting of parentheses
+const maxExpressionLength = 64
+
+// Reports whether an amount is an arithmetic expression such as "45/2" rather than a plain number
+func isAmountExpression(value string) bool {
+	return strings.ContainsAny(value, "+-*/()")
+}
+
+// Evaluates an amount such as "45/2", "12.40+3.99" or "(12+8)*3" with + - * / and parentheses
+// Numbers are read like plain amounts, the arithmetic is exact and the result is rounded to cents
+func evaluateAmount(value string, locale AmountLocale) (Money, error) {
+	if len(value) > maxExpressionLength {
+		return Money{}, fmt.Errorf("amount expression is longer than %d characters", maxExpressionLength)
+	}
+
+	p := &expressionParser{input: value, locale: locale}
+	result, err := p.parseSum()
+	if err != nil {
+		return Money{}, err
+	}
+	if p.pos < len(p.input) {
+		return Money{}, fmt.Errorf("unexpected %q in amount %q", p.input[p.pos], value)
+	}
+	if !moneyFits(result) {
+		return Money{}, fmt.Errorf("amount %q is too large", value)
+	}
+	return moneyFromRat(result, defaultCurrency), nil
+}
+
+// Recursive descent parser over the grammar
+//
+//	sum     = product { ("+" | "-") product }
+//	product = factor { ("*" | "/") factor }
+//	factor  = ("+" | "-") factor | "(" sum ")" | number
+type expressionParser struct {
+	input  string
+	pos    int
+	locale AmountLocale
+}
+
+func (p *expressionParser) parseSum() (*big.Rat, error) {
+	result, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.pos < len(p.input) {
+		op := p.input[p.pos]
+		if op != '+' && op != '-' {
+			break
+		}
+		p.pos++
+
+		operand, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			result.Add(result, operand)
+		} else {
+			result.Sub(result, operand)
+		}
+	}
+	return result, nil
+}
+
+func (p *expressionParser) parseProduct() (*big.Rat, error) {
+	result, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.pos < len(p.input) {
+		op := p.input[p.pos]
+		if op != '*' && op != '/' {
+			break
+		}
+		p.pos++
+
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		if op == '*' {
+			result.Mul(result, operand)
+			continue
+		}
+		if operand.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero in amount %q", p.input)
+		}
+		result.Quo(result, operand)
+	}
+	return result, nil
+}
+
+func (p *expressionParser) parseFactor() (*big.Rat, error) {
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("amount %q ends unexpectedly", p.input)
+	}
+
+	switch p.input[p.pos] {
+	case '+', '-':
+		negative := p.input[p.pos] == '-'
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		if negative {
+			operand.Neg(operand)
+		}
+		return operand, nil
+	case '(':
+		p.pos++
+		result, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing closing parenthesis in amount %q", p.input)
+		}
+		p.pos++
+		return result, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte("0123456789.,", p.input[p.pos]) >= 0 {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, fmt.Errorf("unexpected %q in amount %q", p.input[p.pos], p.input)
+	}
+
+	digits, err := normalizeUserAmount(p.input[start:p.pos], p.locale)
+	if err != nil {
+		return nil, err
+	}
+	number, ok := new(big.Rat).SetString(digits)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q in amount %q", digits, p.input)
+	}
+	return number, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateAmount(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value   string
+		locale  AmountLocale
+		want    Money
+		wantErr bool
+	}{
+		{value: "45/2", want: Cents(2250)},
+		{value: "12.40+3.99", want: Cents(1639)},
+		{value: "12,40+3,99", want: Cents(1639)},
+		{value: "0.1+0.2", want: Cents(30)},
+		{value: "10-2.5", want: Cents(750)},
+		{value: "3*4.20", want: Cents(1260)},
+		{value: "2+3*4", want: Cents(1400)},
+		{value: "(2+3)*4", want: Cents(2000)},
+		{value: "100/3", want: Cents(3333)},
+		{value: "200/3", want: Cents(6667)},
+		{value: "10/4/2", want: Cents(125)},
+		{value: "10-4-2", want: Cents(400)},
+		{value: "-5+12", want: Cents(700)},
+		{value: "((1+2))*3", want: Cents(900)},
+		{value: "1.200+50", want: Cents(125000)},
+		{value: "1,200+50", locale: LocaleEnglish, want: Cents(125000)},
+		{value: "1.299,90/2", want: Cents(64995)},
+		{value: "5/0", wantErr: true},
+		{value: "5/(2-2)", wantErr: true},
+		{value: "(1+2", wantErr: true},
+		{value: "1+2)", wantErr: true},
+		{value: "1+", wantErr: true},
+		{value: "*2", wantErr: true},
+		{value: "()", wantErr: true},
+		{value: "2.555+1", locale: LocaleEnglish, wantErr: true},
+		{value: "1.2.3+1", wantErr: true},
+		{value: strings.Repeat("1+", 40) + "1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := evaluateAmount(tt.value, tt.locale)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateAmount(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateAmount(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
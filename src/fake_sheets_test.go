@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/sheets/v4"
+)
+
+func newFakeSheetsService(t *testing.T, server *httptest.Server) *SheetsService {
+	t.Helper()
+
+	service, err := sheets.NewService(context.Background(),
+		option.WithEndpoint(server.URL+"/"),
+		option.WithHTTPClient(server.Client()),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("create sheets service: %v", err)
+	}
+
+	return &SheetsService{
+		service:       service,
+		spreadsheetID: "test",
+		titleFormat:   "January 2006",
+		location:      time.UTC,
+		claimBackoff:  20 * time.Millisecond,
+		logger:        discardLogger(),
+	}
+}
+
+var cellPattern = regexp.MustCompile(`^([A-Z]+)(\d*)(?::([A-Z]+)(\d*))?$`)
+
+// Rows returned when a whole column is read
+const fakeColumnRows = 1000
+
+// A worksheet added to the fake spreadsheet through the API
+type fakeWorksheet struct {
+	id    int64
+	title string
+	cells map[string]any
+}
+
+// In-memory Sheets API serving a worksheet with one existing expense in row 3
+// More worksheets can be added by duplicating it
+type fakeSheets struct {
+	mu         sync.Mutex
+	title      string
+	cells      map[string]any   // Cells of the worksheet titled title, which has sheet ID 0
+	worksheets []*fakeWorksheet // Tab order, the worksheet titled title has nil cells
+	metadata   []*sheets.DeveloperMetadata
+	nextID     int64
+
+	// Called after a values:batchGet snapshot is taken and before it is returned
+	afterBatchGet func()
+	// Called before a request is served, failing it with the returned error
+	intercept func(r *http.Request) error
+}
+
+func newFakeSheets(title string) *fakeSheets {
+	return &fakeSheets{
+		title:      title,
+		worksheets: []*fakeWorksheet{{title: title}},
+		cells: map[string]any{
+			"A1": "Total Net income",
+			"A2": "Fundamentals",
+			"C2": "Fun",
+			"A3": "Rent",
+			"B3": 900.0,
+			"C3": "Concert",
+			"D3": 40.0,
+		},
+		nextID: 1,
+	}
+}
+
+func (f *fakeSheets) cell(name string) any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cells[name]
+}
+
+// Checks that rows from firstRow on hold want expenses, each tagged with exactly one record
+func (f *fakeSheets) assertExpenses(t *testing.T, category Category, firstRow, want int) {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	descCol, _ := categoryColumns(category)
+	for row := firstRow; row < firstRow+want; row++ {
+		if f.cells[fmt.Sprintf("%s%d", descCol, row)] == nil {
+			t.Errorf("%s%d is empty, want an expense", descCol, row)
+		}
+	}
+	if extra := f.cells[fmt.Sprintf("%s%d", descCol, firstRow+want)]; extra != nil {
+		t.Errorf("%s%d = %v, want empty", descCol, firstRow+want, extra)
+	}
+
+	tagged := make(map[int]int)
+	for _, metadata := range f.metadata {
+		if metadata.MetadataKey != expenseMetadataKey {
+			continue
+		}
+		var record expenseRecord
+		if err := json.Unmarshal([]byte(metadata.MetadataValue), &record); err != nil {
+			t.Fatalf("unmarshal record: %v", err)
+		}
+		if record.Category == category {
+			tagged[int(metadata.Location.DimensionRange.StartIndex)+1]++
+		}
+	}
+	for row := firstRow; row < firstRow+want; row++ {
+		if tagged[row] != 1 {
+			t.Errorf("row %d has %d %v records, want 1", row, tagged[row], category)
+		}
+	}
+	if len(tagged) != want {
+		t.Errorf("%d rows have %v records, want %d", len(tagged), category, want)
+	}
+}
+
+// Returns the cells of the worksheet a range such as "March 2026!A5:B5" is in, nil if there is no such worksheet
+// Ranges without a worksheet title are in the first worksheet
+func (f *fakeSheets) worksheetCells(rng string) map[string]any {
+	title, _, _ := strings.Cut(rng, "!")
+	if !strings.Contains(rng, "!") || title == f.title {
+		return f.cells
+	}
+	for _, worksheet := range f.worksheets {
+		if worksheet.title == title {
+			return worksheet.cells
+		}
+	}
+	return nil
+}
+
+// Returns the cells of a worksheet by title, for checking them in tests
+func (f *fakeSheets) worksheetCell(title, name string) any {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.worksheetCells(title + "!")[name]
+}
+
+// Returns the titles of the worksheets in tab order
+func (f *fakeSheets) worksheetTitles() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	titles := make([]string, len(f.worksheets))
+	for i, worksheet := range f.worksheets {
+		titles[i] = worksheet.title
+	}
+	return titles
+}
+
+func (f *fakeSheets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp any
+	var err error
+
+	if f.intercept != nil {
+		if err := f.intercept(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch path := r.URL.Path; {
+	case strings.HasSuffix(path, "/values:batchGet"):
+		resp = f.batchGet(r.URL.Query()["ranges"])
+		if f.afterBatchGet != nil {
+			f.afterBatchGet()
+		}
+	case strings.HasSuffix(path, "/values:batchUpdate"):
+		var req sheets.BatchUpdateValuesRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			resp = f.updateValues(&req)
+		}
+	case strings.HasSuffix(path, "/values:batchClear"):
+		var req sheets.BatchClearValuesRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			resp = f.clearValues(req.Ranges)
+		}
+	case r.Method == http.MethodPost && strings.HasSuffix(path, ":clear"):
+		var rng string
+		if rng, err = url.PathUnescape(path[strings.Index(path, "/values/")+len("/values/") : len(path)-len(":clear")]); err == nil {
+			resp = f.clearValues([]string{rng})
+		}
+	case r.Method == http.MethodGet && strings.Contains(path, "/values/"):
+		var rng string
+		if rng, err = url.PathUnescape(path[strings.Index(path, "/values/")+len("/values/"):]); err == nil {
+			resp = f.batchGet([]string{rng}).ValueRanges[0]
+		}
+	case r.Method == http.MethodPut && strings.Contains(path, "/values/"):
+		var req sheets.ValueRange
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			req.Range, err = url.PathUnescape(path[strings.Index(path, "/values/")+len("/values/"):])
+			resp = f.updateValues(&sheets.BatchUpdateValuesRequest{Data: []*sheets.ValueRange{&req}})
+		}
+	case strings.HasSuffix(path, "/developerMetadata:search"):
+		var req sheets.SearchDeveloperMetadataRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			resp = f.searchMetadata(req.DataFilters[0].DeveloperMetadataLookup)
+		}
+	case strings.HasSuffix(path, ":batchUpdate"):
+		var req sheets.BatchUpdateSpreadsheetRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+			resp = f.batchUpdate(&req)
+		}
+	case r.Method == http.MethodGet && !strings.Contains(path, "/values"):
+		resp = f.spreadsheet()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (f *fakeSheets) spreadsheet() *sheets.Spreadsheet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &sheets.Spreadsheet{}
+	for i, worksheet := range f.worksheets {
+		resp.Sheets = append(resp.Sheets, &sheets.Sheet{Properties: &sheets.SheetProperties{
+			SheetId: worksheet.id,
+			Title:   worksheet.title,
+			Index:   int64(i),
+		}})
+	}
+	return resp
+}
+
+func (f *fakeSheets) batchGet(ranges []string) *sheets.BatchGetValuesResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &sheets.BatchGetValuesResponse{}
+	for _, rng := range ranges {
+		cells := f.worksheetCells(rng)
+		col, row, lastCol, _ := parseRange(rng)
+
+		var values [][]any
+		if row > 0 {
+			// A single row such as "A5:B5"
+			var rowValues []any
+			for c := col[0]; c <= lastCol[0]; c++ {
+				if value, ok := cells[fmt.Sprintf("%c%d", c, row)]; ok {
+					rowValues = append(rowValues, value)
+				}
+			}
+			if len(rowValues) > 0 {
+				values = [][]any{rowValues}
+			}
+		} else {
+			// A whole column such as "A:A"
+			for row := 1; row <= fakeColumnRows; row++ {
+				if value, ok := cells[fmt.Sprintf("%s%d", col, row)]; ok {
+					for len(values) < row-1 {
+						values = append(values, []any{})
+					}
+					values = append(values, []any{value})
+				}
+			}
+		}
+		resp.ValueRanges = append(resp.ValueRanges, &sheets.ValueRange{Range: rng, Values: values})
+	}
+	return resp
+}
+
+func (f *fakeSheets) updateValues(req *sheets.BatchUpdateValuesRequest) *sheets.BatchUpdateValuesResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, data := range req.Data {
+		cells := f.worksheetCells(data.Range)
+		col, row, _, _ := parseRange(data.Range)
+		for i, value := range data.Values[0] {
+			cells[fmt.Sprintf("%c%d", col[0]+byte(i), row)] = value
+		}
+	}
+	return &sheets.BatchUpdateValuesResponse{}
+}
+
+func (f *fakeSheets) clearValues(ranges []string) *sheets.BatchClearValuesResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, rng := range ranges {
+		cells := f.worksheetCells(rng)
+		col, row, lastCol, lastRow := parseRange(rng)
+		if lastRow == 0 {
+			lastRow = fakeColumnRows
+		}
+		for r := max(row, 1); r <= lastRow; r++ {
+			for c := col[0]; c <= lastCol[0]; c++ {
+				delete(cells, fmt.Sprintf("%c%d", c, r))
+			}
+		}
+	}
+	return &sheets.BatchClearValuesResponse{}
+}
+
+// Finds the records with the key of the lookup, on the rows of its sheet if it has a location
+func (f *fakeSheets) searchMetadata(lookup *sheets.DeveloperMetadataLookup) *sheets.SearchDeveloperMetadataResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &sheets.SearchDeveloperMetadataResponse{}
+	for _, metadata := range f.metadata {
+		if metadata.MetadataKey != lookup.MetadataKey {
+			continue
+		}
+		if location := lookup.MetadataLocation; location != nil && metadata.Location.DimensionRange.SheetId != location.SheetId {
+			continue
+		}
+		resp.MatchedDeveloperMetadata = append(resp.MatchedDeveloperMetadata, &sheets.MatchedDeveloperMetadata{
+			DeveloperMetadata: metadata,
+		})
+	}
+	return resp
+}
+
+func (f *fakeSheets) batchUpdate(req *sheets.BatchUpdateSpreadsheetRequest) *sheets.BatchUpdateSpreadsheetResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &sheets.BatchUpdateSpreadsheetResponse{}
+	for _, r := range req.Requests {
+		reply := &sheets.Response{}
+		switch {
+		case r.CreateDeveloperMetadata != nil:
+			metadata := r.CreateDeveloperMetadata.DeveloperMetadata
+			metadata.MetadataId = f.nextID
+			f.nextID++
+			f.metadata = append(f.metadata, metadata)
+			reply.CreateDeveloperMetadata = &sheets.CreateDeveloperMetadataResponse{DeveloperMetadata: metadata}
+		case r.UpdateDeveloperMetadata != nil:
+			id := r.UpdateDeveloperMetadata.DataFilters[0].DeveloperMetadataLookup.MetadataId
+			for _, metadata := range f.metadata {
+				if metadata.MetadataId == id {
+					metadata.MetadataValue = r.UpdateDeveloperMetadata.DeveloperMetadata.MetadataValue
+				}
+			}
+		case r.DeleteDeveloperMetadata != nil:
+			id := r.DeleteDeveloperMetadata.DataFilter.DeveloperMetadataLookup.MetadataId
+			for i, metadata := range f.metadata {
+				if metadata.MetadataId == id {
+					f.metadata = append(f.metadata[:i], f.metadata[i+1:]...)
+					break
+				}
+			}
+		case r.DuplicateSheet != nil:
+			reply.DuplicateSheet = &sheets.DuplicateSheetResponse{Properties: f.duplicateSheet(r.DuplicateSheet)}
+		case r.DeleteSheet != nil:
+			f.deleteSheet(r.DeleteSheet.SheetId)
+		}
+		resp.Replies = append(resp.Replies, reply)
+	}
+	return resp
+}
+
+// Copies a worksheet with its cells and the developer metadata on its rows, like the Sheets API does
+func (f *fakeSheets) duplicateSheet(req *sheets.DuplicateSheetRequest) *sheets.SheetProperties {
+	source := f.worksheets[0]
+	for _, worksheet := range f.worksheets {
+		if worksheet.id == req.SourceSheetId {
+			source = worksheet
+		}
+	}
+
+	copied := &fakeWorksheet{id: f.nextID, title: req.NewSheetName, cells: make(map[string]any)}
+	f.nextID++
+	for name, value := range f.worksheetCells(source.title + "!") {
+		copied.cells[name] = value
+	}
+
+	index := min(int(req.InsertSheetIndex), len(f.worksheets))
+	f.worksheets = append(f.worksheets[:index], append([]*fakeWorksheet{copied}, f.worksheets[index:]...)...)
+
+	for _, metadata := range f.metadata {
+		if metadata.Location.DimensionRange.SheetId != source.id {
+			continue
+		}
+		location := *metadata.Location.DimensionRange
+		location.SheetId = copied.id
+		f.metadata = append(f.metadata, &sheets.DeveloperMetadata{
+			MetadataId:    f.nextID,
+			MetadataKey:   metadata.MetadataKey,
+			MetadataValue: metadata.MetadataValue,
+			Visibility:    metadata.Visibility,
+			Location:      &sheets.DeveloperMetadataLocation{DimensionRange: &location},
+		})
+		f.nextID++
+	}
+
+	return &sheets.SheetProperties{SheetId: copied.id, Title: copied.title, Index: int64(index)}
+}
+
+// Removes a worksheet and the developer metadata on its rows
+func (f *fakeSheets) deleteSheet(sheetID int64) {
+	for i, worksheet := range f.worksheets {
+		if worksheet.id == sheetID {
+			f.worksheets = append(f.worksheets[:i], f.worksheets[i+1:]...)
+			break
+		}
+	}
+
+	kept := f.metadata[:0]
+	for _, metadata := range f.metadata {
+		if metadata.Location.DimensionRange.SheetId != sheetID {
+			kept = append(kept, metadata)
+		}
+	}
+	f.metadata = kept
+}
+
+// Parses an A1 range such as "March 2026!A5:B5", "March 2026!C:C" or "March 2026!A4:D" into its first cell
+// and last cell
+// The row is 0 for whole columns, and the last row is 0 for ranges that go to the end of the worksheet
+func parseRange(rng string) (string, int, string, int) {
+	if i := strings.LastIndex(rng, "!"); i >= 0 {
+		rng = rng[i+1:]
+	}
+	match := cellPattern.FindStringSubmatch(rng)
+	if match == nil {
+		return "", 0, "", 0
+	}
+	row, _ := strconv.Atoi(match[2])
+	if match[3] == "" {
+		return match[1], row, match[1], row
+	}
+	lastRow, _ := strconv.Atoi(match[4])
+	return match[1], row, match[3], lastRow
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -12,17 +14,51 @@ import (
 
 type Sender interface {
 	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+	AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) (bool, error)
+	EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error)
 }
 
+// Callback data of the buttons under an expense confirmation
+const (
+	callbackUndo   = "undo"
+	callbackMove   = "move:" // Followed by the lowercase name of the target category
+	callbackAmount = "amount"
+)
+
+// Callback data of the buttons under an expense suggested from a receipt photo
+const (
+	callbackConfirmReceipt = "receipt:confirm"
+	callbackEditReceipt    = "receipt:edit"
+)
+
+// Alert for a button under a message that lists several expenses, where it can't tell which one is meant
+const severalExpensesAlert = "That message lists several expenses. Reply to it with the description of the one to change, e.g. Milk 1.40"
+
+// Line prefixes of a receipt suggestion, which carries everything needed to add the expense later
+const (
+	suggestionPrefix = "🧾 From the receipt: "
+	receiptPrefix    = "📎 "
+)
+
 type BotHandlers struct {
-	sheets Spreadsheet
-	logger *slog.Logger
+	sheets      Spreadsheet
+	rates       RateProvider
+	attachments Attachments
+	location    *time.Location
+	locale      AmountLocale
+	logger      *slog.Logger
+	now         func() time.Time
 }
 
-func NewBotHandlers(sheets Spreadsheet, logger *slog.Logger) *BotHandlers {
+func NewBotHandlers(sheets Spreadsheet, rates RateProvider, attachments Attachments, location *time.Location, locale AmountLocale, logger *slog.Logger) *BotHandlers {
 	return &BotHandlers{
-		sheets: sheets,
-		logger: logger,
+		sheets:      sheets,
+		rates:       rates,
+		attachments: attachments,
+		location:    location,
+		locale:      locale,
+		logger:      logger,
+		now:         time.Now,
 	}
 }
 
@@ -40,7 +76,18 @@ func (h *BotHandlers) HandleStart(ctx context.Context, sender Sender, update *mo
 	welcomeMessage := fmt.Sprintf(
 		"Hi %s! 👋\n\n"+
 			"I'm your personal accountant bot. Send me expenses in this format:\n\n"+
-			"Example: `Lunch 2.95`\n\n",
+			"Example: `Lunch 2.95`\n\n"+
+			"Add a date to log an earlier expense: `Lunch 2.95 12.3.` or `yesterday Taxi 14`\n\n"+
+			"Prefix with `fun` or add `#fun` to file it under Fun: `fun Movies 12`\n\n"+
+			"Type a calculation to split a bill: `Dinner 45/2`\n\n"+
+			"Add a currency to convert to euros: `Taxi 250 SEK` or `$12 Coffee`\n\n"+
+			"Put one expense per line to add a whole receipt at once.\n\n"+
+			"Send a photo of the receipt with the expense as its caption to keep the receipt, or without one to have me read it.\n\n"+
+			"Start with `+` to record income: `+Salary 3200`\n\n"+
+			"Or just say the expense in a voice message.\n\n"+
+			"Reply to my confirmation with a corrected line to fix an expense: `Lunch 3.95`\n\n"+
+			"Send /undo to remove the last expense you added, /total to see this month's spending, "+
+			"/report for a breakdown by item and /compare to compare it to earlier months.",
 		user.FirstName,
 	)
 
@@ -53,16 +100,273 @@ func (h *BotHandlers) HandleStart(ctx context.Context, sender Sender, update *mo
 	}
 }
 
-// HandleExpense handles expense messages
+// HandleUnauthorized refuses messages from users and chats outside the allowlist
+func (h *BotHandlers) HandleUnauthorized(ctx context.Context, sender Sender, update *models.Update) {
+	const refusal = "Sorry, this is a private bot and you are not allowed to use it."
+
+	if query := update.CallbackQuery; query != nil {
+		h.logger.Warn("unauthorized callback query",
+			slog.Int64("user_id", query.From.ID),
+			slog.String("username", query.From.Username))
+		h.answerCallback(ctx, sender, query.ID, refusal, true)
+		return
+	}
+
+	if update.Message == nil {
+		return
+	}
+
+	var userID int64
+	var username string
+	if update.Message.From != nil {
+		userID = update.Message.From.ID
+		username = update.Message.From.Username
+	}
+
+	h.logger.Warn("unauthorized message",
+		slog.Int64("user_id", userID),
+		slog.String("username", username),
+		slog.Int64("chat_id", update.Message.Chat.ID))
+
+	_, err := sender.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   refusal,
+	})
+	if err != nil {
+		h.logger.Error("failed to send unauthorized message", slog.String("error", err.Error()))
+	}
+}
+
+// HandleExpense handles expense messages with one expense per line
 // Returns an error only for sheet update failures that should trigger an SQS retry
 func (h *BotHandlers) HandleExpense(ctx context.Context, sender Sender, update *models.Update) error {
 	if update.Message == nil || update.Message.Text == "" {
 		return nil
 	}
+	_, err := h.addExpenses(ctx, sender, update, update.Message.Text, "")
+	return err
+}
+
+// HandleReceipt handles a receipt photo or document captioned with the expense, e.g. "Groceries 43.20"
+// The file is stored and linked next to the expense if a receipt store is configured
+// Returns an error only for sheet update failures that should trigger an SQS retry
+func (h *BotHandlers) HandleReceipt(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+	if update.Message.Caption == "" {
+		return h.suggestFromPhoto(ctx, sender, update)
+	}
+
+	// A receipt that can't be stored must not keep the expense out of the sheet
+	link, err := h.storeReceipt(ctx, update.Message)
+	if err != nil {
+		h.logger.Warn("failed to store receipt",
+			slog.Int64("update_id", update.ID),
+			slog.String("error", err.Error()))
+	}
+
+	_, err = h.addExpenses(ctx, sender, update, update.Message.Caption, link)
+	return err
+}
+
+// Longest voice message that is transcribed, in seconds
+const maxVoiceDuration = 60
+
+// HandleVoice handles a spoken expense such as "Lunch 12.50"
+// The transcription is echoed back, so the user can undo or correct what was misheard
+// Returns an error only for failures that should trigger an SQS retry
+func (h *BotHandlers) HandleVoice(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil || update.Message.Voice == nil {
+		return nil
+	}
+	if h.attachments.Files == nil || h.attachments.Voice == nil {
+		return nil
+	}
+
+	voice := update.Message.Voice
+	chatID := update.Message.Chat.ID
+	reply := func(text string) {
+		_, err := sender.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text})
+		if err != nil {
+			h.logger.Error("failed to send voice message reply", slog.String("error", err.Error()))
+		}
+	}
+
+	if voice.Duration > maxVoiceDuration {
+		reply(fmt.Sprintf("That voice message is too long. Keep it under %d seconds, e.g. \"Lunch 12.50\"", maxVoiceDuration))
+		return nil
+	}
+
+	audio, serverPath, err := h.attachments.Files.Download(ctx, voice.FileID)
+	if err != nil {
+		return fmt.Errorf("download voice message: %w", err)
+	}
 
-	messageText := update.Message.Text
-	expense, err := ParseExpense(messageText)
+	transcript, err := h.attachments.Voice.Transcribe(ctx, audio, voiceFileName(serverPath))
 	if err != nil {
+		h.logger.Error("failed to transcribe voice message", slog.String("error", err.Error()))
+		reply("Sorry, I couldn't transcribe that voice message. Type the expense instead, e.g. \"Lunch 12.50\"")
+		return nil
+	}
+
+	text := cleanTranscript(transcript)
+	h.logger.Info("voice message transcribed",
+		slog.Int64("update_id", update.ID),
+		slog.String("text", text))
+
+	if text == "" {
+		reply("I couldn't hear an expense in that. Try again with the description and amount, e.g. \"Lunch 12.50\"")
+		return nil
+	}
+
+	reply(fmt.Sprintf("🎙️ I heard: %s", text))
+	_, err = h.addExpenses(ctx, sender, update, text, "")
+	return err
+}
+
+// Reads the receipt in a photo without a caption and suggests an expense for it
+// Nothing is added until the user confirms the suggestion
+func (h *BotHandlers) suggestFromPhoto(ctx context.Context, sender Sender, update *models.Update) error {
+	if h.attachments.Files == nil || h.attachments.OCR == nil {
+		return nil
+	}
+
+	file, ok := messageAttachment(update.Message)
+	if !ok || !strings.HasPrefix(file.mimeType, "image/") {
+		return nil
+	}
+
+	chatID := update.Message.Chat.ID
+	params := &bot.SendMessageParams{
+		ChatID:          chatID,
+		ReplyParameters: &models.ReplyParameters{MessageID: update.Message.ID},
+	}
+
+	data, _, err := h.attachments.Files.Download(ctx, file.fileID)
+	if err != nil {
+		return fmt.Errorf("download receipt: %w", err)
+	}
+
+	// An unreadable image won't get better with a retry, so it is treated like a receipt without a total
+	text, err := h.attachments.OCR.RecognizeText(ctx, data)
+	if err != nil {
+		h.logger.Warn("failed to recognize receipt text",
+			slog.Int64("update_id", update.ID),
+			slog.String("error", err.Error()))
+	}
+
+	merchant, total, ok := suggestFromReceipt(text, h.locale)
+	if !ok {
+		h.logger.Info("no total found on receipt", slog.Int64("update_id", update.ID))
+		params.Text = "I couldn't find a total on this receipt. Send it again with the expense as its caption, e.g. `Groceries 43.20`"
+		if _, err := sender.SendMessage(ctx, params); err != nil {
+			h.logger.Error("failed to send receipt message", slog.String("error", err.Error()))
+		}
+		return nil
+	}
+
+	// Storing now keeps the link in the suggestion, as the photo is out of reach once the user replies to it
+	link, err := h.storeReceipt(ctx, update.Message)
+	if err != nil {
+		h.logger.Warn("failed to store receipt",
+			slog.Int64("update_id", update.ID),
+			slog.String("error", err.Error()))
+	}
+
+	params.Text = receiptSuggestion(fmt.Sprintf("%s %s", merchant, total.Decimal()), link)
+	params.ReplyMarkup = receiptKeyboard()
+	if _, err := sender.SendMessage(ctx, params); err != nil {
+		h.logger.Error("failed to send receipt suggestion", slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// Adds the expense of a receipt suggestion after the user confirmed it
+// The suggestion becomes the confirmation of the expense, with the usual buttons
+func (h *BotHandlers) confirmReceipt(ctx context.Context, sender Sender, update *models.Update, message *models.Message) error {
+	query := update.CallbackQuery
+	line, link, ok := parseReceiptSuggestion(message.Text)
+	if !ok {
+		h.answerCallback(ctx, sender, query.ID, "Already added.", false)
+		return nil
+	}
+
+	now := h.sentAt(message)
+	expense, err := ParseExpense(line, now, h.locale)
+	if err != nil {
+		h.answerCallback(ctx, sender, query.ID, "Reply to the message with the expense instead, e.g. Groceries 43.20", true)
+		return nil
+	}
+	if expense.Date.IsZero() {
+		expense.Date = now
+	}
+	expense.UserID = query.From.ID
+	expense.UpdateID = update.ID
+	expense.Receipt = link
+
+	chatID := message.Chat.ID
+	groups, err := h.groupByWorksheet(ctx, sender, chatID, []*Expense{expense}, now)
+	if err != nil || groups == nil {
+		return err
+	}
+
+	// The expense is linked to the suggestion as it is written, so a second tap on Confirm adds nothing
+	err = h.sheets.AddLinkedExpense(ctx, groups[0].worksheet, expense, chatID, message.ID)
+	if errors.Is(err, ErrAlreadyLinked) {
+		h.answerCallback(ctx, sender, query.ID, "Already added.", false)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("add expense: %w", err)
+	}
+
+	h.logger.Info("receipt expense added",
+		slog.Int64("user_id", expense.UserID),
+		slog.String("worksheet", groups[0].worksheet),
+		slog.String("desc", expense.Desc),
+		slog.String("amount", expense.Amount.Decimal()))
+
+	text := h.expenseReply(ctx, groups[0].worksheet, expense, now)
+	h.editMessage(ctx, sender, chatID, message.ID, text, expenseKeyboard(expense.Category))
+	h.answerCallback(ctx, sender, query.ID, "Added", false)
+
+	return nil
+}
+
+// Stores the file attached to a message and returns the link to it
+// Returns an empty link if receipts are not stored
+func (h *BotHandlers) storeReceipt(ctx context.Context, message *models.Message) (string, error) {
+	if h.attachments.Files == nil || h.attachments.Receipts == nil {
+		return "", nil
+	}
+
+	file, ok := messageAttachment(message)
+	if !ok {
+		return "", nil
+	}
+
+	data, serverPath, err := h.attachments.Files.Download(ctx, file.fileID)
+	if err != nil {
+		return "", fmt.Errorf("download receipt: %w", err)
+	}
+
+	key := receiptKey(file, serverPath, h.sentAt(message))
+	link, err := h.attachments.Receipts.Put(ctx, key, receiptContentType(file, key), data)
+	if err != nil {
+		return "", fmt.Errorf("store receipt: %w", err)
+	}
+	return link, nil
+}
+
+// Parses the expenses in text, adds them and confirms them to the user
+// Every expense is linked to the receipt, if there is one
+// Reports whether any expense was written, nothing is when the text can't be parsed or has no rate
+func (h *BotHandlers) addExpenses(ctx context.Context, sender Sender, update *models.Update, text, receipt string) (bool, error) {
+	now := h.sentAt(update.Message)
+
+	expenses, failed := ParseExpenses(text, now, h.locale)
+	if len(expenses) == 0 {
 		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
 			Text:   "Could not parse expense. Please use format:\n\nExample: `Lunch 2.95`",
@@ -70,33 +374,458 @@ func (h *BotHandlers) HandleExpense(ctx context.Context, sender Sender, update *
 		if sendErr != nil {
 			h.logger.Error("failed to send error message", slog.String("error", sendErr.Error()))
 		}
+		return false, nil
+	}
+
+	// Lines in a currency without a rate are left out and listed in the reply, the rest are added
+	var converted, unconverted []*Expense
+	for _, expense := range expenses {
+		if update.Message.From != nil {
+			expense.UserID = update.Message.From.ID
+		}
+		if expense.Date.IsZero() {
+			expense.Date = now
+		}
+		expense.UpdateID = update.ID
+		expense.Receipt = receipt
+
+		amount, original, err := h.convertToEuros(ctx, expense.Amount, expense.Date)
+		if errors.Is(err, ErrNoRate) {
+			unconverted = append(unconverted, expense)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		expense.Amount, expense.Original = amount, original
+		converted = append(converted, expense)
+	}
+
+	if len(converted) == 0 {
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   noRateMessage(unconverted[0].Amount.Currency),
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send missing rate message", slog.String("error", sendErr.Error()))
+		}
+		return false, nil
+	}
+	expenses = converted
+
+	groups, err := h.groupByWorksheet(ctx, sender, update.Message.Chat.ID, expenses, now)
+	if err != nil || groups == nil {
+		return false, err
+	}
+
+	for _, group := range groups {
+		if err := h.sheets.AddExpenses(ctx, group.worksheet, group.expenses); err != nil {
+			return false, fmt.Errorf("add expenses: %w", err)
+		}
+	}
+
+	params := &bot.SendMessageParams{ChatID: update.Message.Chat.ID}
+	if len(expenses) == 1 && len(failed) == 0 && len(unconverted) == 0 {
+		params.Text = h.expenseReply(ctx, groups[0].worksheet, expenses[0], now)
+		params.ReplyMarkup = expenseKeyboard(expenses[0].Category)
+	} else {
+		params.Text = h.expensesSummary(ctx, groups, failed, unconverted, now)
+	}
+
+	sent, err := sender.SendMessage(ctx, params)
+	if err != nil {
+		h.logger.Error("failed to send response message", slog.String("error", err.Error()))
+		return true, nil
+	}
+
+	// The expenses are already written, so a failure here must not trigger a retry
+	for _, group := range groups {
+		if err := h.sheets.LinkMessage(ctx, group.worksheet, update.ID, sent.Chat.ID, sent.ID); err != nil {
+			h.logger.Warn("failed to link confirmation message",
+				slog.Int64("update_id", update.ID),
+				slog.String("worksheet", group.worksheet),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	return true, nil
+}
+
+// HandleIncome handles "+Salary 3200" and "/income Salary 3200" messages
+// Returns an error only for sheet update failures that should trigger an SQS retry
+func (h *BotHandlers) HandleIncome(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil || update.Message.Text == "" {
 		return nil
 	}
 
-	worksheet, err := h.sheets.GetCurrentMonthWorksheet(ctx)
+	chatID := update.Message.Chat.ID
+	now := h.sentAt(update.Message)
+
+	income, err := ParseIncome(update.Message.Text, now, h.locale)
 	if err != nil {
-		return fmt.Errorf("get worksheet: %w", err)
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   "Could not parse income. Please use format:\n\nExample: `+Salary 3200` or `/income Salary 3200`",
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send error message", slog.String("error", sendErr.Error()))
+		}
+		return nil
 	}
 
-	if err := h.sheets.AddExpense(ctx, worksheet, expense); err != nil {
-		return fmt.Errorf("add expense: %w", err)
+	if update.Message.From != nil {
+		income.UserID = update.Message.From.ID
+	}
+	if income.Date.IsZero() {
+		income.Date = now
+	}
+	income.UpdateID = update.ID
+
+	converted, original, err := h.convertToEuros(ctx, income.Amount, income.Date)
+	if errors.Is(err, ErrNoRate) {
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: noRateMessage(income.Amount.Currency)})
+		if sendErr != nil {
+			h.logger.Error("failed to send missing rate message", slog.String("error", sendErr.Error()))
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	income.Amount, income.Original = converted, original
+
+	worksheet, err := h.worksheetFor(ctx, sender, chatID, income.Date, h.entryLookup(income.Date, now))
+	if err != nil || worksheet == "" {
+		return err
+	}
+
+	err = h.sheets.AddIncome(ctx, worksheet, income)
+	if errors.Is(err, ErrNoIncomeSection) {
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("%s has no income section. Please add an \"Income\" row above the income rows and try again.", worksheet),
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send missing income section message", slog.String("error", sendErr.Error()))
+		}
+		return nil
+	}
+	if errors.Is(err, ErrIncomeRowsFull) {
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("There is no empty income row left in %s. Please add one above Total Net income and try again.", worksheet),
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send full income message", slog.String("error", sendErr.Error()))
+		}
+		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("add income: %w", err)
+	}
+
+	h.logger.Info("income added",
+		slog.Int64("user_id", income.UserID),
+		slog.String("worksheet", worksheet),
+		slog.String("desc", income.Desc),
+		slog.String("amount", income.Amount.Decimal()))
+
+	response := fmt.Sprintf("💰 Received %s€ from %s%s",
+		formatConvertedAmount(income.Amount, income.Original),
+		income.Desc,
+		formatExpenseDate(income.Date, now))
 
-	monthlyTotal, err := h.sheets.GetMonthlyTotal(ctx, worksheet)
+	totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
+	if err != nil {
+		h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
+	} else {
+		response += fmt.Sprintf(". Net balance is %s€", formatAmount(totals.Net()))
+	}
+
+	_, err = sender.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: response})
+	if err != nil {
+		h.logger.Error("failed to send response message", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// Expenses of a message that go into the same worksheet
+type worksheetExpenses struct {
+	worksheet string
+	expenses  []*Expense
+}
+
+// Resolves the worksheet of every expense before anything is written, keeping the message order
+// Returns nil groups and no error when a worksheet is missing and the user has been told
+func (h *BotHandlers) groupByWorksheet(ctx context.Context, sender Sender, chatID int64, expenses []*Expense, now time.Time) ([]*worksheetExpenses, error) {
+	var groups []*worksheetExpenses
+	byMonth := make(map[string]*worksheetExpenses)
+
+	for _, expense := range expenses {
+		month := expense.Date.In(h.location).Format("2006-01")
+		if group, ok := byMonth[month]; ok {
+			group.expenses = append(group.expenses, expense)
+			continue
+		}
+
+		worksheet, err := h.worksheetFor(ctx, sender, chatID, expense.Date, h.entryLookup(expense.Date, now))
+		if err != nil || worksheet == "" {
+			return nil, err
+		}
+
+		group := &worksheetExpenses{worksheet: worksheet, expenses: []*Expense{expense}}
+		byMonth[month] = group
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+// Picks how to find the worksheet for an entry dated date in a message sent at now
+// Only the month the message was sent in is created, so a back-dated entry or a mistyped year
+// never adds a worksheet for some other month
+func (h *BotHandlers) entryLookup(date, now time.Time) func(ctx context.Context, date time.Time) (string, error) {
+	if date.In(h.location).Format("2006-01") == now.In(h.location).Format("2006-01") {
+		return h.sheets.EnsureWorksheet
+	}
+	return h.sheets.GetWorksheet
+}
+
+// Builds the reply for a message with a single expense
+func (h *BotHandlers) expenseReply(ctx context.Context, worksheet string, expense *Expense, now time.Time) string {
+	totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
 	if err != nil {
 		h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
 	}
 
 	response := fmt.Sprintf(
-		"💸 Spent %s€ on %s. New monthly total is %s€",
-		formatAmount(expense.Amount),
+		"💸 Spent %s€ on %s (%s)%s. New monthly total is %s€",
+		formatExpenseAmount(expense),
 		expense.Desc,
-		formatAmount(monthlyTotal),
+		expense.Category,
+		formatExpenseDate(expense.Date, now),
+		formatAmount(totals.Total()),
 	)
 
+	if err == nil {
+		response += netSuffix(totals)
+		response += h.budgetSuffix(ctx, worksheet, totals, []*Expense{expense})
+	}
+
+	return response
+}
+
+// Returns the net balance as a reply suffix, or an empty string if no income was recorded
+func netSuffix(totals MonthlyTotals) string {
+	if totals.Income.Cents == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", net balance %s€", formatAmount(totals.Net()))
+}
+
+// Builds the reply listing every expense added from a multi-line message, the lines that failed
+// and the ones left out for lack of an exchange rate
+func (h *BotHandlers) expensesSummary(ctx context.Context, groups []*worksheetExpenses, failed []string, unconverted []*Expense, now time.Time) string {
+	var count int
+	for _, group := range groups {
+		count += len(group.expenses)
+	}
+
+	var b strings.Builder
+	noun := "expenses"
+	if count == 1 {
+		noun = "expense"
+	}
+	fmt.Fprintf(&b, "💸 Added %d %s:\n", count, noun)
+	for _, group := range groups {
+		for _, expense := range group.expenses {
+			fmt.Fprintf(&b, "• %s %s€ (%s)%s\n",
+				expense.Desc,
+				formatExpenseAmount(expense),
+				expense.Category,
+				formatExpenseDate(expense.Date, now))
+		}
+	}
+
+	if len(failed) > 0 {
+		b.WriteString("\n❌ Could not parse:\n")
+		for _, line := range failed {
+			fmt.Fprintf(&b, "• %s\n", line)
+		}
+	}
+
+	if len(unconverted) > 0 {
+		b.WriteString("\n❌ No exchange rate, please send these in euros:\n")
+		for _, expense := range unconverted {
+			fmt.Fprintf(&b, "• %s %s %s\n", expense.Desc, formatAmount(expense.Amount), expense.Amount.Currency)
+		}
+	}
+
+	for _, group := range groups {
+		totals, err := h.sheets.GetMonthlyTotals(ctx, group.worksheet)
+		if err != nil {
+			h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
+			continue
+		}
+
+		if len(groups) > 1 {
+			fmt.Fprintf(&b, "\nNew total for %s is %s€%s", group.worksheet, formatAmount(totals.Total()), netSuffix(totals))
+			continue
+		}
+
+		fmt.Fprintf(&b, "\nNew monthly total is %s€%s", formatAmount(totals.Total()), netSuffix(totals))
+		b.WriteString(h.budgetSuffix(ctx, group.worksheet, totals, group.expenses))
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Returns the budget report for the expenses as a reply suffix, or an empty string if there is none
+func (h *BotHandlers) budgetSuffix(ctx context.Context, worksheet string, totals MonthlyTotals, expenses []*Expense) string {
+	budget, err := h.sheets.GetBudget(ctx, worksheet)
+	if err != nil {
+		h.logger.Error("failed to get budget", slog.String("error", err.Error()))
+		return ""
+	}
+
+	report := budgetReport(budget, totals, expenses)
+	if report == "" {
+		return ""
+	}
+	return "\n\n" + report
+}
+
+// HandleEdit handles replies to a confirmation message by correcting the expense it confirmed
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleEdit(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil || update.Message.ReplyToMessage == nil {
+		return nil
+	}
+
+	chatID := update.Message.Chat.ID
+	reply := func(text string) {
+		_, err := sender.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text})
+		if err != nil {
+			h.logger.Error("failed to send edit message", slog.String("error", err.Error()))
+		}
+	}
+
+	// A reply to a receipt suggestion is the expense to add in its place
+	suggestion := update.Message.ReplyToMessage
+	if _, link, ok := parseReceiptSuggestion(suggestion.Text); ok {
+		added, err := h.addExpenses(ctx, sender, update, update.Message.Text, link)
+		if err != nil || !added {
+			// The suggestion keeps its buttons and receipt link for another try
+			return err
+		}
+		h.editMessage(ctx, sender, chatID, suggestion.ID, "🧾 Replaced by your correction", nil)
+		return nil
+	}
+
+	now := h.sentAt(update.Message)
+	correction, err := parseCorrection(update.Message.Text, now, h.locale)
+	if err != nil {
+		reply("Could not parse the correction. Reply with the fixed expense, e.g. `Lunch 3.95`, or just the amount")
+		return nil
+	}
+
+	date := correction.Date
+	if date.IsZero() {
+		date = now
+	}
+	converted, original, err := h.convertToEuros(ctx, correction.Amount, date)
+	if errors.Is(err, ErrNoRate) {
+		reply(noRateMessage(correction.Amount.Currency))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	correction.Amount, correction.Original = converted, original
+
+	previous, worksheet, err := h.sheets.UpdateExpense(ctx, chatID, update.Message.ReplyToMessage.ID, h.sentAt(update.Message.ReplyToMessage), correction)
+	if errors.Is(err, ErrExpenseNotFound) {
+		reply("That message has no expense I can change.")
+		return nil
+	}
+	if errors.Is(err, ErrAmbiguousExpense) {
+		reply("That message lists several expenses. Use the description of the one to change, e.g. `Milk 1.40`")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("update expense: %w", err)
+	}
+
+	h.logger.Info("expense edited",
+		slog.String("worksheet", worksheet),
+		slog.String("desc", previous.Desc),
+		slog.String("old_amount", previous.Amount.Decimal()),
+		slog.String("new_amount", correction.Amount.Decimal()))
+
+	totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
+	if err != nil {
+		h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
+	}
+
+	desc := correction.Desc
+	if desc == "" {
+		desc = previous.Desc
+	}
+
+	reply(fmt.Sprintf(
+		"✏️ Changed %s %s€ to %s %s€ (%s). New monthly total is %s€",
+		previous.Desc,
+		formatAmount(previous.Amount),
+		desc,
+		formatExpenseAmount(correction),
+		previous.Category,
+		formatAmount(totals.Total()),
+	))
+
+	return nil
+}
+
+// HandleUndo handles the /undo command by removing the user's most recent expense
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleUndo(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil || update.Message.From == nil {
+		return nil
+	}
+
+	worksheet, err := h.worksheetFor(ctx, sender, update.Message.Chat.ID, h.sentAt(update.Message), h.sheets.GetWorksheet)
+	if err != nil || worksheet == "" {
+		return err
+	}
+
+	expense, err := h.sheets.DeleteLastExpense(ctx, worksheet, update.Message.From.ID)
+	if errors.Is(err, ErrNothingToUndo) {
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "Nothing to undo this month.",
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send undo message", slog.String("error", sendErr.Error()))
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("delete last expense: %w", err)
+	}
+
+	h.logger.Info("expense undone",
+		slog.Int64("user_id", update.Message.From.ID),
+		slog.String("worksheet", worksheet),
+		slog.String("desc", expense.Desc))
+
+	totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
+	if err != nil {
+		h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
+	}
+
 	_, err = sender.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
-		Text:   response,
+		Text:   removedReply(expense, totals),
 	})
 	if err != nil {
 		h.logger.Error("failed to send response message", slog.String("error", err.Error()))
@@ -105,7 +834,432 @@ func (h *BotHandlers) HandleExpense(ctx context.Context, sender Sender, update *
 	return nil
 }
 
-func formatAmount(amount float64) string {
-	formatted := fmt.Sprintf("%.2f", amount)
-	return strings.ReplaceAll(formatted, ".", ",")
+// HandleCallback handles the buttons under an expense confirmation
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleCallback(ctx context.Context, sender Sender, update *models.Update) error {
+	query := update.CallbackQuery
+	if query == nil {
+		return nil
+	}
+
+	message := query.Message.Message
+	if message == nil {
+		h.answerCallback(ctx, sender, query.ID, "This message is too old to change.", false)
+		return nil
+	}
+	chatID := message.Chat.ID
+
+	switch {
+	case query.Data == callbackUndo:
+		expense, worksheet, err := h.sheets.DeleteExpense(ctx, chatID, message.ID, h.sentAt(message))
+		if errors.Is(err, ErrExpenseNotFound) {
+			h.answerCallback(ctx, sender, query.ID, "Already removed.", false)
+			return nil
+		}
+		if errors.Is(err, ErrAmbiguousExpense) {
+			h.answerCallback(ctx, sender, query.ID, severalExpensesAlert, true)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("delete expense: %w", err)
+		}
+
+		h.logger.Info("expense undone",
+			slog.Int64("user_id", query.From.ID),
+			slog.String("worksheet", worksheet),
+			slog.String("desc", expense.Desc))
+
+		totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
+		if err != nil {
+			h.logger.Error("failed to get monthly total", slog.String("error", err.Error()))
+		}
+
+		h.editMessage(ctx, sender, chatID, message.ID, removedReply(expense, totals), nil)
+		h.answerCallback(ctx, sender, query.ID, "Removed", false)
+
+	case strings.HasPrefix(query.Data, callbackMove):
+		category, ok := parseCategory(strings.TrimPrefix(query.Data, callbackMove))
+		if !ok {
+			h.answerCallback(ctx, sender, query.ID, "", false)
+			return nil
+		}
+
+		expense, worksheet, err := h.sheets.MoveExpense(ctx, chatID, message.ID, h.sentAt(message), category)
+		if errors.Is(err, ErrExpenseNotFound) {
+			h.answerCallback(ctx, sender, query.ID, "This expense was removed.", false)
+			return nil
+		}
+		if errors.Is(err, ErrAmbiguousExpense) {
+			h.answerCallback(ctx, sender, query.ID, severalExpensesAlert, true)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("move expense: %w", err)
+		}
+
+		h.logger.Info("expense moved",
+			slog.Int64("user_id", query.From.ID),
+			slog.String("worksheet", worksheet),
+			slog.String("desc", expense.Desc),
+			slog.String("category", category.String()))
+
+		text := h.expenseReply(ctx, worksheet, expense, h.sentAt(message))
+		h.editMessage(ctx, sender, chatID, message.ID, text, expenseKeyboard(category))
+		h.answerCallback(ctx, sender, query.ID, "Moved to "+category.String(), false)
+
+	case query.Data == callbackAmount:
+		h.answerCallback(ctx, sender, query.ID, "Reply to the message with the new amount, e.g. 3.95", true)
+
+	case query.Data == callbackConfirmReceipt:
+		return h.confirmReceipt(ctx, sender, update, message)
+
+	case query.Data == callbackEditReceipt:
+		h.answerCallback(ctx, sender, query.ID, "Reply to the message with the expense, e.g. Groceries 43.20", true)
+
+	default:
+		h.answerCallback(ctx, sender, query.ID, "", false)
+	}
+
+	return nil
+}
+
+// Stops the loading indicator on the pressed button, optionally showing a notification or an alert
+func (h *BotHandlers) answerCallback(ctx context.Context, sender Sender, queryID, text string, alert bool) {
+	_, err := sender.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: queryID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+	if err != nil {
+		h.logger.Error("failed to answer callback query", slog.String("error", err.Error()))
+	}
+}
+
+// Replaces the text of a bot message, and its buttons if a keyboard is given
+func (h *BotHandlers) editMessage(ctx context.Context, sender Sender, chatID int64, messageID int, text string, keyboard *models.InlineKeyboardMarkup) {
+	params := &bot.EditMessageTextParams{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Text:      text,
+	}
+	if keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+
+	if _, err := sender.EditMessageText(ctx, params); err != nil {
+		h.logger.Error("failed to edit message", slog.String("error", err.Error()))
+	}
+}
+
+// HandleTotal handles the /total command by reporting the monthly totals without changing anything
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleTotal(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	worksheet, err := h.worksheetFor(ctx, sender, update.Message.Chat.ID, h.sentAt(update.Message), h.sheets.GetWorksheet)
+	if err != nil || worksheet == "" {
+		return err
+	}
+
+	totals, err := h.sheets.GetMonthlyTotals(ctx, worksheet)
+	if err != nil {
+		return fmt.Errorf("get monthly totals: %w", err)
+	}
+
+	response := fmt.Sprintf(
+		"📊 %s\n\n%s: %s€\n%s: %s€\nTotal: %s€",
+		worksheet,
+		CategoryFundamentals, formatAmount(totals.Fundamentals),
+		CategoryFun, formatAmount(totals.Fun),
+		formatAmount(totals.Total()),
+	)
+	if totals.Income.Cents != 0 {
+		response += fmt.Sprintf("\n\nIncome: %s€\nNet: %s€", formatAmount(totals.Income), formatAmount(totals.Net()))
+	}
+
+	_, err = sender.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   response,
+	})
+	if err != nil {
+		h.logger.Error("failed to send total message", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// HandleReport handles the /report command by breaking down the month's spending by item
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleReport(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	worksheet, err := h.worksheetFor(ctx, sender, update.Message.Chat.ID, h.sentAt(update.Message), h.sheets.GetWorksheet)
+	if err != nil || worksheet == "" {
+		return err
+	}
+
+	expenses, err := h.sheets.GetMonthlyExpenses(ctx, worksheet)
+	if err != nil {
+		return fmt.Errorf("get monthly expenses: %w", err)
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   fmt.Sprintf("There are no expenses in %s yet.", worksheet),
+	}
+	if len(expenses) > 0 {
+		params.Text = formatReport(worksheet, buildReport(expenses))
+		params.ParseMode = models.ParseModeHTML
+	}
+
+	if _, err := sender.SendMessage(ctx, params); err != nil {
+		h.logger.Error("failed to send report message", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// HandleCompare handles the /compare command by comparing this month to last month and the trailing average
+// Returns an error only for sheet failures that should trigger an SQS retry
+func (h *BotHandlers) HandleCompare(ctx context.Context, sender Sender, update *models.Update) error {
+	if update.Message == nil {
+		return nil
+	}
+
+	var history []MonthTotals
+	lookup := func(ctx context.Context, date time.Time) (string, error) {
+		var err error
+		history, err = h.sheets.GetMonthlyHistory(ctx, date, averagedMonths+1)
+		if err != nil {
+			return "", err
+		}
+		return history[0].Title, nil
+	}
+
+	worksheet, err := h.worksheetFor(ctx, sender, update.Message.Chat.ID, h.sentAt(update.Message), lookup)
+	if err != nil || worksheet == "" {
+		return err
+	}
+
+	_, err = sender.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		Text:      formatComparison(history),
+		ParseMode: models.ParseModeHTML,
+	})
+	if err != nil {
+		h.logger.Error("failed to send comparison message", slog.String("error", err.Error()))
+	}
+
+	return nil
+}
+
+// Returns when the message was sent in the configured timezone
+// Using the Telegram timestamp keeps queue delays and SQS retries from moving an expense into the next month
+func (h *BotHandlers) sentAt(message *models.Message) time.Time {
+	if message.Date == 0 {
+		return h.now().In(h.location)
+	}
+	return time.Unix(int64(message.Date), 0).In(h.location)
+}
+
+// Looks up the worksheet for the month of date, telling the user if it does not exist
+// Returns an empty title and no error when the caller should stop without a retry
+func (h *BotHandlers) worksheetFor(
+	ctx context.Context,
+	sender Sender,
+	chatID int64,
+	date time.Time,
+	lookup func(ctx context.Context, date time.Time) (string, error),
+) (string, error) {
+	worksheet, err := lookup(ctx, date)
+
+	var notFound *WorksheetNotFoundError
+	if errors.As(err, &notFound) {
+		h.logger.Warn("worksheet not found", slog.String("title", notFound.Title))
+
+		_, sendErr := sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: chatID,
+			Text:   fmt.Sprintf("There is no worksheet for %s yet. Please add one to the spreadsheet and try again.", notFound.Title),
+		})
+		if sendErr != nil {
+			h.logger.Error("failed to send missing worksheet message", slog.String("error", sendErr.Error()))
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get worksheet: %w", err)
+	}
+
+	return worksheet, nil
+}
+
+// Describes an expense suggested from a receipt, as parsed back by parseReceiptSuggestion
+func receiptSuggestion(line, link string) string {
+	text := suggestionPrefix + line + "\n"
+	if link != "" {
+		text += receiptPrefix + link + "\n"
+	}
+	return text + "\nConfirm to add it, or Edit to reply with the right expense."
+}
+
+// Returns the expense line and receipt link of a receipt suggestion
+func parseReceiptSuggestion(text string) (string, string, bool) {
+	var line, link string
+	for _, l := range strings.Split(text, "\n") {
+		if rest, ok := strings.CutPrefix(l, suggestionPrefix); ok {
+			line = rest
+		}
+		if rest, ok := strings.CutPrefix(l, receiptPrefix); ok {
+			link = rest
+		}
+	}
+	return line, link, line != ""
+}
+
+// Builds the buttons under an expense suggested from a receipt
+func receiptKeyboard() *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "✅ Confirm", CallbackData: callbackConfirmReceipt},
+			{Text: "✏️ Edit", CallbackData: callbackEditReceipt},
+		}},
+	}
+}
+
+// Builds the buttons under a single expense confirmation
+func expenseKeyboard(category Category) *models.InlineKeyboardMarkup {
+	other := CategoryFun
+	if category == CategoryFun {
+		other = CategoryFundamentals
+	}
+
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{{
+			{Text: "↩️ Undo", CallbackData: callbackUndo},
+			{Text: "🔀 Move to " + other.String(), CallbackData: callbackMove + strings.ToLower(other.String())},
+			{Text: "✏️ Change amount", CallbackData: callbackAmount},
+		}},
+	}
+}
+
+// Describes a removed expense and the new monthly total
+func removedReply(expense *Expense, totals MonthlyTotals) string {
+	return fmt.Sprintf(
+		"↩️ Removed %s€ on %s (%s). New monthly total is %s€",
+		formatAmount(expense.Amount),
+		expense.Desc,
+		expense.Category,
+		formatAmount(totals.Total()),
+	)
+}
+
+// Parses a reply to a confirmation: a full expense line, or just the new amount
+func parseCorrection(text string, now time.Time, locale AmountLocale) (*Expense, error) {
+	value, currency := extractCurrency(strings.TrimSpace(text))
+	if amount, err := parseAmount(value, locale); err == nil {
+		amount.Currency = currency
+		return &Expense{Amount: amount}, nil
+	}
+	return ParseExpense(text, now, locale)
+}
+
+// Describes the remaining budget after expenses and warns about crossed thresholds
+func budgetReport(budget Budget, totals MonthlyTotals, expenses []*Expense) string {
+	var added Money
+	var categories []Category
+	addedByCategory := make(map[Category]Money)
+	for _, expense := range expenses {
+		added = added.Add(expense.Amount)
+		if _, ok := addedByCategory[expense.Category]; !ok {
+			categories = append(categories, expense.Category)
+		}
+		addedByCategory[expense.Category] = addedByCategory[expense.Category].Add(expense.Amount)
+	}
+
+	var lines []string
+	lines = append(lines, budgetLines("Monthly budget", budget.Total, totals.Total(), added)...)
+	for _, category := range categories {
+		lines = append(lines, budgetLines(
+			category.String()+" budget",
+			budget.Limit(category),
+			totals.ForCategory(category),
+			addedByCategory[category],
+		)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func budgetLines(name string, limit, spent, amount Money) []string {
+	if limit.Cents <= 0 {
+		return nil
+	}
+
+	var lines []string
+	if remaining := limit.Sub(spent); remaining.Cents >= 0 {
+		lines = append(lines, fmt.Sprintf("%s: %s€ left of %s€", name, formatAmount(remaining), formatAmount(limit)))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s: %s€ over %s€", name, formatAmount(remaining.Neg()), formatAmount(limit)))
+	}
+
+	if threshold, ok := crossedThreshold(spent.Sub(amount), spent, limit); ok {
+		if threshold >= 100 {
+			lines = append(lines, fmt.Sprintf("🚨 %s exceeded!", name))
+		} else {
+			lines = append(lines, fmt.Sprintf("⚠️ %d%% of %s used", threshold, strings.ToLower(name)))
+		}
+	}
+
+	return lines
+}
+
+// Converts an amount paid in another currency to euros
+// Returns the converted amount and the amount as paid, which is zero if it already was in euros
+func (h *BotHandlers) convertToEuros(ctx context.Context, amount Money, date time.Time) (Money, Money, error) {
+	if amount.Currency == defaultCurrency {
+		return amount, Money{}, nil
+	}
+
+	converted, err := convertMoney(ctx, h.rates, amount, defaultCurrency, date)
+	if err != nil {
+		return Money{}, Money{}, fmt.Errorf("convert %s to %s: %w", amount.Currency, defaultCurrency, err)
+	}
+	return converted, amount, nil
+}
+
+// Tells the user that an amount can't be converted to euros
+func noRateMessage(currency string) string {
+	return fmt.Sprintf("I don't know the exchange rate for %s. Please send the amount in euros.", currency)
+}
+
+// Describes the date of a back-dated expense, or returns an empty string for today or an unknown date
+func formatExpenseDate(date, now time.Time) string {
+	if date.IsZero() || date.Year() == now.Year() && date.YearDay() == now.YearDay() {
+		return ""
+	}
+	return " on " + date.Format("2.1.2006")
+}
+
+// Formats the amount of an expense, echoing the calculation it was typed as, e.g. "45/2 = 22,50"
+func formatExpenseAmount(expense *Expense) string {
+	amount := formatConvertedAmount(expense.Amount, expense.Original)
+	if expense.Expression == "" {
+		return amount
+	}
+	return fmt.Sprintf("%s = %s", expense.Expression, amount)
+}
+
+// Formats an amount in euros after the amount as paid in another currency, e.g. "250,00 SEK = 21,75"
+func formatConvertedAmount(amount, original Money) string {
+	if original.Currency == "" {
+		return formatAmount(amount)
+	}
+	return fmt.Sprintf("%s %s = %s", formatAmount(original), original.Currency, formatAmount(amount))
+}
+
+func formatAmount(amount Money) string {
+	return strings.ReplaceAll(amount.Decimal(), ".", ",")
 }
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/big"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
@@ -15,6 +18,8 @@ import (
 type mockSender struct {
 	sendFunc func(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
 	calls    []*bot.SendMessageParams
+	answers  []*bot.AnswerCallbackQueryParams
+	edits    []*bot.EditMessageTextParams
 }
 
 func (m *mockSender) SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
@@ -25,21 +30,50 @@ func (m *mockSender) SendMessage(ctx context.Context, params *bot.SendMessagePar
 	return &models.Message{}, nil
 }
 
+func (m *mockSender) AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) (bool, error) {
+	m.answers = append(m.answers, params)
+	return true, nil
+}
+
+func (m *mockSender) EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	m.edits = append(m.edits, params)
+	return &models.Message{}, nil
+}
+
 var _ Spreadsheet = (*mockSheet)(nil)
 
 type mockSheet struct {
-	getWorksheetFunc func(ctx context.Context) (string, error)
+	getWorksheetFunc func(ctx context.Context, date time.Time) (string, error)
+	ensureFunc       func(ctx context.Context, date time.Time) (string, error)
 	addExpenseFunc   func(ctx context.Context, worksheet string, expense *Expense) error
-	getMonthlyFunc   func(ctx context.Context, worksheet string) (float64, error)
+	addExpensesFunc  func(ctx context.Context, worksheet string, expenses []*Expense) error
+	addLinkedFunc    func(ctx context.Context, worksheet string, expense *Expense, chatID int64, messageID int) error
+	addIncomeFunc    func(ctx context.Context, worksheet string, income *Income) error
+	getMonthlyFunc   func(ctx context.Context, worksheet string) (MonthlyTotals, error)
+	getExpensesFunc  func(ctx context.Context, worksheet string) ([]*Expense, error)
+	getHistoryFunc   func(ctx context.Context, date time.Time, months int) ([]MonthTotals, error)
+	deleteLastFunc   func(ctx context.Context, worksheet string, userID int64) (*Expense, error)
+	getBudgetFunc    func(ctx context.Context, worksheet string) (Budget, error)
+	linkMessageFunc  func(ctx context.Context, worksheet string, updateID, chatID int64, messageID int) error
+	updateFunc       func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, expense *Expense) (*Expense, string, error)
+	deleteFunc       func(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error)
+	moveFunc         func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, category Category) (*Expense, string, error)
 }
 
-func (m *mockSheet) GetCurrentMonthWorksheet(ctx context.Context) (string, error) {
+func (m *mockSheet) GetWorksheet(ctx context.Context, date time.Time) (string, error) {
 	if m.getWorksheetFunc != nil {
-		return m.getWorksheetFunc(ctx)
+		return m.getWorksheetFunc(ctx, date)
 	}
 	return "February 2026", nil
 }
 
+func (m *mockSheet) EnsureWorksheet(ctx context.Context, date time.Time) (string, error) {
+	if m.ensureFunc != nil {
+		return m.ensureFunc(ctx, date)
+	}
+	return m.GetWorksheet(ctx, date)
+}
+
 func (m *mockSheet) AddExpense(ctx context.Context, worksheet string, expense *Expense) error {
 	if m.addExpenseFunc != nil {
 		return m.addExpenseFunc(ctx, worksheet, expense)
@@ -47,28 +81,165 @@ func (m *mockSheet) AddExpense(ctx context.Context, worksheet string, expense *E
 	return nil
 }
 
-func (m *mockSheet) GetMonthlyTotal(ctx context.Context, worksheet string) (float64, error) {
+func (m *mockSheet) AddExpenses(ctx context.Context, worksheet string, expenses []*Expense) error {
+	if m.addExpensesFunc != nil {
+		return m.addExpensesFunc(ctx, worksheet, expenses)
+	}
+	for _, expense := range expenses {
+		if err := m.AddExpense(ctx, worksheet, expense); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockSheet) AddLinkedExpense(ctx context.Context, worksheet string, expense *Expense, chatID int64, messageID int) error {
+	if m.addLinkedFunc != nil {
+		return m.addLinkedFunc(ctx, worksheet, expense, chatID, messageID)
+	}
+	return m.AddExpense(ctx, worksheet, expense)
+}
+
+func (m *mockSheet) AddIncome(ctx context.Context, worksheet string, income *Income) error {
+	if m.addIncomeFunc != nil {
+		return m.addIncomeFunc(ctx, worksheet, income)
+	}
+	return nil
+}
+
+func (m *mockSheet) GetMonthlyTotals(ctx context.Context, worksheet string) (MonthlyTotals, error) {
 	if m.getMonthlyFunc != nil {
 		return m.getMonthlyFunc(ctx, worksheet)
 	}
-	return 100.0, nil
+	return MonthlyTotals{Fundamentals: Cents(10000)}, nil
+}
+
+func (m *mockSheet) GetMonthlyExpenses(ctx context.Context, worksheet string) ([]*Expense, error) {
+	if m.getExpensesFunc != nil {
+		return m.getExpensesFunc(ctx, worksheet)
+	}
+	return []*Expense{{Desc: "Rent", Amount: Cents(10000)}}, nil
+}
+
+func (m *mockSheet) GetMonthlyHistory(ctx context.Context, date time.Time, months int) ([]MonthTotals, error) {
+	if m.getHistoryFunc != nil {
+		return m.getHistoryFunc(ctx, date, months)
+	}
+	return []MonthTotals{{Title: "February 2026", Totals: MonthlyTotals{Fundamentals: Cents(10000)}, Found: true}}, nil
+}
+
+func (m *mockSheet) DeleteLastExpense(ctx context.Context, worksheet string, userID int64) (*Expense, error) {
+	if m.deleteLastFunc != nil {
+		return m.deleteLastFunc(ctx, worksheet, userID)
+	}
+	return &Expense{Desc: "Lunch", Amount: Cents(1250)}, nil
+}
+
+func (m *mockSheet) GetBudget(ctx context.Context, worksheet string) (Budget, error) {
+	if m.getBudgetFunc != nil {
+		return m.getBudgetFunc(ctx, worksheet)
+	}
+	return Budget{}, nil
+}
+
+func (m *mockSheet) LinkMessage(ctx context.Context, worksheet string, updateID, chatID int64, messageID int) error {
+	if m.linkMessageFunc != nil {
+		return m.linkMessageFunc(ctx, worksheet, updateID, chatID, messageID)
+	}
+	return nil
+}
+
+func (m *mockSheet) UpdateExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, expense *Expense) (*Expense, string, error) {
+	if m.updateFunc != nil {
+		return m.updateFunc(ctx, chatID, messageID, sentAt, expense)
+	}
+	return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+}
+
+func (m *mockSheet) DeleteExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error) {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(ctx, chatID, messageID, sentAt)
+	}
+	return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+}
+
+func (m *mockSheet) MoveExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, category Category) (*Expense, string, error) {
+	if m.moveFunc != nil {
+		return m.moveFunc(ctx, chatID, messageID, sentAt, category)
+	}
+	return &Expense{Desc: "Lunch", Amount: Cents(295), Category: category}, "February 2026", nil
+}
+
+type mockFiles struct {
+	data []byte
+	path string
+	err  error
+}
+
+func (m *mockFiles) Download(ctx context.Context, fileID string) ([]byte, string, error) {
+	return m.data, m.path, m.err
+}
+
+type mockBlobStore struct {
+	objects map[string]string
+	err     error
+}
+
+func (m *mockBlobStore) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	if m.objects == nil {
+		m.objects = make(map[string]string)
+	}
+	m.objects[key] = string(data)
+	return "https://files.example.com/" + key, nil
+}
+
+type mockOCR struct {
+	text string
+	err  error
+}
+
+func (m *mockOCR) RecognizeText(ctx context.Context, image []byte) (string, error) {
+	return m.text, m.err
+}
+
+type mockTranscriber struct {
+	text     string
+	err      error
+	fileName string
+}
+
+func (m *mockTranscriber) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	m.fileName = fileName
+	return m.text, m.err
 }
 
 func discardLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
 
+func testRates() *StaticRates {
+	return NewStaticRates(defaultCurrency, map[string]*big.Rat{
+		"SEK": big.NewRat(87, 1000),
+		"USD": big.NewRat(92, 100),
+	})
+}
+
 func TestFormatAmount(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
-		amount float64
+		amount Money
 		want   string
 	}{
-		{10.0, "10,00"},
-		{12.95, "12,95"},
-		{12.956, "12,96"},
-		{0.0, "0,00"},
+		{Cents(1000), "10,00"},
+		{Cents(1295), "12,95"},
+		{Cents(5), "0,05"},
+		{Cents(0), "0,00"},
+		{Cents(-1250), "-12,50"},
+		{Cents(123456789), "1234567,89"},
 	}
 
 	for _, tt := range tests {
@@ -81,115 +252,295 @@ func TestFormatAmount(t *testing.T) {
 	}
 }
 
-func TestHandleStart(t *testing.T) {
+func TestBudgetReport(t *testing.T) {
 	t.Parallel()
 
-	t.Run("sends welcome message with user name", func(t *testing.T) {
-		t.Parallel()
+	tests := []struct {
+		name         string
+		budget       Budget
+		totals       MonthlyTotals
+		expense      *Expense
+		want         []string
+		wantNotFound []string
+	}{
+		{
+			name:    "no budget",
+			totals:  MonthlyTotals{Fundamentals: Cents(10000)},
+			expense: &Expense{Amount: Cents(1000)},
+		},
+		{
+			name:         "remaining overall and category",
+			budget:       Budget{Total: Cents(100000), Fun: Cents(20000)},
+			totals:       MonthlyTotals{Fundamentals: Cents(50000), Fun: Cents(5000)},
+			expense:      &Expense{Amount: Cents(1000), Category: CategoryFun},
+			want:         []string{"Monthly budget: 450,00€ left of 1000,00€", "Fun budget: 150,00€ left of 200,00€"},
+			wantNotFound: []string{"⚠️", "🚨"},
+		},
+		{
+			name:    "crosses category limit",
+			budget:  Budget{Fundamentals: Cents(50000)},
+			totals:  MonthlyTotals{Fundamentals: Cents(52000)},
+			expense: &Expense{Amount: Cents(4000)},
+			want:    []string{"Fundamentals budget: 20,00€ over 500,00€", "🚨 Fundamentals budget exceeded!"},
+		},
+		{
+			name:         "already over does not warn again",
+			budget:       Budget{Total: Cents(10000)},
+			totals:       MonthlyTotals{Fundamentals: Cents(15000)},
+			expense:      &Expense{Amount: Cents(1000)},
+			want:         []string{"Monthly budget: 50,00€ over 100,00€"},
+			wantNotFound: []string{"🚨"},
+		},
+	}
 
-		sender := &mockSender{}
-		h := NewBotHandlers(&mockSheet{}, discardLogger())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 
-		update := &models.Update{
-			Message: &models.Message{
-				Chat: models.Chat{ID: 123},
-				From: &models.User{FirstName: "Alice"},
-			},
-		}
+			got := budgetReport(tt.budget, tt.totals, []*Expense{tt.expense})
+			if len(tt.want) == 0 && got != "" {
+				t.Errorf("budgetReport() = %q, want empty", got)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(got, s) {
+					t.Errorf("budgetReport() should contain %q, got %q", s, got)
+				}
+			}
+			for _, s := range tt.wantNotFound {
+				if strings.Contains(got, s) {
+					t.Errorf("budgetReport() should not contain %q, got %q", s, got)
+				}
+			}
+		})
+	}
+}
 
-		h.HandleStart(context.Background(), sender, update)
+func TestHandleExpenseDate(t *testing.T) {
+	t.Parallel()
 
-		if len(sender.calls) != 1 {
-			t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
-		}
-		if !strings.Contains(sender.calls[0].Text, "Hi Alice!") {
-			t.Errorf("welcome message should contain user's first name, got %q", sender.calls[0].Text)
-		}
-	})
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
 
-	t.Run("nil message is no-op", func(t *testing.T) {
-		t.Parallel()
+	// Sent just before midnight at the end of February, processed on March 2nd after retries
+	sent := time.Date(2026, time.February, 28, 23, 58, 0, 0, time.UTC)
 
-		sender := &mockSender{}
-		h := NewBotHandlers(&mockSheet{}, discardLogger())
+	tests := []struct {
+		name         string
+		text         string
+		messageDate  int
+		wantDate     time.Time
+		wantCreate   bool
+		wantContains string
+	}{
+		{
+			name:       "undated expense without timestamp uses current time",
+			text:       "Lunch 12.50",
+			wantDate:   now,
+			wantCreate: true,
+		},
+		{
+			name:        "undated expense uses message timestamp",
+			text:        "Lunch 12.50",
+			messageDate: int(sent.Unix()),
+			wantDate:    sent,
+			wantCreate:  true,
+		},
+		{
+			name:         "back-dated expense uses its own month without creating it",
+			text:         "Lunch 12.50 27.2.",
+			wantDate:     time.Date(2026, time.February, 27, 0, 0, 0, 0, time.UTC),
+			wantContains: "on 27.2.2026",
+		},
+		{
+			name:         "relative date is resolved against message timestamp",
+			text:         "yesterday Taxi 14",
+			messageDate:  int(sent.Unix()),
+			wantDate:     time.Date(2026, time.February, 27, 0, 0, 0, 0, time.UTC),
+			wantCreate:   true,
+			wantContains: "on 27.2.2026",
+		},
+	}
 
-		h.HandleStart(context.Background(), sender, &models.Update{Message: nil})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
 
-		if len(sender.calls) != 0 {
-			t.Errorf("expected 0 SendMessage calls, got %d", len(sender.calls))
-		}
-	})
+			var worksheetDate, expenseDate time.Time
+			var created bool
+			sheet := &mockSheet{
+				getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
+					worksheetDate = date
+					return "any", nil
+				},
+				ensureFunc: func(ctx context.Context, date time.Time) (string, error) {
+					worksheetDate, created = date, true
+					return "any", nil
+				},
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					expenseDate = e.Date
+					return nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+			h.now = func() time.Time { return now }
+
+			update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Date: tt.messageDate, Text: tt.text}}
+			if err := h.HandleExpense(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleExpense() unexpected error: %v", err)
+			}
+
+			if !worksheetDate.Equal(tt.wantDate) {
+				t.Errorf("worksheet date = %v, want %v", worksheetDate, tt.wantDate)
+			}
+			if created != tt.wantCreate {
+				t.Errorf("worksheet created = %v, want %v", created, tt.wantCreate)
+			}
+			if !expenseDate.Equal(tt.wantDate) {
+				t.Errorf("expense date = %v, want %v", expenseDate, tt.wantDate)
+			}
+			if tt.wantContains != "" && !strings.Contains(sender.calls[0].Text, tt.wantContains) {
+				t.Errorf("response should contain %q, got %q", tt.wantContains, sender.calls[0].Text)
+			}
+			if tt.wantContains == "" && strings.Contains(sender.calls[0].Text, ") on ") {
+				t.Errorf("response should not mention a date, got %q", sender.calls[0].Text)
+			}
+		})
+	}
 }
 
-func TestHandleExpense(t *testing.T) {
+func TestHandleExpenseDoesNotCreateOtherMonths(t *testing.T) {
 	t.Parallel()
 
-	errFunc := func(ctx context.Context) (string, error) {
-		return "", fmt.Errorf("fail")
+	sent := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		text         string
+		wantContains string
+	}{
+		{name: "mistyped past year", text: "Lunch 12.50 1.1.1990", wantContains: "There is no worksheet for January 1990"},
+		{name: "mistyped future year", text: "Lunch 12.50 1.4.2062", wantContains: "Could not parse expense"},
+		{name: "income in a past month", text: "+Gift 50 1.1.1990", wantContains: "There is no worksheet for January 1990"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sheet := &mockSheet{
+				getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return "", &WorksheetNotFoundError{Title: date.Format("January 2006")}
+				},
+				ensureFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return "", fmt.Errorf("%s should not be created", date.Format("January 2006"))
+				},
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					return fmt.Errorf("should not be added")
+				},
+				addIncomeFunc: func(ctx context.Context, ws string, income *Income) error {
+					return fmt.Errorf("should not be added")
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Date: int(sent.Unix()), Text: tt.text}}
+			handle := h.HandleExpense
+			if IsIncome(tt.text) {
+				handle = h.HandleIncome
+			}
+			if err := handle(context.Background(), sender, update); err != nil {
+				t.Fatalf("handler unexpected error: %v", err)
+			}
+
+			if len(sender.calls) != 1 || !strings.Contains(sender.calls[0].Text, tt.wantContains) {
+				t.Errorf("replies = %+v, want one containing %q", sender.calls, tt.wantContains)
+			}
+		})
+	}
+}
+
+func TestHandleTotalUsesMessageDate(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2026, time.January, 31, 23, 59, 0, 0, time.UTC)
+
+	var gotDate time.Time
+	sheet := &mockSheet{
+		getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
+			gotDate = date
+			return "January 2026", nil
+		},
+	}
+	h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+	h.now = func() time.Time { return time.Date(2026, time.February, 1, 1, 0, 0, 0, time.UTC) }
+
+	update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Date: int(sent.Unix()), Text: "/total"}}
+	if err := h.HandleTotal(context.Background(), &mockSender{}, update); err != nil {
+		t.Fatalf("HandleTotal() unexpected error: %v", err)
 	}
 
+	if !gotDate.Equal(sent) {
+		t.Errorf("worksheet date = %v, want %v", gotDate, sent)
+	}
+}
+
+func TestHandleIncome(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
 	tests := []struct {
 		name         string
-		update       *models.Update
-		sheet        *mockSheet
+		text         string
+		addErr       error
 		wantErr      bool
-		wantCalls    int
-		wantContains []string
+		wantIncome   *Income
+		wantContains string
 	}{
 		{
-			name:   "nil message",
-			update: &models.Update{Message: nil},
-			sheet:  &mockSheet{},
+			name:         "records income and reports the net balance",
+			text:         "+Salary 3200",
+			wantIncome:   &Income{Desc: "Salary", Amount: Cents(320000), Date: sent, UserID: 42, UpdateID: 9},
+			wantContains: "💰 Received 3200,00€ from Salary. Net balance is 2900,00€",
 		},
 		{
-			name: "invalid format sends parse error",
-			update: &models.Update{
-				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "invalid"},
-			},
-			sheet:        &mockSheet{},
-			wantCalls:    1,
-			wantContains: []string{"Could not parse expense"},
+			name:         "back-dated income",
+			text:         "/income Gift 50 24.2.",
+			wantIncome:   &Income{Desc: "Gift", Amount: Cents(5000), Date: time.Date(2026, time.February, 24, 0, 0, 0, 0, time.UTC), UserID: 42, UpdateID: 9},
+			wantContains: "Received 50,00€ from Gift on 24.2.2026",
 		},
 		{
-			name: "valid expense",
-			update: &models.Update{
-				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12,50"},
-			},
-			sheet: &mockSheet{
-				getMonthlyFunc: func(ctx context.Context, worksheet string) (float64, error) {
-					return 150.50, nil
-				},
-			},
-			wantCalls:    1,
-			wantContains: []string{"12,50", "Lunch", "150,50"},
+			name:         "foreign income is converted",
+			text:         "+Freelance 1000 USD",
+			wantIncome:   &Income{Desc: "Freelance", Amount: Cents(92000), Original: Money{Cents: 100000, Currency: "USD"}, Date: sent, UserID: 42, UpdateID: 9},
+			wantContains: "💰 Received 1000,00 USD = 920,00€ from Freelance",
 		},
 		{
-			name: "worksheet error returns error",
-			update: &models.Update{
-				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
-			},
-			sheet:   &mockSheet{getWorksheetFunc: errFunc},
-			wantErr: true,
+			name:         "unparseable income",
+			text:         "+Salary",
+			wantContains: "Could not parse income",
 		},
 		{
-			name: "add expense error returns error",
-			update: &models.Update{
-				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
-			},
-			sheet: &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
-				return fmt.Errorf("fail")
-			}},
-			wantErr: true,
+			name:         "full income section",
+			text:         "+Salary 3200",
+			addErr:       ErrIncomeRowsFull,
+			wantIncome:   &Income{Desc: "Salary", Amount: Cents(320000), Date: sent, UserID: 42, UpdateID: 9},
+			wantContains: "no empty income row left in February 2026",
 		},
 		{
-			name: "monthly total error still sends response",
-			update: &models.Update{
-				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
-			},
-			sheet: &mockSheet{getMonthlyFunc: func(ctx context.Context, ws string) (float64, error) {
-				return 0, fmt.Errorf("fail")
-			}},
-			wantCalls: 1,
+			name:         "worksheet without income section",
+			text:         "+Salary 3200",
+			addErr:       ErrNoIncomeSection,
+			wantIncome:   &Income{Desc: "Salary", Amount: Cents(320000), Date: sent, UserID: 42, UpdateID: 9},
+			wantContains: "February 2026 has no income section",
+		},
+		{
+			name:       "sheet error is retried",
+			text:       "+Salary 3200",
+			addErr:     fmt.Errorf("sheets unavailable"),
+			wantIncome: &Income{Desc: "Salary", Amount: Cents(320000), Date: sent, UserID: 42, UpdateID: 9},
+			wantErr:    true,
 		},
 	}
 
@@ -197,20 +548,1567 @@ func TestHandleExpense(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
+			var gotIncome *Income
+			sheet := &mockSheet{
+				addIncomeFunc: func(ctx context.Context, ws string, income *Income) error {
+					gotIncome = income
+					return tt.addErr
+				},
+				getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+					return MonthlyTotals{Fundamentals: Cents(25000), Fun: Cents(5000), Income: Cents(320000)}, nil
+				},
+			}
 			sender := &mockSender{}
-			h := NewBotHandlers(tt.sheet, discardLogger())
-
-			err := h.HandleExpense(context.Background(), sender, tt.update)
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
 
+			update := &models.Update{ID: 9, Message: &models.Message{
+				Chat: models.Chat{ID: 1},
+				From: &models.User{ID: 42},
+				Date: int(sent.Unix()),
+				Text: tt.text,
+			}}
+			err := h.HandleIncome(context.Background(), sender, update)
 			if (err != nil) != tt.wantErr {
-				t.Fatalf("HandleExpense() error = %v, wantErr %v", err, tt.wantErr)
+				t.Fatalf("HandleIncome() error = %v, wantErr %v", err, tt.wantErr)
 			}
-			if len(sender.calls) != tt.wantCalls {
-				t.Fatalf("expected %d SendMessage calls, got %d", tt.wantCalls, len(sender.calls))
+
+			if !reflect.DeepEqual(gotIncome, tt.wantIncome) {
+				t.Errorf("AddIncome() income = %+v, want %+v", gotIncome, tt.wantIncome)
 			}
-			for _, s := range tt.wantContains {
-				if !strings.Contains(sender.calls[0].Text, s) {
-					t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+			if tt.wantContains != "" {
+				if len(sender.calls) != 1 {
+					t.Fatalf("expected 1 reply, got %d", len(sender.calls))
+				}
+				if !strings.Contains(sender.calls[0].Text, tt.wantContains) {
+					t.Errorf("response should contain %q, got %q", tt.wantContains, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleExpenseNetBalance(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		totals      MonthlyTotals
+		wantSuffix  string
+		wantMissing bool
+	}{
+		{
+			name:       "income recorded",
+			totals:     MonthlyTotals{Fundamentals: Cents(10000), Income: Cents(300000)},
+			wantSuffix: "New monthly total is 100,00€, net balance 2900,00€",
+		},
+		{
+			name:        "no income",
+			totals:      MonthlyTotals{Fundamentals: Cents(10000)},
+			wantSuffix:  "net balance",
+			wantMissing: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sheet := &mockSheet{
+				getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+					return tt.totals, nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 2.95"}}
+			if err := h.HandleExpense(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleExpense() unexpected error: %v", err)
+			}
+
+			if got := strings.Contains(sender.calls[0].Text, tt.wantSuffix); got == tt.wantMissing {
+				t.Errorf("response contains %q = %v, want %v, got %q", tt.wantSuffix, got, !tt.wantMissing, sender.calls[0].Text)
+			}
+		})
+	}
+}
+
+func TestHandleExpenseMultipleLines(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		text         string
+		wantBatches  map[string]int
+		wantContains []string
+		wantNotFound []string
+	}{
+		{
+			name:         "receipt is written in one batch",
+			text:         "Milk 1.20\nBread 2.50\nfun Cheese 4.10",
+			wantBatches:  map[string]int{"March 2026": 3},
+			wantContains: []string{"Added 3 expenses", "• Milk 1,20€ (Fundamentals)", "• Cheese 4,10€ (Fun)", "New monthly total is 100,00€"},
+			wantNotFound: []string{"Could not parse"},
+		},
+		{
+			name:         "invalid lines are listed",
+			text:         "Milk 1.20\noops",
+			wantBatches:  map[string]int{"March 2026": 1},
+			wantContains: []string{"Added 1 expense:", "• Milk 1,20€", "Could not parse:\n• oops"},
+		},
+		{
+			name:         "expenses are grouped by month",
+			text:         "Milk 1.20\nTaxi 14 27.2.\nBread 2.50",
+			wantBatches:  map[string]int{"March 2026": 2, "February 2026": 1},
+			wantContains: []string{"• Taxi 14,00€ (Fundamentals) on 27.2.2026", "New total for March 2026 is", "New total for February 2026 is"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			batches := make(map[string]int)
+			sheet := &mockSheet{
+				ensureFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return date.Format("January 2006"), nil
+				},
+				addExpensesFunc: func(ctx context.Context, ws string, expenses []*Expense) error {
+					if _, ok := batches[ws]; ok {
+						t.Errorf("AddExpenses() called twice for %q", ws)
+					}
+					for _, e := range expenses {
+						if e.UpdateID != 77 {
+							t.Errorf("expense %q UpdateID = %d, want 77", e.Desc, e.UpdateID)
+						}
+					}
+					batches[ws] = len(expenses)
+					return nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+			h.now = func() time.Time { return now }
+
+			update := &models.Update{ID: 77, Message: &models.Message{Chat: models.Chat{ID: 1}, Text: tt.text}}
+			if err := h.HandleExpense(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleExpense() unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(batches, tt.wantBatches) {
+				t.Errorf("batches = %v, want %v", batches, tt.wantBatches)
+			}
+			if len(sender.calls) != 1 {
+				t.Fatalf("expected 1 reply, got %d", len(sender.calls))
+			}
+			if sender.calls[0].ReplyMarkup != nil {
+				t.Errorf("ReplyMarkup = %v, want none for several expenses", sender.calls[0].ReplyMarkup)
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(sender.calls[0].Text, s) {
+					t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+				}
+			}
+			for _, s := range tt.wantNotFound {
+				if strings.Contains(sender.calls[0].Text, s) {
+					t.Errorf("response should not contain %q, got %q", s, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleStart(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sends welcome message with user name", func(t *testing.T) {
+		t.Parallel()
+
+		sender := &mockSender{}
+		h := NewBotHandlers(&mockSheet{}, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		update := &models.Update{
+			Message: &models.Message{
+				Chat: models.Chat{ID: 123},
+				From: &models.User{FirstName: "Alice"},
+			},
+		}
+
+		h.HandleStart(context.Background(), sender, update)
+
+		if len(sender.calls) != 1 {
+			t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
+		}
+		if !strings.Contains(sender.calls[0].Text, "Hi Alice!") {
+			t.Errorf("welcome message should contain user's first name, got %q", sender.calls[0].Text)
+		}
+	})
+
+	t.Run("nil message is no-op", func(t *testing.T) {
+		t.Parallel()
+
+		sender := &mockSender{}
+		h := NewBotHandlers(&mockSheet{}, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		h.HandleStart(context.Background(), sender, &models.Update{Message: nil})
+
+		if len(sender.calls) != 0 {
+			t.Errorf("expected 0 SendMessage calls, got %d", len(sender.calls))
+		}
+	})
+}
+
+func TestHandleExpense(t *testing.T) {
+	t.Parallel()
+
+	errFunc := func(ctx context.Context, date time.Time) (string, error) {
+		return "", fmt.Errorf("fail")
+	}
+
+	tests := []struct {
+		name         string
+		update       *models.Update
+		sheet        *mockSheet
+		wantErr      bool
+		wantCalls    int
+		wantContains []string
+	}{
+		{
+			name:   "nil message",
+			update: &models.Update{Message: nil},
+			sheet:  &mockSheet{},
+		},
+		{
+			name: "invalid format sends parse error",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "invalid"},
+			},
+			sheet:        &mockSheet{},
+			wantCalls:    1,
+			wantContains: []string{"Could not parse expense"},
+		},
+		{
+			name: "valid expense",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12,50"},
+			},
+			sheet: &mockSheet{
+				getMonthlyFunc: func(ctx context.Context, worksheet string) (MonthlyTotals, error) {
+					return MonthlyTotals{Fundamentals: Cents(10050), Fun: Cents(5000)}, nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"12,50", "Lunch", "Fundamentals", "150,50"},
+		},
+		{
+			name: "expense records sender",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, From: &models.User{ID: 42}, Text: "Lunch 12.50"},
+			},
+			sheet: &mockSheet{
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					if e.UserID != 42 {
+						return fmt.Errorf("user id = %d, want 42", e.UserID)
+					}
+					return nil
+				},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "expense crossing budget threshold warns",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Groceries 30"},
+			},
+			sheet: &mockSheet{
+				getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+					return MonthlyTotals{Fundamentals: Cents(77000), Fun: Cents(5000)}, nil
+				},
+				getBudgetFunc: func(ctx context.Context, ws string) (Budget, error) {
+					return Budget{Total: Cents(100000)}, nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Monthly budget: 180,00€ left of 1000,00€", "80% of monthly budget used"},
+		},
+		{
+			name: "budget error still sends response",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Groceries 30"},
+			},
+			sheet: &mockSheet{
+				getBudgetFunc: func(ctx context.Context, ws string) (Budget, error) {
+					return Budget{}, fmt.Errorf("fail")
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Groceries"},
+		},
+		{
+			name: "fun expense reports bucket",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Movies 12 #fun"},
+			},
+			sheet: &mockSheet{
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					if e.Category != CategoryFun {
+						return fmt.Errorf("category = %v, want Fun", e.Category)
+					}
+					return nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"12,00", "Movies", "(Fun)"},
+		},
+		{
+			name: "worksheet error returns error",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
+			},
+			sheet:   &mockSheet{getWorksheetFunc: errFunc},
+			wantErr: true,
+		},
+		{
+			name: "missing worksheet replies without retry",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
+			},
+			sheet: &mockSheet{
+				getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return "", &WorksheetNotFoundError{Title: "March 2026"}
+				},
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					return fmt.Errorf("must not write without a worksheet")
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"no worksheet for March 2026"},
+		},
+		{
+			name: "expense creates missing worksheet",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
+			},
+			sheet: &mockSheet{
+				getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return "", &WorksheetNotFoundError{Title: "March 2026"}
+				},
+				ensureFunc: func(ctx context.Context, date time.Time) (string, error) {
+					return "March 2026", nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Spent 12,50€ on Lunch"},
+		},
+		{
+			name: "calculated amount is echoed",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Dinner 45/2"},
+			},
+			sheet:        &mockSheet{},
+			wantCalls:    1,
+			wantContains: []string{"Spent 45/2 = 22,50€ on Dinner"},
+		},
+		{
+			name: "calculated amounts are echoed in the summary",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Groceries 12.40+3.99\nLunch 8"},
+			},
+			sheet:        &mockSheet{},
+			wantCalls:    1,
+			wantContains: []string{"• Groceries 12.40+3.99 = 16,39€ (Fundamentals)", "• Lunch 8,00€ (Fundamentals)"},
+		},
+		{
+			name: "foreign amount is converted to euros",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Taxi 250 SEK"},
+			},
+			sheet: &mockSheet{
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					if e.Amount != Cents(2175) || e.Original != (Money{Cents: 25000, Currency: "SEK"}) {
+						return fmt.Errorf("amount = %v, original = %v", e.Amount, e.Original)
+					}
+					return nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Spent 250,00 SEK = 21,75€ on Taxi"},
+		},
+		{
+			name: "foreign calculation shows both amounts",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "$12 Coffee\nDinner 45/2 USD"},
+			},
+			sheet:        &mockSheet{},
+			wantCalls:    1,
+			wantContains: []string{"• Coffee 12,00 USD = 11,04€", "• Dinner 45/2 = 22,50 USD = 20,70€"},
+		},
+		{
+			name: "currency without a rate is not added",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Sushi 1200 JPY"},
+			},
+			sheet: &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				return fmt.Errorf("should not be added")
+			}},
+			wantCalls:    1,
+			wantContains: []string{"exchange rate for JPY"},
+		},
+		{
+			name: "line without a rate is listed and the rest are added",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Coffee 3\nSushi 1200 JPY"},
+			},
+			sheet: &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				if e.Desc != "Coffee" {
+					return fmt.Errorf("%s should not be added", e.Desc)
+				}
+				return nil
+			}},
+			wantCalls:    1,
+			wantContains: []string{"Added 1 expense:", "• Coffee 3,00€", "No exchange rate", "• Sushi 1200,00 JPY"},
+		},
+		{
+			name: "add expense error returns error",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
+			},
+			sheet: &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				return fmt.Errorf("fail")
+			}},
+			wantErr: true,
+		},
+		{
+			name: "monthly total error still sends response",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 12.50"},
+			},
+			sheet: &mockSheet{getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+				return MonthlyTotals{}, fmt.Errorf("fail")
+			}},
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender := &mockSender{}
+			h := NewBotHandlers(tt.sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			err := h.HandleExpense(context.Background(), sender, tt.update)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleExpense() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sender.calls) != tt.wantCalls {
+				t.Fatalf("expected %d SendMessage calls, got %d", tt.wantCalls, len(sender.calls))
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(sender.calls[0].Text, s) {
+					t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleReceipt(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	photo := []models.PhotoSize{{FileID: "photo", FileUniqueID: "AQAD1", Width: 720, Height: 1280}}
+
+	tests := []struct {
+		name        string
+		caption     string
+		files       *mockFiles
+		blobs       *mockBlobStore
+		wantAdded   bool
+		wantReceipt string
+		wantStored  string
+	}{
+		{
+			name:        "stores the photo and links it to the expense",
+			caption:     "Groceries 43.20",
+			files:       &mockFiles{data: []byte("jpeg"), path: "photos/file_1.jpg"},
+			blobs:       &mockBlobStore{},
+			wantAdded:   true,
+			wantReceipt: "https://files.example.com/receipts/2026-03/AQAD1.jpg",
+			wantStored:  "receipts/2026-03/AQAD1.jpg",
+		},
+		{
+			name:      "download failure still adds the expense",
+			caption:   "Groceries 43.20",
+			files:     &mockFiles{err: fmt.Errorf("file is too big")},
+			blobs:     &mockBlobStore{},
+			wantAdded: true,
+		},
+		{
+			name:      "store failure still adds the expense",
+			caption:   "Groceries 43.20",
+			files:     &mockFiles{data: []byte("jpeg"), path: "photos/file_1.jpg"},
+			blobs:     &mockBlobStore{err: fmt.Errorf("bucket unavailable")},
+			wantAdded: true,
+		},
+		{
+			name:      "without a receipt store the expense has no link",
+			caption:   "Groceries 43.20",
+			wantAdded: true,
+		},
+		{
+			name:  "photo without caption is ignored",
+			files: &mockFiles{data: []byte("jpeg"), path: "photos/file_1.jpg"},
+			blobs: &mockBlobStore{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var added *Expense
+			sheet := &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				added = e
+				return nil
+			}}
+			var attachments Attachments
+			if tt.files != nil {
+				attachments.Files = tt.files
+			}
+			if tt.blobs != nil {
+				attachments.Receipts = tt.blobs
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), attachments, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{ID: 9, Message: &models.Message{
+				Chat:    models.Chat{ID: 1},
+				Date:    int(sent.Unix()),
+				Photo:   photo,
+				Caption: tt.caption,
+			}}
+			if err := h.HandleReceipt(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleReceipt() unexpected error: %v", err)
+			}
+
+			if (added != nil) != tt.wantAdded {
+				t.Fatalf("expense added = %v, want %v", added != nil, tt.wantAdded)
+			}
+			if !tt.wantAdded {
+				if len(sender.calls) != 0 {
+					t.Errorf("expected no reply, got %q", sender.calls[0].Text)
+				}
+				return
+			}
+			if added.Desc != "Groceries" || added.Amount != Cents(4320) || added.Receipt != tt.wantReceipt {
+				t.Errorf("added expense = %+v, want Groceries 43.20 with receipt %q", added, tt.wantReceipt)
+			}
+			if tt.wantStored != "" && tt.blobs.objects[tt.wantStored] != "jpeg" {
+				t.Errorf("stored objects = %v, want jpeg at %s", tt.blobs.objects, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestHandleReceiptSuggestion(t *testing.T) {
+	t.Parallel()
+
+	receipt := "K-MARKET KAMPPI\nMAITO 1,29\nYHTEENSÄ 4,90"
+
+	tests := []struct {
+		name         string
+		document     *models.Document
+		ocr          *mockOCR
+		blobs        *mockBlobStore
+		wantErr      bool
+		wantText     string
+		wantKeyboard bool
+	}{
+		{
+			name:         "suggests the shop and total",
+			ocr:          &mockOCR{text: receipt},
+			wantText:     "🧾 From the receipt: K-Market Kamppi 4.90\n\nConfirm to add it",
+			wantKeyboard: true,
+		},
+		{
+			name:         "suggestion carries the stored receipt",
+			ocr:          &mockOCR{text: receipt},
+			blobs:        &mockBlobStore{},
+			wantText:     "🧾 From the receipt: K-Market Kamppi 4.90\n📎 https://files.example.com/receipts/2026-03/AQAD1.jpg\n",
+			wantKeyboard: true,
+		},
+		{
+			name:     "no total found",
+			ocr:      &mockOCR{text: "THANK YOU"},
+			wantText: "I couldn't find a total on this receipt",
+		},
+		{
+			name:     "unreadable image",
+			ocr:      &mockOCR{err: fmt.Errorf("tesseract failed")},
+			wantText: "I couldn't find a total on this receipt",
+		},
+		{
+			name:     "document that is not an image is ignored",
+			document: &models.Document{FileID: "doc", FileUniqueID: "AQAD2", MimeType: "application/pdf"},
+			ocr:      &mockOCR{text: receipt},
+		},
+		{
+			name: "without ocr the photo is ignored",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			attachments := Attachments{Files: &mockFiles{data: []byte("jpeg"), path: "photos/file_1.jpg"}}
+			if tt.ocr != nil {
+				attachments.OCR = tt.ocr
+			}
+			if tt.blobs != nil {
+				attachments.Receipts = tt.blobs
+			}
+			sheet := &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				return fmt.Errorf("nothing should be added before confirming")
+			}}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), attachments, time.UTC, LocaleEuropean, discardLogger())
+
+			message := &models.Message{ID: 30, Chat: models.Chat{ID: 1}, Date: 1772442000}
+			if tt.document != nil {
+				message.Document = tt.document
+			} else {
+				message.Photo = []models.PhotoSize{{FileID: "photo", FileUniqueID: "AQAD1"}}
+			}
+			err := h.HandleReceipt(context.Background(), sender, &models.Update{ID: 9, Message: message})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleReceipt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantText == "" {
+				if len(sender.calls) != 0 {
+					t.Errorf("expected no reply, got %q", sender.calls[0].Text)
+				}
+				return
+			}
+			if len(sender.calls) != 1 {
+				t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
+			}
+			call := sender.calls[0]
+			if !strings.Contains(call.Text, tt.wantText) {
+				t.Errorf("reply should contain %q, got %q", tt.wantText, call.Text)
+			}
+			if call.ReplyParameters == nil || call.ReplyParameters.MessageID != 30 {
+				t.Errorf("reply parameters = %+v, want a reply to message 30", call.ReplyParameters)
+			}
+			if (call.ReplyMarkup != nil) != tt.wantKeyboard {
+				t.Errorf("reply markup = %v, want keyboard %v", call.ReplyMarkup, tt.wantKeyboard)
+			}
+		})
+	}
+}
+
+func TestConfirmReceipt(t *testing.T) {
+	t.Parallel()
+
+	link := "https://files.example.com/receipts/2026-03/AQAD1.jpg"
+
+	tests := []struct {
+		name       string
+		text       string
+		addErr     error
+		wantAdded  *Expense
+		wantEdit   string
+		wantAnswer string
+		wantAlert  bool
+	}{
+		{
+			name:       "adds the suggested expense with its receipt",
+			text:       receiptSuggestion("K-Market Kamppi 4.90", link),
+			wantAdded:  &Expense{Desc: "K-Market Kamppi", Amount: Cents(490), Receipt: link},
+			wantEdit:   "💸 Spent 4,90€ on K-Market Kamppi (Fundamentals)",
+			wantAnswer: "Added",
+		},
+		{
+			name:       "adds a suggestion without receipt",
+			text:       receiptSuggestion("Kiosk 2.40", ""),
+			wantAdded:  &Expense{Desc: "Kiosk", Amount: Cents(240)},
+			wantEdit:   "💸 Spent 2,40€ on Kiosk",
+			wantAnswer: "Added",
+		},
+		{
+			name:       "suggestion that was already added",
+			text:       "💸 Spent 4,90€ on K-Market Kamppi (Fundamentals). New monthly total is 100,00€",
+			wantAnswer: "Already added.",
+		},
+		{
+			name:       "second tap on a suggestion that is being added",
+			text:       receiptSuggestion("K-Market Kamppi 4.90", link),
+			addErr:     ErrAlreadyLinked,
+			wantAnswer: "Already added.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var added *Expense
+			var linked []int64
+			sheet := &mockSheet{
+				addLinkedFunc: func(ctx context.Context, ws string, e *Expense, chatID int64, messageID int) error {
+					if tt.addErr != nil {
+						return tt.addErr
+					}
+					added = e
+					linked = []int64{chatID, int64(messageID)}
+					return nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			sent := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+			update := &models.Update{ID: 77, CallbackQuery: &models.CallbackQuery{
+				ID:   "q1",
+				From: models.User{ID: 42},
+				Data: callbackConfirmReceipt,
+				Message: models.MaybeInaccessibleMessage{Message: &models.Message{
+					ID: 31, Chat: models.Chat{ID: 1}, Date: int(sent.Unix()), Text: tt.text,
+				}},
+			}}
+			if err := h.HandleCallback(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleCallback() unexpected error: %v", err)
+			}
+
+			if tt.wantAdded == nil {
+				if added != nil {
+					t.Errorf("expected nothing added, got %+v", added)
+				}
+				if len(sender.edits) != 0 {
+					t.Errorf("edits = %+v, want none", sender.edits)
+				}
+			} else {
+				tt.wantAdded.Date, tt.wantAdded.UserID, tt.wantAdded.UpdateID = sent, 42, 77
+				if added == nil || !reflect.DeepEqual(*added, *tt.wantAdded) {
+					t.Errorf("added expense = %+v, want %+v", added, tt.wantAdded)
+				}
+				if !reflect.DeepEqual(linked, []int64{1, 31}) {
+					t.Errorf("AddLinkedExpense() linked to %v, want 1, 31", linked)
+				}
+				if len(sender.edits) != 1 || !strings.Contains(sender.edits[0].Text, tt.wantEdit) {
+					t.Fatalf("edits = %+v, want one containing %q", sender.edits, tt.wantEdit)
+				}
+				if sender.edits[0].ReplyMarkup == nil {
+					t.Error("confirmation should get the expense buttons")
+				}
+			}
+
+			if len(sender.answers) != 1 || sender.answers[0].Text != tt.wantAnswer {
+				t.Errorf("answers = %+v, want %q", sender.answers, tt.wantAnswer)
+			}
+		})
+	}
+}
+
+func TestHandleEditReceiptSuggestion(t *testing.T) {
+	t.Parallel()
+
+	link := "https://files.example.com/receipts/2026-03/AQAD1.jpg"
+
+	var added *Expense
+	sheet := &mockSheet{
+		addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+			added = e
+			return nil
+		},
+		updateFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, e *Expense) (*Expense, string, error) {
+			return nil, "", fmt.Errorf("a suggestion has no expense to update")
+		},
+	}
+	sender := &mockSender{}
+	h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+	update := &models.Update{ID: 78, Message: &models.Message{
+		Chat: models.Chat{ID: 1},
+		Text: "Groceries 5.90",
+		ReplyToMessage: &models.Message{
+			ID:   31,
+			From: &models.User{IsBot: true},
+			Text: receiptSuggestion("K-Market Kamppi 4.90", link),
+		},
+	}}
+	if err := h.HandleEdit(context.Background(), sender, update); err != nil {
+		t.Fatalf("HandleEdit() unexpected error: %v", err)
+	}
+
+	if added == nil || added.Desc != "Groceries" || added.Amount != Cents(590) || added.Receipt != link {
+		t.Errorf("added expense = %+v, want Groceries 5.90 with the receipt", added)
+	}
+	if len(sender.calls) != 1 || !strings.Contains(sender.calls[0].Text, "Spent 5,90€ on Groceries") {
+		t.Errorf("replies = %+v, want the expense confirmation", sender.calls)
+	}
+	if len(sender.edits) != 1 || sender.edits[0].MessageID != 31 || sender.edits[0].ReplyMarkup != nil {
+		t.Errorf("edits = %+v, want the suggestion without its buttons", sender.edits)
+	}
+}
+
+func TestHandleEditReceiptSuggestionNotAdded(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		text        string
+		wantContain string
+	}{
+		{name: "reply that can't be parsed", text: "Groceries", wantContain: "Could not parse expense"},
+		{name: "currency without a rate", text: "Groceries 590 JPY", wantContain: "exchange rate for JPY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sheet := &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				return fmt.Errorf("%s should not be added", e.Desc)
+			}}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{ID: 78, Message: &models.Message{
+				Chat: models.Chat{ID: 1},
+				Text: tt.text,
+				ReplyToMessage: &models.Message{
+					ID:   31,
+					From: &models.User{IsBot: true},
+					Text: receiptSuggestion("K-Market Kamppi 4.90", "https://files.example.com/receipts/2026-03/AQAD1.jpg"),
+				},
+			}}
+			if err := h.HandleEdit(context.Background(), sender, update); err != nil {
+				t.Fatalf("HandleEdit() unexpected error: %v", err)
+			}
+
+			if len(sender.calls) != 1 || !strings.Contains(sender.calls[0].Text, tt.wantContain) {
+				t.Errorf("replies = %+v, want one containing %q", sender.calls, tt.wantContain)
+			}
+			if len(sender.edits) != 0 {
+				t.Errorf("edits = %+v, want the suggestion left as it is", sender.edits)
+			}
+		})
+	}
+}
+
+func TestHandleEdit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		text         string
+		updateErr    error
+		wantErr      bool
+		wantUpdate   bool
+		wantContains string
+	}{
+		{
+			name:         "changes the linked expense",
+			text:         "Lunch 3.95",
+			wantUpdate:   true,
+			wantContains: "✏️ Changed Lunch 2,95€ to Lunch 3,95€ (Fundamentals). New monthly total is 100,00€",
+		},
+		{
+			name:         "bare amount keeps the description",
+			text:         "3.95",
+			wantUpdate:   true,
+			wantContains: "✏️ Changed Lunch 2,95€ to Lunch 3,95€",
+		},
+		{
+			name:         "foreign amount is converted",
+			text:         "$5",
+			wantUpdate:   true,
+			wantContains: "✏️ Changed Lunch 2,95€ to Lunch 5,00 USD = 4,60€",
+		},
+		{
+			name:         "currency without a rate",
+			text:         "500 JPY",
+			wantContains: "exchange rate for JPY",
+		},
+		{
+			name:         "unparseable correction",
+			text:         "more like four",
+			wantContains: "Could not parse the correction",
+		},
+		{
+			name:         "message without expense",
+			text:         "Lunch 3.95",
+			updateErr:    ErrExpenseNotFound,
+			wantUpdate:   true,
+			wantContains: "no expense I can change",
+		},
+		{
+			name:         "several expenses without a matching description",
+			text:         "Eggs 3.95",
+			updateErr:    ErrAmbiguousExpense,
+			wantUpdate:   true,
+			wantContains: "lists several expenses",
+		},
+		{
+			name:       "sheet error is retried",
+			text:       "Lunch 3.95",
+			updateErr:  fmt.Errorf("sheets unavailable"),
+			wantUpdate: true,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var gotChat int64
+			var gotMessage int
+			var gotExpense *Expense
+			sheet := &mockSheet{
+				updateFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, e *Expense) (*Expense, string, error) {
+					gotChat, gotMessage, gotExpense = chatID, messageID, e
+					if tt.updateErr != nil {
+						return nil, "", tt.updateErr
+					}
+					return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{Message: &models.Message{
+				Chat:           models.Chat{ID: 1},
+				Text:           tt.text,
+				ReplyToMessage: &models.Message{ID: 5},
+			}}
+			err := h.HandleEdit(context.Background(), sender, update)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleEdit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (gotExpense != nil) != tt.wantUpdate {
+				t.Fatalf("UpdateExpense() called = %v, want %v", gotExpense != nil, tt.wantUpdate)
+			}
+			if tt.wantUpdate && (gotChat != 1 || gotMessage != 5) {
+				t.Errorf("UpdateExpense() message = %d/%d, want 1/5", gotChat, gotMessage)
+			}
+			if tt.wantContains != "" {
+				if len(sender.calls) != 1 {
+					t.Fatalf("expected 1 reply, got %d", len(sender.calls))
+				}
+				if !strings.Contains(sender.calls[0].Text, tt.wantContains) {
+					t.Errorf("response should contain %q, got %q", tt.wantContains, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleExpenseLinksConfirmation(t *testing.T) {
+	t.Parallel()
+
+	var gotWorksheet string
+	var gotUpdate, gotChat int64
+	var gotMessage int
+	sheet := &mockSheet{
+		linkMessageFunc: func(ctx context.Context, ws string, updateID, chatID int64, messageID int) error {
+			gotWorksheet, gotUpdate, gotChat, gotMessage = ws, updateID, chatID, messageID
+			return fmt.Errorf("link failures are only logged")
+		},
+	}
+	sender := &mockSender{
+		sendFunc: func(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+			return &models.Message{ID: 321, Chat: models.Chat{ID: 1}}, nil
+		},
+	}
+	h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+	update := &models.Update{ID: 77, Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 2.95"}}
+	if err := h.HandleExpense(context.Background(), sender, update); err != nil {
+		t.Fatalf("HandleExpense() unexpected error: %v", err)
+	}
+
+	if gotWorksheet != "February 2026" || gotUpdate != 77 || gotChat != 1 || gotMessage != 321 {
+		t.Errorf("LinkMessage() = %q, %d, %d, %d, want February 2026, 77, 1, 321", gotWorksheet, gotUpdate, gotChat, gotMessage)
+	}
+
+	keyboard, ok := sender.calls[0].ReplyMarkup.(*models.InlineKeyboardMarkup)
+	if !ok {
+		t.Fatalf("ReplyMarkup = %T, want *models.InlineKeyboardMarkup", sender.calls[0].ReplyMarkup)
+	}
+	var data []string
+	for _, button := range keyboard.InlineKeyboard[0] {
+		data = append(data, button.CallbackData)
+	}
+	if want := []string{callbackUndo, "move:fun", callbackAmount}; !reflect.DeepEqual(data, want) {
+		t.Errorf("button data = %v, want %v", data, want)
+	}
+}
+
+func TestHandleCallback(t *testing.T) {
+	t.Parallel()
+
+	confirmation := &models.Message{ID: 5, Chat: models.Chat{ID: 1}, Date: 1772409600}
+
+	tests := []struct {
+		name        string
+		data        string
+		message     *models.Message
+		sheetErr    error
+		wantErr     bool
+		wantDeleted bool
+		wantMoves   []Category
+		wantEdit    string
+		wantAnswer  string
+		wantAlert   bool
+	}{
+		{
+			name:        "undo removes the expense",
+			data:        callbackUndo,
+			message:     confirmation,
+			wantDeleted: true,
+			wantEdit:    "↩️ Removed 2,95€ on Lunch (Fundamentals). New monthly total is 100,00€",
+			wantAnswer:  "Removed",
+		},
+		{
+			name:        "undo of a removed expense",
+			data:        callbackUndo,
+			message:     confirmation,
+			sheetErr:    ErrExpenseNotFound,
+			wantDeleted: true,
+			wantAnswer:  "Already removed.",
+		},
+		{
+			name:       "move to Fun",
+			data:       "move:fun",
+			message:    confirmation,
+			wantMoves:  []Category{CategoryFun},
+			wantEdit:   "💸 Spent 2,95€ on Lunch (Fun). New monthly total is 100,00€",
+			wantAnswer: "Moved to Fun",
+		},
+		{
+			name:       "move of a removed expense",
+			data:       "move:fundamentals",
+			message:    confirmation,
+			sheetErr:   ErrExpenseNotFound,
+			wantMoves:  []Category{CategoryFundamentals},
+			wantAnswer: "This expense was removed.",
+		},
+		{
+			name:        "undo of a message with several expenses",
+			data:        callbackUndo,
+			message:     confirmation,
+			sheetErr:    ErrAmbiguousExpense,
+			wantDeleted: true,
+			wantAnswer:  "That message lists several expenses",
+			wantAlert:   true,
+		},
+		{
+			name:       "move of a message with several expenses",
+			data:       "move:fun",
+			message:    confirmation,
+			sheetErr:   ErrAmbiguousExpense,
+			wantMoves:  []Category{CategoryFun},
+			wantAnswer: "That message lists several expenses",
+			wantAlert:  true,
+		},
+		{
+			name:       "change amount explains how",
+			data:       callbackAmount,
+			message:    confirmation,
+			wantAnswer: "Reply to the message with the new amount",
+			wantAlert:  true,
+		},
+		{
+			name:       "inaccessible message",
+			data:       callbackUndo,
+			wantAnswer: "This message is too old to change.",
+		},
+		{
+			name:        "sheet error is retried",
+			data:        callbackUndo,
+			message:     confirmation,
+			sheetErr:    fmt.Errorf("sheets unavailable"),
+			wantDeleted: true,
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			deleted := false
+			var moves []Category
+			sheet := &mockSheet{
+				deleteFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error) {
+					deleted = true
+					if chatID != 1 || messageID != 5 {
+						t.Errorf("DeleteExpense() message = %d/%d, want 1/5", chatID, messageID)
+					}
+					if !sentAt.Equal(time.Unix(1772409600, 0)) {
+						t.Errorf("DeleteExpense() sentAt = %v, want the time of the confirmation", sentAt)
+					}
+					if tt.sheetErr != nil {
+						return nil, "", tt.sheetErr
+					}
+					return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+				},
+				moveFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, category Category) (*Expense, string, error) {
+					moves = append(moves, category)
+					if tt.sheetErr != nil {
+						return nil, "", tt.sheetErr
+					}
+					return &Expense{Desc: "Lunch", Amount: Cents(295), Category: category}, "February 2026", nil
+				},
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{CallbackQuery: &models.CallbackQuery{
+				ID:      "q1",
+				From:    models.User{ID: 42},
+				Data:    tt.data,
+				Message: models.MaybeInaccessibleMessage{Message: tt.message},
+			}}
+			err := h.HandleCallback(context.Background(), sender, update)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleCallback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if deleted != tt.wantDeleted {
+				t.Errorf("DeleteExpense() called = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if !reflect.DeepEqual(moves, tt.wantMoves) {
+				t.Errorf("MoveExpense() categories = %v, want %v", moves, tt.wantMoves)
+			}
+
+			if tt.wantEdit == "" {
+				if len(sender.edits) != 0 {
+					t.Errorf("expected no edits, got %q", sender.edits[0].Text)
+				}
+			} else {
+				if len(sender.edits) != 1 {
+					t.Fatalf("expected 1 edit, got %d", len(sender.edits))
+				}
+				if !strings.Contains(sender.edits[0].Text, tt.wantEdit) {
+					t.Errorf("edit should contain %q, got %q", tt.wantEdit, sender.edits[0].Text)
+				}
+			}
+
+			if tt.wantErr {
+				return
+			}
+			if len(sender.answers) != 1 {
+				t.Fatalf("expected 1 answer, got %d", len(sender.answers))
+			}
+			answer := sender.answers[0]
+			if answer.CallbackQueryID != "q1" || !strings.HasPrefix(answer.Text, tt.wantAnswer) || answer.ShowAlert != tt.wantAlert {
+				t.Errorf("answer = %q (alert %v), want %q (alert %v)", answer.Text, answer.ShowAlert, tt.wantAnswer, tt.wantAlert)
+			}
+		})
+	}
+}
+
+func TestHandleUndo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		update       *models.Update
+		sheet        *mockSheet
+		wantErr      bool
+		wantCalls    int
+		wantContains []string
+	}{
+		{
+			name:   "nil message",
+			update: &models.Update{Message: nil},
+			sheet:  &mockSheet{},
+		},
+		{
+			name: "removes last expense",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, From: &models.User{ID: 42}, Text: "/undo"},
+			},
+			sheet: &mockSheet{
+				deleteLastFunc: func(ctx context.Context, ws string, userID int64) (*Expense, error) {
+					if userID != 42 {
+						return nil, fmt.Errorf("user id = %d, want 42", userID)
+					}
+					return &Expense{Desc: "Movies", Amount: Cents(1200), Category: CategoryFun}, nil
+				},
+				getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+					return MonthlyTotals{Fundamentals: Cents(8800)}, nil
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Removed", "12,00", "Movies", "(Fun)", "88,00"},
+		},
+		{
+			name: "nothing to undo",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, From: &models.User{ID: 42}, Text: "/undo"},
+			},
+			sheet: &mockSheet{
+				deleteLastFunc: func(ctx context.Context, ws string, userID int64) (*Expense, error) {
+					return nil, ErrNothingToUndo
+				},
+			},
+			wantCalls:    1,
+			wantContains: []string{"Nothing to undo"},
+		},
+		{
+			name: "delete error returns error",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, From: &models.User{ID: 42}, Text: "/undo"},
+			},
+			sheet: &mockSheet{
+				deleteLastFunc: func(ctx context.Context, ws string, userID int64) (*Expense, error) {
+					return nil, fmt.Errorf("fail")
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender := &mockSender{}
+			h := NewBotHandlers(tt.sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			err := h.HandleUndo(context.Background(), sender, tt.update)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleUndo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(sender.calls) != tt.wantCalls {
+				t.Fatalf("expected %d SendMessage calls, got %d", tt.wantCalls, len(sender.calls))
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(sender.calls[0].Text, s) {
+					t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleReport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		expenses     []*Expense
+		expensesErr  error
+		wantErr      bool
+		wantHTML     bool
+		wantContains []string
+	}{
+		{
+			name:         "breaks down spending by item",
+			expenses:     []*Expense{{Desc: "Rent", Amount: Cents(90000)}, {Desc: "Lunch", Amount: Cents(6000)}, {Desc: "lunch", Amount: Cents(4000)}},
+			wantHTML:     true,
+			wantContains: []string{"February 2026 by item", "<pre>", "Lunch 2  100,00   10%", "Total 3 1000,00  100%"},
+		},
+		{
+			name:         "empty month",
+			wantContains: []string{"There are no expenses in February 2026 yet."},
+		},
+		{
+			name:        "sheet error is retried",
+			expensesErr: fmt.Errorf("fail"),
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sender := &mockSender{}
+			sheet := &mockSheet{
+				getExpensesFunc: func(ctx context.Context, ws string) ([]*Expense, error) {
+					return tt.expenses, tt.expensesErr
+				},
+			}
+			h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+			update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/report"}}
+			err := h.HandleReport(context.Background(), sender, update)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(sender.calls) != 0 {
+					t.Errorf("expected 0 SendMessage calls, got %d", len(sender.calls))
+				}
+				return
+			}
+
+			if len(sender.calls) != 1 {
+				t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
+			}
+			if html := sender.calls[0].ParseMode == models.ParseModeHTML; html != tt.wantHTML {
+				t.Errorf("HTML parse mode = %v, want %v", html, tt.wantHTML)
+			}
+			for _, s := range tt.wantContains {
+				if !strings.Contains(sender.calls[0].Text, s) {
+					t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleCompare(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2026, time.March, 31, 23, 30, 0, 0, time.UTC)
+
+	var gotDate time.Time
+	var gotMonths int
+	sheet := &mockSheet{
+		getHistoryFunc: func(ctx context.Context, date time.Time, months int) ([]MonthTotals, error) {
+			gotDate, gotMonths = date, months
+			return []MonthTotals{
+				{Title: "March 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(20000)}},
+				{Title: "February 2026", Found: true, Totals: MonthlyTotals{Fundamentals: Cents(10000)}},
+			}, nil
+		},
+	}
+	sender := &mockSender{}
+	h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+	update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Date: int(sent.Unix()), Text: "/compare"}}
+	if err := h.HandleCompare(context.Background(), sender, update); err != nil {
+		t.Fatalf("HandleCompare() unexpected error: %v", err)
+	}
+
+	if !gotDate.Equal(sent) || gotMonths != averagedMonths+1 {
+		t.Errorf("GetMonthlyHistory() = %v, %d, want %v, %d", gotDate, gotMonths, sent, averagedMonths+1)
+	}
+	if len(sender.calls) != 1 {
+		t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
+	}
+	if sender.calls[0].ParseMode != models.ParseModeHTML {
+		t.Errorf("ParseMode = %q, want HTML", sender.calls[0].ParseMode)
+	}
+	for _, s := range []string{"March 2026 compared", "Total            200,00     100,00   100,00", "100% above last month"} {
+		if !strings.Contains(sender.calls[0].Text, s) {
+			t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+		}
+	}
+
+	t.Run("missing worksheet", func(t *testing.T) {
+		t.Parallel()
+
+		sheet := &mockSheet{
+			getHistoryFunc: func(ctx context.Context, date time.Time, months int) ([]MonthTotals, error) {
+				return nil, &WorksheetNotFoundError{Title: "March 2026"}
+			},
+		}
+		sender := &mockSender{}
+		h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		if err := h.HandleCompare(context.Background(), sender, update); err != nil {
+			t.Fatalf("HandleCompare() unexpected error: %v", err)
+		}
+		if len(sender.calls) != 1 || !strings.Contains(sender.calls[0].Text, "no worksheet for March 2026") {
+			t.Errorf("expected missing worksheet reply, got %v", sender.calls)
+		}
+	})
+}
+
+func TestHandleTotal(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports breakdown", func(t *testing.T) {
+		t.Parallel()
+
+		sender := &mockSender{}
+		sheet := &mockSheet{
+			getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+				return MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(4550)}, nil
+			},
+			addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				return fmt.Errorf("/total must not write")
+			},
+		}
+		h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/total"}}
+		if err := h.HandleTotal(context.Background(), sender, update); err != nil {
+			t.Fatalf("HandleTotal() unexpected error: %v", err)
+		}
+
+		if len(sender.calls) != 1 {
+			t.Fatalf("expected 1 SendMessage call, got %d", len(sender.calls))
+		}
+		for _, s := range []string{"February 2026", "Fundamentals: 600,00", "Fun: 45,50", "Total: 645,50"} {
+			if !strings.Contains(sender.calls[0].Text, s) {
+				t.Errorf("response should contain %q, got %q", s, sender.calls[0].Text)
+			}
+		}
+	})
+
+	t.Run("reports income and net balance", func(t *testing.T) {
+		t.Parallel()
+
+		sender := &mockSender{}
+		sheet := &mockSheet{
+			getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+				return MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(4550), Income: Cents(300000)}, nil
+			},
+		}
+		h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/total"}}
+		if err := h.HandleTotal(context.Background(), sender, update); err != nil {
+			t.Fatalf("HandleTotal() unexpected error: %v", err)
+		}
+
+		if !strings.HasSuffix(sender.calls[0].Text, "Total: 645,50€\n\nIncome: 3000,00€\nNet: 2354,50€") {
+			t.Errorf("response should end with income and net, got %q", sender.calls[0].Text)
+		}
+	})
+
+	t.Run("totals error returns error", func(t *testing.T) {
+		t.Parallel()
+
+		sender := &mockSender{}
+		sheet := &mockSheet{
+			getMonthlyFunc: func(ctx context.Context, ws string) (MonthlyTotals, error) {
+				return MonthlyTotals{}, fmt.Errorf("fail")
+			},
+		}
+		h := NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, discardLogger())
+
+		update := &models.Update{Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/total"}}
+		if err := h.HandleTotal(context.Background(), sender, update); err == nil {
+			t.Fatal("HandleTotal() expected error, got nil")
+		}
+		if len(sender.calls) != 0 {
+			t.Errorf("expected 0 SendMessage calls, got %d", len(sender.calls))
+		}
+	})
+}
+
+func TestHandleVoice(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		duration    int
+		files       *mockFiles
+		transcriber *mockTranscriber
+		wantErr     bool
+		wantAdded   *Expense
+		wantReplies []string
+	}{
+		{
+			name:        "adds the spoken expense and echoes the transcription",
+			transcriber: &mockTranscriber{text: " Lunch, 12.50 euros."},
+			wantAdded:   &Expense{Desc: "Lunch", Amount: Cents(1250)},
+			wantReplies: []string{"🎙️ I heard: Lunch 12.50", "Lunch"},
+		},
+		{
+			name:        "spoken category",
+			transcriber: &mockTranscriber{text: "Fun, cinema 15."},
+			wantAdded:   &Expense{Desc: "cinema", Amount: Cents(1500), Category: CategoryFun},
+			wantReplies: []string{"🎙️ I heard: Fun cinema 15", "cinema"},
+		},
+		{
+			name:        "transcription without an amount",
+			transcriber: &mockTranscriber{text: "Lunch at the office."},
+			wantReplies: []string{"🎙️ I heard: Lunch at the office", "Could not parse expense"},
+		},
+		{
+			name:        "silence",
+			transcriber: &mockTranscriber{text: " . "},
+			wantReplies: []string{"I couldn't hear an expense in that"},
+		},
+		{
+			name:        "transcriber failure",
+			transcriber: &mockTranscriber{err: fmt.Errorf("connection refused")},
+			wantReplies: []string{"I couldn't transcribe that voice message"},
+		},
+		{
+			name:        "too long",
+			duration:    maxVoiceDuration + 1,
+			transcriber: &mockTranscriber{text: "Lunch 12.50"},
+			wantReplies: []string{"That voice message is too long"},
+		},
+		{
+			name:        "download failure is retried",
+			files:       &mockFiles{err: fmt.Errorf("telegram unavailable")},
+			transcriber: &mockTranscriber{text: "Lunch 12.50"},
+			wantErr:     true,
+		},
+		{
+			name: "without a transcriber the voice message is ignored",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var added *Expense
+			sheet := &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+				added = e
+				return nil
+			}}
+			attachments := Attachments{Files: &mockFiles{data: []byte("ogg"), path: "voice/file_7.oga"}}
+			if tt.files != nil {
+				attachments.Files = tt.files
+			}
+			if tt.transcriber != nil {
+				attachments.Voice = tt.transcriber
+			}
+			sender := &mockSender{}
+			h := NewBotHandlers(sheet, testRates(), attachments, time.UTC, LocaleEnglish, discardLogger())
+
+			update := &models.Update{ID: 9, Message: &models.Message{
+				Chat:  models.Chat{ID: 1},
+				Date:  1772442000,
+				Voice: &models.Voice{FileID: "voice", FileUniqueID: "AwAD1", Duration: tt.duration},
+			}}
+			err := h.HandleVoice(context.Background(), sender, update)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("HandleVoice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (added != nil) != (tt.wantAdded != nil) {
+				t.Fatalf("expense added = %+v, want %+v", added, tt.wantAdded)
+			}
+			if added != nil {
+				if added.Desc != tt.wantAdded.Desc || added.Amount != tt.wantAdded.Amount || added.Category != tt.wantAdded.Category {
+					t.Errorf("added expense = %+v, want %+v", added, tt.wantAdded)
+				}
+				if added.UpdateID != 9 {
+					t.Errorf("added expense UpdateID = %d, want 9", added.UpdateID)
+				}
+			}
+			if added != nil && tt.transcriber.fileName != "voice.oga" {
+				t.Errorf("transcribed file name = %q, want voice.oga", tt.transcriber.fileName)
+			}
+
+			if len(sender.calls) != len(tt.wantReplies) {
+				t.Fatalf("expected %d SendMessage calls, got %d", len(tt.wantReplies), len(sender.calls))
+			}
+			for i, want := range tt.wantReplies {
+				if !strings.Contains(sender.calls[i].Text, want) {
+					t.Errorf("reply %d should contain %q, got %q", i, want, sender.calls[i].Text)
 				}
 			}
 		})
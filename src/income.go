@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var incomePrefixPattern = regexp.MustCompile(`(?i)^(\+\s*|/income(@\w+)?(\s+|$))`)
+
+// Label of the row that starts the income section, above the income rows
+const incomeHeader = "Income"
+
+// Income is money received during the month, written to the rows above "Total Net income"
+type Income struct {
+	Desc     string
+	Amount   Money
+	Original Money     // Amount as received in another currency before conversion, zero if received in euros
+	Date     time.Time // Day the money was received, zero if the message did not say
+	UserID   int64     // Telegram user who sent the income, set by the handler
+	UpdateID int64     // Telegram update that carried the income, set by the handler
+}
+
+// IsIncome reports whether a message records income rather than an expense
+func IsIncome(message string) bool {
+	return incomePrefixPattern.MatchString(strings.TrimSpace(message))
+}
+
+// ParseIncome parses income from a message in the format "+<Desc> <Amount>" or "/income <Desc> <Amount>"
+// Dates are accepted like in expenses
+// Example message: "+Salary 3200", "/income Refund 12.50" or "+Gift 50 24.12."
+func ParseIncome(message string, now time.Time, locale AmountLocale) (*Income, error) {
+	message = strings.TrimSpace(message)
+	if !incomePrefixPattern.MatchString(message) {
+		return nil, fmt.Errorf("missing income prefix")
+	}
+	message = strings.TrimSpace(incomePrefixPattern.ReplaceAllString(message, ""))
+	if message == "" {
+		return nil, fmt.Errorf("empty message")
+	}
+
+	message, date, err := extractDate(message, now)
+	if err != nil {
+		return nil, err
+	}
+
+	message, currency := extractCurrency(message)
+
+	desc, amountText, ok := splitAmount(message)
+	if !ok {
+		return nil, fmt.Errorf("invalid income format")
+	}
+
+	amount, err := parseAmount(amountText, locale)
+	if err != nil {
+		return nil, err
+	}
+	amount.Currency = currency
+
+	return &Income{
+		Desc:   desc,
+		Amount: amount,
+		Date:   date,
+	}, nil
+}
+
+// Returns the 0-indexed bounds of the income rows: after the "Income" header up to the "Total Net income" row
+// Without the header there is no income section, the rows above the table may hold titles or notes
+func incomeSection(labels []string) (int, int, bool) {
+	startRow, ok := findExpenseStartRow(labels)
+	if !ok {
+		return 0, 0, false
+	}
+	end := startRow - 2 // The "Total Net income" row
+
+	start := -1
+	for i := range end {
+		if strings.EqualFold(labels[i], incomeHeader) {
+			start = i + 1
+		}
+	}
+	if start < 0 {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
+
+// Finds the first empty row of the income section
+// Returns a 1-indexed row number for the Sheets API
+func freeIncomeRow(labels, amounts []string) (int, bool) {
+	start, end, ok := incomeSection(labels)
+	if !ok {
+		return 0, false
+	}
+
+	for i := start; i < end; i++ {
+		if labels[i] == "" && (i >= len(amounts) || amounts[i] == "") {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// Sums the income rows, leaving out budget rows that share the section
+// Also returns the amounts that are not numbers
+func sumIncome(labels []string, amounts []any, locale AmountLocale) (Money, []invalidAmount) {
+	start, end, ok := incomeSection(labels)
+	if !ok {
+		return Money{}, nil
+	}
+
+	var total Money
+	var invalid []invalidAmount
+	for i := start; i < end && i < len(amounts); i++ {
+		if labels[i] == "" || isEmptyCell(amounts[i]) || isBudgetLabel(labels[i]) {
+			continue
+		}
+
+		amount, ok := parseSheetAmount(amounts[i], locale)
+		if !ok {
+			invalid = append(invalid, invalidAmount{cell: fmt.Sprintf("B%d", i+1), row: i + 1, value: fmt.Sprintf("%v", amounts[i])})
+			continue
+		}
+		total = total.Add(amount)
+	}
+	return total, invalid
+}
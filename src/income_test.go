@@ -0,0 +1,215 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsIncome(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{message: "+Salary 3200", want: true},
+		{message: "+ Salary 3200", want: true},
+		{message: "/income Salary 3200", want: true},
+		{message: "/income@accountant_bot Salary 3200", want: true},
+		{message: "/income", want: true},
+		{message: "Salary 3200", want: false},
+		{message: "/incomes", want: false},
+		{message: "Lunch +2.95", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			t.Parallel()
+
+			if got := IsIncome(tt.message); got != tt.want {
+				t.Errorf("IsIncome(%q) = %v, want %v", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIncome(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		message string
+		want    *Income
+		wantErr bool
+	}{
+		{
+			name:    "plus prefix",
+			message: "+Salary 3200",
+			want:    &Income{Desc: "Salary", Amount: Cents(320000)},
+		},
+		{
+			name:    "income command",
+			message: "/income Tax refund 120,50",
+			want:    &Income{Desc: "Tax refund", Amount: Cents(12050)},
+		},
+		{
+			name:    "with date",
+			message: "+Gift 50 24.2.",
+			want:    &Income{Desc: "Gift", Amount: Cents(5000), Date: time.Date(2026, time.February, 24, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:    "shared refund with spaces",
+			message: "+Refund 30 / 2",
+			want:    &Income{Desc: "Refund", Amount: Cents(1500)},
+		},
+		{
+			name:    "command without income",
+			message: "/income",
+			wantErr: true,
+		},
+		{
+			name:    "missing amount",
+			message: "+Salary",
+			wantErr: true,
+		},
+		{
+			name:    "expense message",
+			message: "Lunch 2.95",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseIncome(tt.message, now, LocaleEuropean)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseIncome() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseIncome() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeIncomeRow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		labels  []string
+		amounts []string
+		want    int
+		wantOK  bool
+	}{
+		{
+			name:    "first empty row below the header",
+			labels:  []string{"", "Income", "Salary", "", "", "Total Net income", "Header"},
+			amounts: []string{"", "", "3000", "", "", "3000"},
+			want:    4,
+			wantOK:  true,
+		},
+		{
+			name:    "rows with only an amount are taken",
+			labels:  []string{"Income", "", "", "Total Net income"},
+			amounts: []string{"", "100", ""},
+			want:    3,
+			wantOK:  true,
+		},
+		{
+			name:    "no header is no income section",
+			labels:  []string{"", "Budget", "Total Net income"},
+			amounts: []string{"", "2000"},
+		},
+		{
+			name:    "full section",
+			labels:  []string{"Income", "Salary", "Total Net income"},
+			amounts: []string{"", "3000"},
+		},
+		{
+			name:   "no anchor",
+			labels: []string{"Income", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := freeIncomeRow(tt.labels, tt.amounts)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("freeIncomeRow() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSumIncome(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		labels      []string
+		amounts     []any
+		want        Money
+		wantInvalid []invalidAmount
+	}{
+		{
+			name:    "sums income rows",
+			labels:  []string{"Income", "Salary", "Refund", "", "Total Net income", "Header", "Rent"},
+			amounts: []any{"", "3000", "12,50", "", "3012.50", "", "900"},
+			want:    Cents(301250),
+		},
+		{
+			name:    "skips budget rows and rows above the header",
+			labels:  []string{"Budget", "Income", "Salary", "Fun budget", "Total Net income"},
+			amounts: []any{"2000", "", "3000", "300", ""},
+			want:    Cents(300000),
+		},
+		{
+			name:        "reports amounts that are not numbers",
+			labels:      []string{"Income", "Salary", "Bonus", "Total Net income"},
+			amounts:     []any{"", "3 000,00 €", "TBD", ""},
+			want:        Cents(300000),
+			wantInvalid: []invalidAmount{{cell: "B3", row: 3, value: "TBD"}},
+		},
+		{
+			name:    "numbers from formulas are rounded to cents",
+			labels:  []string{"Income", "Salary", "Interest", "Total Net income"},
+			amounts: []any{nil, 1.234, 10.0 / 3},
+			want:    Cents(456),
+		},
+		{
+			name:    "no anchor",
+			labels:  []string{"Income", "Salary"},
+			amounts: []any{"", "3000"},
+		},
+		{
+			name:    "numbers without an income header are not income",
+			labels:  []string{"Household 2026", "Savings goal", "Total Net income"},
+			amounts: []any{nil, 5000.0, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, invalid := sumIncome(tt.labels, tt.amounts, LocaleEuropean)
+			if got != tt.want {
+				t.Errorf("sumIncome() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(invalid, tt.wantInvalid) {
+				t.Errorf("sumIncome() invalid = %v, want %v", invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	_ "time/tzdata" // The Lambda image has no zoneinfo
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -14,9 +15,11 @@ import (
 )
 
 type app struct {
-	sender   Sender
-	handlers *BotHandlers
-	logger   *slog.Logger
+	sender    Sender
+	botID     int64
+	handlers  *BotHandlers
+	allowlist *Allowlist
+	logger    *slog.Logger
 }
 
 func newApp() (*app, error) {
@@ -30,22 +33,62 @@ func newApp() (*app, error) {
 	}))
 
 	ctx := context.Background()
-	sheetsService, err := NewSheetsService(ctx, config.GoogleCredentialsJSON, config.GoogleSpreadsheetID, logger)
+	sheetsService, err := NewSheetsService(ctx, config.GoogleCredentialsJSON, SheetsOptions{
+		SpreadsheetID: config.GoogleSpreadsheetID,
+		DefaultBudget: config.Budget,
+		TitleFormat:   config.WorksheetTitleFormat,
+		Location:      config.Location,
+		Template:      config.TemplateWorksheet,
+		Locale:        config.AmountLocale,
+
+		FundamentalsDateColumn: config.FundamentalsDateColumn,
+		FunDateColumn:          config.FunDateColumn,
+
+		FundamentalsOriginalColumn: config.FundamentalsOriginalColumn,
+		FunOriginalColumn:          config.FunOriginalColumn,
+
+		FundamentalsReceiptColumn: config.FundamentalsReceiptColumn,
+		FunReceiptColumn:          config.FunReceiptColumn,
+	}, logger)
 	if err != nil {
 		return nil, fmt.Errorf("create sheets service: %w", err)
 	}
 
-	handlers := NewBotHandlers(sheetsService, logger)
+	rates, err := LoadStaticRates(config.ExchangeRatesFile)
+	if err != nil {
+		return nil, fmt.Errorf("load exchange rates: %w", err)
+	}
 
 	telegramBot, err := bot.New(config.TelegramBotToken)
 	if err != nil {
 		return nil, fmt.Errorf("create telegram bot: %w", err)
 	}
 
+	receipts, err := newReceiptStore(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("create receipt store: %w", err)
+	}
+
+	attachments := Attachments{Files: NewTelegramFiles(telegramBot), Receipts: receipts}
+	if config.OCREngine == OCREngineTesseract {
+		attachments.OCR = NewTesseractOCR(config.TesseractPath, config.OCRLanguages)
+	}
+	if config.Transcriber == TranscriberWhisper {
+		attachments.Voice = NewWhisperServer(config.WhisperURL, config.WhisperLanguage)
+	}
+	handlers := NewBotHandlers(sheetsService, rates, attachments, config.Location, config.AmountLocale, logger)
+
+	allowlist := NewAllowlist(config.AllowedUserIDs, config.AllowedChatIDs)
+	if allowlist.Empty() {
+		logger.Warn("ALLOWED_USER_IDS and ALLOWED_CHAT_IDS are both empty, every message will be refused")
+	}
+
 	return &app{
-		sender:   telegramBot,
-		handlers: handlers,
-		logger:   logger,
+		sender:    telegramBot,
+		botID:     telegramBot.ID(),
+		handlers:  handlers,
+		allowlist: allowlist,
+		logger:    logger,
 	}, nil
 }
 
@@ -81,20 +124,82 @@ func (a *app) handleRequest(ctx context.Context, event events.SQSEvent) (events.
 }
 
 func (a *app) processUpdate(ctx context.Context, update *models.Update) error {
+	if query := update.CallbackQuery; query != nil {
+		var chatID int64
+		if query.Message.Message != nil {
+			chatID = query.Message.Message.Chat.ID
+		}
+		if !a.allowlist.Allows(query.From.ID, chatID) {
+			a.handlers.HandleUnauthorized(ctx, a.sender, update)
+			return nil
+		}
+		return a.handlers.HandleCallback(ctx, a.sender, update)
+	}
+
 	if update.Message == nil {
 		return nil
 	}
 
-	if update.Message.Text == "/start" {
-		a.handlers.HandleStart(ctx, a.sender, update)
+	if !a.isAllowed(update.Message) {
+		a.handlers.HandleUnauthorized(ctx, a.sender, update)
 		return nil
 	}
 
-	if update.Message.Text != "" {
+	if _, ok := messageAttachment(update.Message); ok {
+		return a.handlers.HandleReceipt(ctx, a.sender, update)
+	}
+	if update.Message.Voice != nil {
+		return a.handlers.HandleVoice(ctx, a.sender, update)
+	}
+
+	switch update.Message.Text {
+	case "":
+		return nil
+	case "/start":
+		a.handlers.HandleStart(ctx, a.sender, update)
+		return nil
+	case "/undo":
+		return a.handlers.HandleUndo(ctx, a.sender, update)
+	case "/total":
+		return a.handlers.HandleTotal(ctx, a.sender, update)
+	case "/report":
+		return a.handlers.HandleReport(ctx, a.sender, update)
+	case "/compare":
+		return a.handlers.HandleCompare(ctx, a.sender, update)
+	default:
+		if IsIncome(update.Message.Text) {
+			return a.handlers.HandleIncome(ctx, a.sender, update)
+		}
+		if isReplyToBot(update.Message, a.botID) {
+			return a.handlers.HandleEdit(ctx, a.sender, update)
+		}
 		return a.handlers.HandleExpense(ctx, a.sender, update)
 	}
+}
+
+// Creates the store configured for receipt files, nil if receipts are not stored
+func newReceiptStore(ctx context.Context, config *Config) (BlobStore, error) {
+	switch config.ReceiptStore {
+	case ReceiptStoreLocal:
+		return NewLocalBlobStore(config.ReceiptDir, config.ReceiptBaseURL), nil
+	case ReceiptStoreS3:
+		return NewS3BlobStore(ctx, config.ReceiptBucket, config.ReceiptEndpoint, config.ReceiptBaseURL)
+	}
+	return nil, nil
+}
 
-	return nil
+// Reports whether the message replies to one of the messages of the bot with the given ID
+func isReplyToBot(message *models.Message, botID int64) bool {
+	reply := message.ReplyToMessage
+	return reply != nil && reply.From != nil && reply.From.ID == botID
+}
+
+func (a *app) isAllowed(message *models.Message) bool {
+	var userID int64
+	if message.From != nil {
+		userID = message.From.ID
+	}
+	return a.allowlist.Allows(userID, message.Chat.ID)
 }
 
 func main() {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/go-telegram/bot/models"
@@ -13,9 +15,11 @@ import (
 func newTestApp(sender *mockSender, sheet *mockSheet) *app {
 	logger := discardLogger()
 	return &app{
-		sender:   sender,
-		handlers: NewBotHandlers(sheet, logger),
-		logger:   logger,
+		sender:    sender,
+		botID:     99,
+		handlers:  NewBotHandlers(sheet, testRates(), Attachments{}, time.UTC, LocaleEuropean, logger),
+		allowlist: NewAllowlist(nil, []int64{1}),
+		logger:    logger,
 	}
 }
 
@@ -42,6 +46,38 @@ func TestProcessUpdate(t *testing.T) {
 			},
 			wantCalls: 1,
 		},
+		{
+			name: "undo command",
+			update: &models.Update{
+				Message: &models.Message{
+					Chat: models.Chat{ID: 1},
+					From: &models.User{ID: 1},
+					Text: "/undo",
+				},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "total command",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/total"},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "report command",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/report"},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "compare command",
+			update: &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "/compare"},
+			},
+			wantCalls: 1,
+		},
 		{
 			name: "expense message",
 			update: &models.Update{
@@ -55,6 +91,26 @@ func TestProcessUpdate(t *testing.T) {
 				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: ""},
 			},
 		},
+		{
+			name: "captioned receipt photo",
+			update: &models.Update{
+				Message: &models.Message{
+					Chat:    models.Chat{ID: 1},
+					Photo:   []models.PhotoSize{{FileID: "photo", FileUniqueID: "unique"}},
+					Caption: "Groceries 43.20",
+				},
+			},
+			wantCalls: 1,
+		},
+		{
+			name: "receipt document without caption",
+			update: &models.Update{
+				Message: &models.Message{
+					Chat:     models.Chat{ID: 1},
+					Document: &models.Document{FileID: "doc", FileUniqueID: "unique"},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -75,6 +131,296 @@ func TestProcessUpdate(t *testing.T) {
 	}
 }
 
+func TestProcessUpdateAllowlist(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		from        *models.User
+		chatID      int64
+		wantWrite   bool
+		wantRefusal bool
+	}{
+		{
+			name:      "allowed user writes expense",
+			from:      &models.User{ID: 42},
+			chatID:    1,
+			wantWrite: true,
+		},
+		{
+			name:      "allowed chat writes expense",
+			from:      &models.User{ID: 7},
+			chatID:    -100,
+			wantWrite: true,
+		},
+		{
+			name:        "unknown user is refused",
+			from:        &models.User{ID: 7},
+			chatID:      1,
+			wantRefusal: true,
+		},
+		{
+			name:        "missing sender is refused",
+			chatID:      1,
+			wantRefusal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			written := false
+			sheet := &mockSheet{
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					written = true
+					return nil
+				},
+			}
+			s := &mockSender{}
+			a := newTestApp(s, sheet)
+			a.allowlist = NewAllowlist([]int64{42}, []int64{-100})
+
+			update := &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: tt.chatID}, From: tt.from, Text: "Lunch 12.50"},
+			}
+			if err := a.processUpdate(context.Background(), update); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if written != tt.wantWrite {
+				t.Errorf("expense written = %v, want %v", written, tt.wantWrite)
+			}
+			if len(s.calls) != 1 {
+				t.Fatalf("expected 1 SendMessage call, got %d", len(s.calls))
+			}
+			refused := strings.Contains(s.calls[0].Text, "not allowed")
+			if refused != tt.wantRefusal {
+				t.Errorf("refusal sent = %v, want %v (text %q)", refused, tt.wantRefusal, s.calls[0].Text)
+			}
+		})
+	}
+}
+
+func TestProcessUpdateReplies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		replyTo   *models.Message
+		wantEdit  bool
+		wantWrite bool
+	}{
+		{
+			name:     "reply to bot edits",
+			replyTo:  &models.Message{ID: 5, From: &models.User{ID: 99, IsBot: true}},
+			wantEdit: true,
+		},
+		{
+			name:      "reply to a person adds",
+			replyTo:   &models.Message{ID: 5, From: &models.User{ID: 42}},
+			wantWrite: true,
+		},
+		{
+			name:      "reply to another bot adds",
+			replyTo:   &models.Message{ID: 5, From: &models.User{ID: 77, IsBot: true}},
+			wantWrite: true,
+		},
+		{
+			name:      "no reply adds",
+			wantWrite: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			edited, written := false, false
+			sheet := &mockSheet{
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					written = true
+					return nil
+				},
+				updateFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time, e *Expense) (*Expense, string, error) {
+					edited = true
+					return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+				},
+			}
+			a := newTestApp(&mockSender{}, sheet)
+
+			update := &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: "Lunch 3.95", ReplyToMessage: tt.replyTo},
+			}
+			if err := a.processUpdate(context.Background(), update); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if edited != tt.wantEdit {
+				t.Errorf("edited = %v, want %v", edited, tt.wantEdit)
+			}
+			if written != tt.wantWrite {
+				t.Errorf("written = %v, want %v", written, tt.wantWrite)
+			}
+		})
+	}
+}
+
+func TestProcessUpdateIncome(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		text       string
+		replyTo    *models.Message
+		wantIncome bool
+	}{
+		{
+			name:       "plus prefix records income",
+			text:       "+Salary 3200",
+			wantIncome: true,
+		},
+		{
+			name:       "income command records income",
+			text:       "/income Salary 3200",
+			wantIncome: true,
+		},
+		{
+			name:       "income in a reply to the bot is not a correction",
+			text:       "+Salary 3200",
+			replyTo:    &models.Message{ID: 5, From: &models.User{ID: 99, IsBot: true}},
+			wantIncome: true,
+		},
+		{
+			name: "expense",
+			text: "Lunch 12.50",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			income, expense := false, false
+			sheet := &mockSheet{
+				addIncomeFunc: func(ctx context.Context, ws string, i *Income) error {
+					income = true
+					return nil
+				},
+				addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+					expense = true
+					return nil
+				},
+			}
+			a := newTestApp(&mockSender{}, sheet)
+
+			update := &models.Update{
+				Message: &models.Message{Chat: models.Chat{ID: 1}, Text: tt.text, ReplyToMessage: tt.replyTo},
+			}
+			if err := a.processUpdate(context.Background(), update); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if income != tt.wantIncome || expense == tt.wantIncome {
+				t.Errorf("income = %v, expense = %v, want income %v", income, expense, tt.wantIncome)
+			}
+		})
+	}
+}
+
+func TestProcessUpdateCallback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		from        int64
+		chatID      int64
+		wantDeleted bool
+		wantRefusal bool
+	}{
+		{
+			name:        "allowed user presses undo",
+			from:        42,
+			chatID:      1,
+			wantDeleted: true,
+		},
+		{
+			name:        "unknown user is refused",
+			from:        7,
+			chatID:      1,
+			wantRefusal: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			deleted := false
+			sheet := &mockSheet{
+				deleteFunc: func(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error) {
+					deleted = true
+					return &Expense{Desc: "Lunch", Amount: Cents(295)}, "February 2026", nil
+				},
+			}
+			s := &mockSender{}
+			a := newTestApp(s, sheet)
+			a.allowlist = NewAllowlist([]int64{42}, nil)
+
+			update := &models.Update{CallbackQuery: &models.CallbackQuery{
+				ID:      "q1",
+				From:    models.User{ID: tt.from},
+				Data:    callbackUndo,
+				Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 5, Chat: models.Chat{ID: tt.chatID}}},
+			}}
+			if err := a.processUpdate(context.Background(), update); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if len(s.answers) != 1 {
+				t.Fatalf("expected 1 callback answer, got %d", len(s.answers))
+			}
+			if refused := s.answers[0].ShowAlert; refused != tt.wantRefusal {
+				t.Errorf("refusal alert = %v, want %v (text %q)", refused, tt.wantRefusal, s.answers[0].Text)
+			}
+		})
+	}
+}
+
+func TestProcessUpdateVoice(t *testing.T) {
+	t.Parallel()
+
+	var added *Expense
+	sheet := &mockSheet{addExpenseFunc: func(ctx context.Context, ws string, e *Expense) error {
+		added = e
+		return nil
+	}}
+	s := &mockSender{}
+	a := newTestApp(s, sheet)
+	a.handlers = NewBotHandlers(sheet, testRates(), Attachments{
+		Files: &mockFiles{data: []byte("ogg"), path: "voice/file_7.oga"},
+		Voice: &mockTranscriber{text: "Lunch 12,50."},
+	}, time.UTC, LocaleEuropean, a.logger)
+
+	update := &models.Update{Message: &models.Message{
+		Chat:  models.Chat{ID: 1},
+		Voice: &models.Voice{FileID: "voice", FileUniqueID: "unique", Duration: 3},
+	}}
+	if err := a.processUpdate(context.Background(), update); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if added == nil || added.Desc != "Lunch" || added.Amount != Cents(1250) {
+		t.Errorf("added expense = %+v, want Lunch 12,50", added)
+	}
+	if len(s.calls) != 2 {
+		t.Errorf("expected 2 SendMessage calls, got %d", len(s.calls))
+	}
+}
+
 func TestHandleRequest(t *testing.T) {
 	t.Parallel()
 
@@ -130,7 +476,7 @@ func TestHandleRequest(t *testing.T) {
 		t.Parallel()
 
 		sheet := &mockSheet{
-			getWorksheetFunc: func(ctx context.Context) (string, error) {
+			getWorksheetFunc: func(ctx context.Context, date time.Time) (string, error) {
 				return "", fmt.Errorf("fail")
 			},
 		}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// Plain decimals as the Sheets API renders unformatted numbers, e.g. "12.5", "-3" or "1.2345e+06"
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,3})?$`)
+
+// Currency of amounts that don't name one
+const defaultCurrency = "EUR"
+
+// Money is an exact amount in cents, so sums of many rows don't pick up binary rounding errors
+// Amounts that are added or compared must be in the same currency, the zero Money has none
+// and takes the currency of whatever is added to it
+type Money struct {
+	Cents    int64
+	Currency string // ISO 4217 code, e.g. "EUR"
+}
+
+// Cents returns an amount in the default currency
+func Cents(cents int64) Money {
+	return Money{Cents: cents, Currency: defaultCurrency}
+}
+
+// Add returns the sum of m and other
+func (m Money) Add(other Money) Money {
+	return Money{Cents: m.Cents + other.Cents, Currency: m.currencyWith(other)}
+}
+
+// Sub returns the difference of m and other
+func (m Money) Sub(other Money) Money {
+	return Money{Cents: m.Cents - other.Cents, Currency: m.currencyWith(other)}
+}
+
+// Neg returns m with the opposite sign
+func (m Money) Neg() Money {
+	return Money{Cents: -m.Cents, Currency: m.Currency}
+}
+
+// Div divides m into n parts, rounding half away from zero to whole cents
+func (m Money) Div(n int64) Money {
+	return moneyFromRat(big.NewRat(m.Cents, n*100), m.Currency)
+}
+
+// Ratio returns m as a fraction of total, for percentages that are only displayed
+func (m Money) Ratio(total Money) float64 {
+	if total.Cents == 0 {
+		return 0
+	}
+	return float64(m.Cents) / float64(total.Cents)
+}
+
+// Decimal formats m with a dot and two decimals, e.g. "-12.50"
+func (m Money) Decimal() string {
+	sign, cents := "", m.Cents
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Returns m as a number cell for the Sheets API, written out exactly rather than as a float
+func (m Money) sheetValue() json.Number {
+	return json.Number(m.Decimal())
+}
+
+func (m Money) currencyWith(other Money) string {
+	if m.Currency == "" {
+		return other.Currency
+	}
+	return m.Currency
+}
+
+// Parses a plain decimal or exponent number such as "12.5" or "1.2345e+06" into the default currency
+// Fractions of a cent are rounded half away from zero
+func parseMoney(value string) (Money, bool) {
+	if !decimalPattern.MatchString(value) {
+		return Money{}, false
+	}
+	number, ok := new(big.Rat).SetString(value)
+	if !ok || !moneyFits(number) {
+		return Money{}, false
+	}
+	return moneyFromRat(number, defaultCurrency), true
+}
+
+// Rounds an amount in currency units to whole cents, half away from zero
+func moneyFromRat(amount *big.Rat, currency string) Money {
+	scaled := new(big.Rat).Mul(amount, big.NewRat(100, 1))
+	cents, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if twice := new(big.Int).Abs(remainder); twice.Lsh(twice, 1).Cmp(scaled.Denom()) >= 0 {
+		cents.Add(cents, big.NewInt(int64(scaled.Sign())))
+	}
+	return Money{Cents: cents.Int64(), Currency: currency}
+}
+
+// Reports whether an amount in currency units fits in Money without overflowing
+func moneyFits(amount *big.Rat) bool {
+	cents := new(big.Rat).Mul(amount, big.NewRat(100, 1))
+	limit := new(big.Rat).SetInt64(1 << 62)
+	return cents.Cmp(limit) < 0 && cents.Cmp(new(big.Rat).Neg(limit)) > 0
+}
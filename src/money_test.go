@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	t.Parallel()
+
+	var sum Money
+	for range 500 {
+		sum = sum.Add(Cents(10))
+	}
+	if sum != Cents(5000) {
+		t.Errorf("500 × 0.10 = %+v, want %+v", sum, Cents(5000))
+	}
+
+	if got := Cents(1000).Sub(Cents(1250)); got != Cents(-250) {
+		t.Errorf("Sub() = %+v, want %+v", got, Cents(-250))
+	}
+	if got := Cents(-250).Neg(); got != Cents(250) {
+		t.Errorf("Neg() = %+v, want %+v", got, Cents(250))
+	}
+	if got := (Money{}).Add(Money{Cents: 5, Currency: "USD"}); got.Currency != "USD" {
+		t.Errorf("zero Money took currency %q, want USD", got.Currency)
+	}
+}
+
+func TestMoneyDiv(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		amount Money
+		n      int64
+		want   Money
+	}{
+		{amount: Cents(10000), n: 3, want: Cents(3333)},
+		{amount: Cents(20000), n: 3, want: Cents(6667)},
+		{amount: Cents(5), n: 2, want: Cents(3)},
+		{amount: Cents(-5), n: 2, want: Cents(-3)},
+		{amount: Cents(4500), n: 2, want: Cents(2250)},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.Div(tt.n); got != tt.want {
+			t.Errorf("%+v.Div(%d) = %+v, want %+v", tt.amount, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{amount: Cents(0), want: "0.00"},
+		{amount: Cents(5), want: "0.05"},
+		{amount: Cents(1250), want: "12.50"},
+		{amount: Cents(-1250), want: "-12.50"},
+		{amount: Cents(-5), want: "-0.05"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.Decimal(); got != tt.want {
+			t.Errorf("%+v.Decimal() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoney(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value  string
+		want   Money
+		wantOK bool
+	}{
+		{value: "12.5", want: Cents(1250), wantOK: true},
+		{value: "0.1", want: Cents(10), wantOK: true},
+		{value: "-3", want: Cents(-300), wantOK: true},
+		{value: ".5", want: Cents(50), wantOK: true},
+		{value: "1.2345e+06", want: Cents(123450000), wantOK: true},
+		{value: "0.30000000000000004", want: Cents(30), wantOK: true},
+		{value: "0.005", want: Cents(1), wantOK: true},
+		{value: "-0.005", want: Cents(-1), wantOK: true},
+		{value: "0.0049", want: Cents(0), wantOK: true},
+		{value: "1/3"},
+		{value: "0x10"},
+		{value: "1e999999"},
+		{value: "1e100"},
+		{value: "NaN"},
+		{value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := parseMoney(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseMoney(%q) = %+v, %v, want %+v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMoneyFromRat(t *testing.T) {
+	t.Parallel()
+
+	// 0.1 + 0.2 is exact in rationals, unlike in float64
+	sum := new(big.Rat).Add(big.NewRat(1, 10), big.NewRat(2, 10))
+	if got := moneyFromRat(sum, defaultCurrency); got != Cents(30) {
+		t.Errorf("moneyFromRat(0.1+0.2) = %+v, want %+v", got, Cents(30))
+	}
+}
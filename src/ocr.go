@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// TextRecognizer reads the text in an image, such as a receipt photo
+type TextRecognizer interface {
+	RecognizeText(ctx context.Context, image []byte) (string, error)
+}
+
+const (
+	defaultTesseractPath = "tesseract"
+	defaultOCRLanguages  = "eng"
+)
+
+// TesseractOCR runs the Tesseract command line tool, so no text leaves the machine
+type TesseractOCR struct {
+	path      string // Tesseract executable
+	languages string // Tesseract language codes, e.g. "eng+fin"
+}
+
+// NewTesseractOCR creates a recognizer, using the tesseract on PATH and English if path or languages are empty
+func NewTesseractOCR(path, languages string) *TesseractOCR {
+	if path == "" {
+		path = defaultTesseractPath
+	}
+	if languages == "" {
+		languages = defaultOCRLanguages
+	}
+	return &TesseractOCR{path: path, languages: languages}
+}
+
+func (t *TesseractOCR) RecognizeText(ctx context.Context, image []byte) (string, error) {
+	cmd := exec.CommandContext(ctx, t.path, "stdin", "stdout", "-l", t.languages)
+	cmd.Stdin = bytes.NewReader(image)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("run tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Longest merchant name used in a suggestion
+const maxMerchantLength = 40
+
+var (
+	// Amounts printed on receipts always have two decimals, e.g. "43.20", "43,20" or "1 234,50"
+	receiptAmountPattern = regexp.MustCompile(`\d{1,3}(?:[ .,]\d{3})*[.,]\d{2}\b`)
+	// Words that mark the line with the amount to pay, in the languages of the receipts we get
+	// There is no closing \b, which would never match after a letter like "ä"
+	receiptTotalPattern = regexp.MustCompile(`(?i)\b(total|grand total|amount due|to pay|yhteensä|summa|maksettava|totalt|att betala|summe|gesamt)`)
+	// Dates would otherwise read as amounts, e.g. "12.03" in "12.03.2026"
+	receiptDatePattern = regexp.MustCompile(`\b\d{1,4}[./-]\d{1,2}[./-]\d{1,4}\b`)
+	// Lines that mention a total but not the amount paid
+	receiptSubtotalPattern = regexp.MustCompile(`(?i)\b(sub-?total|välisumma|alv|vat|tax|moms|mwst)\b`)
+)
+
+// Finds the merchant and the total in the text of a receipt
+// The total is the largest amount on a line labelled as a total, or the largest amount on the receipt if no line is
+// The merchant is the first line with a word in it, which is usually the shop name at the top
+func suggestFromReceipt(text string, locale AmountLocale) (string, Money, bool) {
+	var merchant string
+	var total, largest Money
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		amounts := receiptAmountPattern.FindAllString(receiptDatePattern.ReplaceAllString(line, ""), -1)
+		if merchant == "" && len(amounts) == 0 {
+			merchant = merchantName(line)
+		}
+
+		for _, value := range amounts {
+			amount, err := parseUserAmount(strings.ReplaceAll(value, " ", ""), locale)
+			if err != nil || amount.Cents <= 0 {
+				continue
+			}
+			if amount.Cents > largest.Cents {
+				largest = amount
+			}
+			if receiptTotalPattern.MatchString(line) && !receiptSubtotalPattern.MatchString(line) && amount.Cents > total.Cents {
+				total = amount
+			}
+		}
+	}
+
+	if total.Cents == 0 {
+		total = largest
+	}
+	if merchant == "" || total.Cents == 0 {
+		return "", Money{}, false
+	}
+	return merchant, total, true
+}
+
+// Cleans up a receipt line for use as a description, or returns "" if it has no word in it
+// Shop names are often printed in capitals, so "K-MARKET KAMPPI" becomes "K-Market Kamppi"
+func merchantName(line string) string {
+	name := strings.TrimFunc(line, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	letters := 0
+	for _, r := range name {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < 3 {
+		return ""
+	}
+
+	if name == strings.ToUpper(name) {
+		name = titleCase(name)
+	}
+	if runes := []rune(name); len(runes) > maxMerchantLength {
+		name = strings.TrimSpace(string(runes[:maxMerchantLength]))
+	}
+	return name
+}
+
+// Capitalizes the first letter of every word and lowercases the rest, e.g. "K-MARKET" becomes "K-Market"
+func titleCase(s string) string {
+	runes := []rune(strings.ToLower(s))
+	start := true
+	for i, r := range runes {
+		if start && unicode.IsLetter(r) {
+			runes[i] = unicode.ToUpper(r)
+		}
+		start = !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}
+	return string(runes)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuggestFromReceipt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		text         string
+		locale       AmountLocale
+		wantMerchant string
+		wantTotal    Money
+		wantOK       bool
+	}{
+		{
+			name: "finnish receipt",
+			text: `K-MARKET KAMPPI
+Urho Kekkosen katu 1
+12.03.2026 18:42
+
+MAITO 1L            1,29
+RUISLEIPÄ           2,49
+BANAANI             1,12
+
+YHTEENSÄ            4,90
+ALV 14%             0,60
+KORTTI              4,90`,
+			wantMerchant: "K-Market Kamppi",
+			wantTotal:    Cents(490),
+			wantOK:       true,
+		},
+		{
+			name: "subtotal and tax are not the total",
+			text: `Blue Bottle Coffee
+Latte          5.50
+Croissant     37.70
+Subtotal      43.20
+Tax            3.46
+Total         46.66
+Cash          50.00
+Change         3.34`,
+			locale:       LocaleEnglish,
+			wantMerchant: "Blue Bottle Coffee",
+			wantTotal:    Cents(4666),
+			wantOK:       true,
+		},
+		{
+			name: "thousands separators",
+			text: `** Verkkokauppa.com **
+Laptop 1 234,50
+Summa 1 234,50 EUR`,
+			wantMerchant: "Verkkokauppa.com",
+			wantTotal:    Cents(123450),
+			wantOK:       true,
+		},
+		{
+			name: "largest amount without a total line",
+			text: `Kiosk
+Gum 1.20
+Water 2.40`,
+			wantMerchant: "Kiosk",
+			wantTotal:    Cents(240),
+			wantOK:       true,
+		},
+		{
+			name: "long shop name is shortened",
+			text: `The Extraordinarily Long Name Of A Corner Shop
+Total 3.00`,
+			wantMerchant: "The Extraordinarily Long Name Of A Corne",
+			wantTotal:    Cents(300),
+			wantOK:       true,
+		},
+		{
+			name: "no amounts",
+			text: "Thank you for shopping with us",
+		},
+		{
+			name: "no text",
+			text: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			merchant, total, ok := suggestFromReceipt(tt.text, tt.locale)
+			if merchant != tt.wantMerchant || total != tt.wantTotal || ok != tt.wantOK {
+				t.Errorf("suggestFromReceipt() = %q, %v, %v, want %q, %v, %v",
+					merchant, total, ok, tt.wantMerchant, tt.wantTotal, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTitleCase(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"K-MARKET", "K-Market"},
+		{"LIDL SUOMI KY", "Lidl Suomi Ky"},
+		{"ÅHLÉNS CITY", "Åhléns City"},
+		{"7-ELEVEN", "7-Eleven"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			if got := titleCase(tt.input); got != tt.want {
+				t.Errorf("titleCase(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTesseractOCR(t *testing.T) {
+	t.Parallel()
+
+	// Stands in for tesseract by echoing its arguments and the image it was given
+	script := filepath.Join(t.TempDir(), "tesseract")
+	contents := "#!/bin/sh\necho \"$@\"\ncat\n"
+	if err := os.WriteFile(script, []byte(contents), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ocr := NewTesseractOCR(script, "eng+fin")
+	got, err := ocr.RecognizeText(context.Background(), []byte("TOTAL 4,90"))
+	if err != nil {
+		t.Fatalf("RecognizeText() unexpected error: %v", err)
+	}
+	if want := "stdin stdout -l eng+fin\nTOTAL 4,90"; got != want {
+		t.Errorf("RecognizeText() = %q, want %q", got, want)
+	}
+
+	missing := NewTesseractOCR(filepath.Join(t.TempDir(), "missing"), "")
+	if _, err := missing.RecognizeText(context.Background(), nil); err == nil {
+		t.Error("RecognizeText() expected error for a missing executable")
+	}
+}
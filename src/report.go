@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Items listed in a report before the smallest ones are combined into "Other"
+	maxReportItems = 20
+	// Descriptions longer than this are cut so the table fits a phone screen
+	maxReportItemWidth = 16
+)
+
+// Spending on one item of the monthly report
+type reportItem struct {
+	Desc  string
+	Count int
+	Total Money
+}
+
+// Monthly spending grouped by item, largest first
+type monthlyReport struct {
+	Items []reportItem
+	Count int
+	Total Money
+}
+
+// Groups expenses by description, ignoring case and extra whitespace
+// The first spelling seen names the item
+func buildReport(expenses []*Expense) monthlyReport {
+	var report monthlyReport
+	index := make(map[string]int)
+
+	for _, expense := range expenses {
+		desc := strings.Join(strings.Fields(expense.Desc), " ")
+		key := strings.ToLower(desc)
+
+		i, ok := index[key]
+		if !ok {
+			i = len(report.Items)
+			index[key] = i
+			report.Items = append(report.Items, reportItem{Desc: desc})
+		}
+		report.Items[i].Count++
+		report.Items[i].Total = report.Items[i].Total.Add(expense.Amount)
+
+		report.Count++
+		report.Total = report.Total.Add(expense.Amount)
+	}
+
+	slices.SortStableFunc(report.Items, func(a, b reportItem) int {
+		return cmp.Or(cmp.Compare(b.Total.Cents, a.Total.Cents), strings.Compare(strings.ToLower(a.Desc), strings.ToLower(b.Desc)))
+	})
+
+	if len(report.Items) > maxReportItems {
+		other := reportItem{Desc: "Other"}
+		for _, item := range report.Items[maxReportItems-1:] {
+			other.Count += item.Count
+			other.Total = other.Total.Add(item.Total)
+		}
+		report.Items = append(report.Items[:maxReportItems-1], other)
+	}
+
+	return report
+}
+
+// Formats the report as a monospaced HTML table with the count, total and share of each item
+func formatReport(worksheet string, report monthlyReport) string {
+	rows := [][]string{{"Item", "#", "Total", "Share"}}
+	for _, item := range report.Items {
+		rows = append(rows, []string{
+			truncate(item.Desc, maxReportItemWidth),
+			fmt.Sprint(item.Count),
+			formatAmount(item.Total),
+			formatShare(item.Total, report.Total),
+		})
+	}
+	total := []string{"Total", fmt.Sprint(report.Count), formatAmount(report.Total), formatShare(report.Total, report.Total)}
+
+	return fmt.Sprintf("📊 %s by item\n\n%s", html.EscapeString(worksheet), formatTable(rows, total))
+}
+
+// Lays out rows as a <pre> block with the first column left-aligned and the others right-aligned
+// The footer row is set apart by a line
+func formatTable(rows [][]string, footer []string) string {
+	widths := make([]int, len(footer))
+	for _, row := range append(rows, footer) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	lineWidth := len(widths) - 1 // Spaces between the columns
+	for _, width := range widths {
+		lineWidth += width
+	}
+
+	var table strings.Builder
+	for _, row := range rows {
+		writeTableRow(&table, row, widths)
+	}
+	table.WriteString(strings.Repeat("-", lineWidth) + "\n")
+	writeTableRow(&table, footer, widths)
+
+	return "<pre>" + html.EscapeString(table.String()) + "</pre>"
+}
+
+func writeTableRow(table *strings.Builder, row []string, widths []int) {
+	for i, cell := range row {
+		padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		if i == 0 {
+			table.WriteString(cell + padding)
+		} else {
+			table.WriteString(" " + padding + cell)
+		}
+	}
+	table.WriteString("\n")
+}
+
+func formatShare(amount, total Money) string {
+	return fmt.Sprintf("%.0f%%", amount.Ratio(total)*100)
+}
+
+// Shortens s to at most width runes, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
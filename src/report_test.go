@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBuildReport(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		expenses []*Expense
+		want     monthlyReport
+	}{
+		{
+			name: "groups descriptions ignoring case and spacing",
+			expenses: []*Expense{
+				{Desc: "Lunch", Amount: Cents(1000)},
+				{Desc: "Rent", Amount: Cents(90000)},
+				{Desc: "lunch ", Amount: Cents(1250)},
+				{Desc: "Movies", Amount: Cents(1200), Category: CategoryFun},
+				{Desc: "Bus  ticket", Amount: Cents(300)},
+				{Desc: "bus ticket", Amount: Cents(300)},
+			},
+			want: monthlyReport{
+				Items: []reportItem{
+					{Desc: "Rent", Count: 1, Total: Cents(90000)},
+					{Desc: "Lunch", Count: 2, Total: Cents(2250)},
+					{Desc: "Movies", Count: 1, Total: Cents(1200)},
+					{Desc: "Bus ticket", Count: 2, Total: Cents(600)},
+				},
+				Count: 6,
+				Total: Cents(94050),
+			},
+		},
+		{
+			name: "equal totals are sorted by name",
+			expenses: []*Expense{
+				{Desc: "coffee", Amount: Cents(300)},
+				{Desc: "Bread", Amount: Cents(300)},
+			},
+			want: monthlyReport{
+				Items: []reportItem{{Desc: "Bread", Count: 1, Total: Cents(300)}, {Desc: "coffee", Count: 1, Total: Cents(300)}},
+				Count: 2,
+				Total: Cents(600),
+			},
+		},
+		{
+			name: "no expenses",
+			want: monthlyReport{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := buildReport(tt.expenses)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildReport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildReportCombinesSmallItems(t *testing.T) {
+	t.Parallel()
+
+	var expenses []*Expense
+	for i := range maxReportItems + 5 {
+		expenses = append(expenses, &Expense{Desc: fmt.Sprintf("Item %d", i), Amount: Cents(int64(100-i) * 100)})
+	}
+
+	report := buildReport(expenses)
+	if len(report.Items) != maxReportItems {
+		t.Fatalf("buildReport() has %d items, want %d", len(report.Items), maxReportItems)
+	}
+
+	// The six smallest items: 81 + 80 + 79 + 78 + 77 + 76
+	want := reportItem{Desc: "Other", Count: 6, Total: Cents(47100)}
+	if got := report.Items[maxReportItems-1]; got != want {
+		t.Errorf("last item = %+v, want %+v", got, want)
+	}
+	if report.Count != len(expenses) {
+		t.Errorf("Count = %d, want %d", report.Count, len(expenses))
+	}
+}
+
+func TestFormatReport(t *testing.T) {
+	t.Parallel()
+
+	report := monthlyReport{
+		Items: []reportItem{
+			{Desc: "Rent", Count: 1, Total: Cents(90000)},
+			{Desc: "Groceries & more from Lidl", Count: 4, Total: Cents(7550)},
+			{Desc: "Kahvi", Count: 3, Total: Cents(2450)},
+		},
+		Count: 8,
+		Total: Cents(100000),
+	}
+
+	got := formatReport("March 2026", report)
+	want := "📊 March 2026 by item\n\n<pre>" +
+		"Item             #   Total Share\n" +
+		"Rent             1  900,00   90%\n" +
+		"Groceries &amp; mor… 4   75,50    8%\n" +
+		"Kahvi            3   24,50    2%\n" +
+		"--------------------------------\n" +
+		"Total            8 1000,00  100%\n" +
+		"</pre>"
+	if got != want {
+		t.Errorf("formatReport() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{s: "Lunch", width: 5, want: "Lunch"},
+		{s: "Lunches", width: 5, want: "Lunc…"},
+		{s: "Äitienpäivä", width: 6, want: "Äitie…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			t.Parallel()
+
+			if got := truncate(tt.s, tt.width); got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strconv"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/auth/credentials"
 	"google.golang.org/api/option"
@@ -13,20 +15,142 @@ import (
 )
 
 type Spreadsheet interface {
-	GetCurrentMonthWorksheet(ctx context.Context) (string, error)
+	GetWorksheet(ctx context.Context, date time.Time) (string, error)
+	EnsureWorksheet(ctx context.Context, date time.Time) (string, error)
 	AddExpense(ctx context.Context, worksheet string, expense *Expense) error
-	GetMonthlyTotal(ctx context.Context, worksheet string) (float64, error)
+	AddExpenses(ctx context.Context, worksheet string, expenses []*Expense) error
+	AddLinkedExpense(ctx context.Context, worksheet string, expense *Expense, chatID int64, messageID int) error
+	AddIncome(ctx context.Context, worksheet string, income *Income) error
+	GetMonthlyTotals(ctx context.Context, worksheet string) (MonthlyTotals, error)
+	GetMonthlyExpenses(ctx context.Context, worksheet string) ([]*Expense, error)
+	GetMonthlyHistory(ctx context.Context, date time.Time, months int) ([]MonthTotals, error)
+	GetBudget(ctx context.Context, worksheet string) (Budget, error)
+	DeleteLastExpense(ctx context.Context, worksheet string, userID int64) (*Expense, error)
+	LinkMessage(ctx context.Context, worksheet string, updateID, chatID int64, messageID int) error
+	UpdateExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, expense *Expense) (*Expense, string, error)
+	DeleteExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error)
+	MoveExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, category Category) (*Expense, string, error)
+}
+
+// MonthlyTotals holds the expense sums of a worksheet per category and the income of the month
+type MonthlyTotals struct {
+	Fundamentals Money
+	Fun          Money
+	Income       Money
+}
+
+// Total returns the combined expenses of all categories
+func (t MonthlyTotals) Total() Money {
+	return t.Fundamentals.Add(t.Fun)
+}
+
+// Net returns the income left after all expenses
+func (t MonthlyTotals) Net() Money {
+	return t.Income.Sub(t.Total())
+}
+
+// ForCategory returns the expenses of a single category
+func (t MonthlyTotals) ForCategory(category Category) Money {
+	if category == CategoryFun {
+		return t.Fun
+	}
+	return t.Fundamentals
+}
+
+// MonthTotals holds the expense sums of one month's worksheet
+type MonthTotals struct {
+	Title  string
+	Totals MonthlyTotals
+	Found  bool // False if the month has no worksheet
+}
+
+// WorksheetNotFoundError is returned when the spreadsheet has no worksheet with the expected title
+type WorksheetNotFoundError struct {
+	Title string
+}
+
+func (e *WorksheetNotFoundError) Error() string {
+	return fmt.Sprintf("worksheet %q not found", e.Title)
+}
+
+// ErrNothingToUndo is returned by DeleteLastExpense when the user has no expenses in the worksheet
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// ErrExpenseNotFound is returned when no expense is linked to a bot message
+var ErrExpenseNotFound = errors.New("expense not found")
+
+// ErrAmbiguousExpense is returned when a bot message confirmed several expenses
+// and it is unclear which one to change
+var ErrAmbiguousExpense = errors.New("ambiguous expense")
+
+// ErrAlreadyLinked is returned by AddLinkedExpense when an expense is already linked to the bot message
+var ErrAlreadyLinked = errors.New("expense already linked to the message")
+
+// ErrNoIncomeSection is returned by AddIncome when the worksheet has no "Income" header above "Total Net income"
+var ErrNoIncomeSection = errors.New("no income section")
+
+// ErrIncomeRowsFull is returned by AddIncome when the income section has no empty row left
+var ErrIncomeRowsFull = errors.New("no empty income row")
+
+// Developer metadata key attached to every expense row written by the bot
+const expenseMetadataKey = "accountant-bot.expense"
+
+// Developer metadata key attached to every income row written by the bot
+const incomeMetadataKey = "accountant-bot.income"
+
+// Stored as developer metadata on expense rows to remember who wrote what
+type expenseRecord struct {
+	UserID    int64    `json:"user_id"`
+	Category  Category `json:"category"`
+	AddedAt   int64    `json:"added_at"`             // Unix nanoseconds
+	UpdateID  int64    `json:"update_id,omitempty"`  // Telegram update the expense came from
+	ChatID    int64    `json:"chat_id,omitempty"`    // Chat of the bot message that confirmed the expense
+	MessageID int      `json:"message_id,omitempty"` // Bot message that confirmed the expense
 }
 
 var _ Spreadsheet = (*SheetsService)(nil)
 
+// SheetsOptions configures which spreadsheet SheetsService uses and how it is laid out
+type SheetsOptions struct {
+	SpreadsheetID string
+	DefaultBudget Budget
+	TitleFormat   string         // Go time layout of the worksheet titles, e.g. "January 2006"
+	Location      *time.Location // Timezone that decides which month a date belongs to
+	Template      string         // Worksheet copied for new months, the previous month is used if empty
+	Locale        AmountLocale   // How amounts typed into the sheet as text are read
+
+	// Columns for expense dates, no dates are written if empty
+	FundamentalsDateColumn string
+	FunDateColumn          string
+
+	// Columns for the amount as paid in another currency, e.g. "250.00 SEK", nothing is written if empty
+	FundamentalsOriginalColumn string
+	FunOriginalColumn          string
+
+	// Columns for links to receipt photos, no links are written if empty
+	FundamentalsReceiptColumn string
+	FunReceiptColumn          string
+}
+
 type SheetsService struct {
 	service       *sheets.Service
 	spreadsheetID string
+	defaultBudget Budget
+	titleFormat   string
+	location      *time.Location
+	template      string
+	locale        AmountLocale
+	fundDateCol   string
+	funDateCol    string
+	fundOrigCol   string
+	funOrigCol    string
+	fundRcptCol   string
+	funRcptCol    string
+	claimBackoff  time.Duration
 	logger        *slog.Logger
 }
 
-func NewSheetsService(ctx context.Context, credentialsJSON, spreadsheetID string, logger *slog.Logger) (*SheetsService, error) {
+func NewSheetsService(ctx context.Context, credentialsJSON string, opts SheetsOptions, logger *slog.Logger) (*SheetsService, error) {
 	creds, err := credentials.DetectDefault(&credentials.DetectOptions{
 		Scopes: []string{
 			"https://www.googleapis.com/auth/spreadsheets",
@@ -45,44 +169,374 @@ func NewSheetsService(ctx context.Context, credentialsJSON, spreadsheetID string
 
 	return &SheetsService{
 		service:       service,
-		spreadsheetID: spreadsheetID,
+		spreadsheetID: opts.SpreadsheetID,
+		defaultBudget: opts.DefaultBudget,
+		titleFormat:   opts.TitleFormat,
+		location:      opts.Location,
+		template:      opts.Template,
+		locale:        opts.Locale,
+		fundDateCol:   opts.FundamentalsDateColumn,
+		funDateCol:    opts.FunDateColumn,
+		fundOrigCol:   opts.FundamentalsOriginalColumn,
+		funOrigCol:    opts.FunOriginalColumn,
+		fundRcptCol:   opts.FundamentalsReceiptColumn,
+		funRcptCol:    opts.FunReceiptColumn,
+		claimBackoff:  defaultClaimBackoff,
 		logger:        logger,
 	}, nil
 }
 
-// GetCurrentMonthWorksheet returns the title of the newest worksheet
-func (s *SheetsService) GetCurrentMonthWorksheet(ctx context.Context) (string, error) {
-	spreadsheet, err := s.service.Spreadsheets.Get(s.spreadsheetID).Context(ctx).Do()
+// GetWorksheet returns the title of the worksheet for the month of the given date
+// Returns a *WorksheetNotFoundError if the month has no worksheet
+func (s *SheetsService) GetWorksheet(ctx context.Context, date time.Time) (string, error) {
+	props, err := s.listWorksheets(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	title := worksheetTitle(date, s.titleFormat, s.location)
+	sheet := findWorksheet(props, title)
+	if sheet == nil {
+		return "", &WorksheetNotFoundError{Title: title}
+	}
+
+	return sheet.Title, nil
+}
+
+// EnsureWorksheet returns the worksheet for the month of the given date, creating it if missing
+// New worksheets are copied from the template, or from the previous month with its expenses cleared
+func (s *SheetsService) EnsureWorksheet(ctx context.Context, date time.Time) (string, error) {
+	props, err := s.listWorksheets(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	title := worksheetTitle(date, s.titleFormat, s.location)
+	if sheet := findWorksheet(props, title); sheet != nil {
+		return sheet.Title, nil
+	}
+
+	worksheet, err := s.createWorksheet(ctx, props, date, title)
+	if err != nil {
+		return "", fmt.Errorf("create worksheet: %w", err)
+	}
+
+	return worksheet, nil
+}
+
+// Copies the template or the previous month into a new worksheet
+// Returns the title of the month's worksheet, which another invocation may have created first
+func (s *SheetsService) createWorksheet(ctx context.Context, props []*sheets.SheetProperties, date time.Time, title string) (string, error) {
+	previousTitle := worksheetTitle(previousMonth(date, s.location), s.titleFormat, s.location)
+	source, insertIndex, fromPrevious, err := chooseWorksheetSource(props, s.template, previousTitle)
+	if err != nil {
+		return "", err
+	}
+	if source == nil {
+		return "", &WorksheetNotFoundError{Title: title}
+	}
+	resp, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			DuplicateSheet: &sheets.DuplicateSheetRequest{
+				SourceSheetId:    source.SheetId,
+				InsertSheetIndex: insertIndex,
+				NewSheetName:     title,
+				ForceSendFields:  []string{"SourceSheetId", "InsertSheetIndex"},
+			},
+		}},
+	}).Context(ctx).Do()
+	if err != nil {
+		// Another invocation may have created the same worksheet concurrently
+		if worksheet, getErr := s.GetWorksheet(ctx, date); getErr == nil {
+			return worksheet, nil
+		}
+		return "", fmt.Errorf("duplicate sheet %q: %w", source.Title, err)
+	}
+
+	if fromPrevious {
+		var newSheetID int64
+		if len(resp.Replies) > 0 && resp.Replies[0].DuplicateSheet != nil && resp.Replies[0].DuplicateSheet.Properties != nil {
+			newSheetID = resp.Replies[0].DuplicateSheet.Properties.SheetId
+		} else if newSheetID, err = s.getSheetID(ctx, title); err != nil {
+			return "", fmt.Errorf("get sheet id: %w", err)
+		}
+
+		// A copy that still holds last month's rows must not stay, since retries would find it and use it as is
+		if err := s.clearCopiedWorksheet(ctx, title, newSheetID); err != nil {
+			if deleteErr := s.deleteWorksheet(ctx, newSheetID); deleteErr != nil {
+				return "", fmt.Errorf("%w, and deleting the copy failed: %v", err, deleteErr)
+			}
+			return "", err
+		}
+	}
+
+	s.logger.Info("created worksheet", slog.String("worksheet", title))
+
+	return title, nil
+}
+
+// Removes last month's expenses and their records from a worksheet copied from it
+func (s *SheetsService) clearCopiedWorksheet(ctx context.Context, worksheet string, sheetID int64) error {
+	if err := s.clearCopiedRows(ctx, worksheet); err != nil {
+		return fmt.Errorf("clear copied rows: %w", err)
+	}
+	if err := s.deleteCopiedMetadata(ctx, sheetID); err != nil {
+		return fmt.Errorf("delete copied metadata: %w", err)
+	}
+	return nil
+}
+
+func (s *SheetsService) deleteWorksheet(ctx context.Context, sheetID int64) error {
+	_, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			DeleteSheet: &sheets.DeleteSheetRequest{
+				SheetId:         sheetID,
+				ForceSendFields: []string{"SheetId"},
+			},
+		}},
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("delete sheet: %w", err)
+	}
+
+	return nil
+}
+
+// Clears every expense row below the header following "Total Net income", including the columns written next to it,
+// and the income rows above it. Budget rows in the income section are kept
+func (s *SheetsService) clearCopiedRows(ctx context.Context, worksheet string) error {
+	rangeStr := fmt.Sprintf("%s!A:A", worksheet)
+	resp, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("get column values: %w", err)
+	}
+
+	labels := flattenColumn(resp.Values)
+	startRow, ok := findExpenseStartRow(labels)
+	if !ok {
+		return fmt.Errorf("could not find expense start row")
+	}
+
+	firstRow := startRow + 1
+	clearRanges := []string{fmt.Sprintf("%s!A%d:D", worksheet, firstRow)}
+	for _, column := range s.expenseDetailColumns() {
+		clearRanges = append(clearRanges, fmt.Sprintf("%s!%s%d:%s", worksheet, column, firstRow, column))
+	}
+
+	if start, end, ok := incomeSection(labels); ok {
+		for i := start; i < end; i++ {
+			if labels[i] != "" && !isBudgetLabel(labels[i]) {
+				clearRanges = append(clearRanges, fmt.Sprintf("%s!A%d:B%d", worksheet, i+1, i+1))
+			}
+		}
+	}
+
+	_, err = s.service.Spreadsheets.Values.BatchClear(s.spreadsheetID, &sheets.BatchClearValuesRequest{
+		Ranges: clearRanges,
+	}).Context(ctx).Do()
 	if err != nil {
-		return "", fmt.Errorf("get spreadsheet: %w", err)
+		return fmt.Errorf("clear cells: %w", err)
+	}
+
+	return nil
+}
+
+// Removes the expense and income records copied along with a duplicated worksheet
+func (s *SheetsService) deleteCopiedMetadata(ctx context.Context, sheetID int64) error {
+	var ids []int64
+	for _, key := range []string{expenseMetadataKey, incomeMetadataKey} {
+		matches, err := s.searchMetadata(ctx, key, sheetID)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			if match.DeveloperMetadata != nil {
+				ids = append(ids, match.DeveloperMetadata.MetadataId)
+			}
+		}
 	}
 
-	if len(spreadsheet.Sheets) == 0 {
-		return "", fmt.Errorf("no worksheets found")
+	if len(ids) == 0 {
+		return nil
 	}
 
-	return spreadsheet.Sheets[0].Properties.Title, nil
+	_, err := s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: deleteMetadataRequests(ids),
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("delete developer metadata: %w", err)
+	}
+
+	return nil
 }
 
-// AddExpense adds an expense to the given worksheet
+// AddExpense adds an expense to the column pair of its category in the given worksheet
 func (s *SheetsService) AddExpense(ctx context.Context, worksheet string, expense *Expense) error {
-	nextRow, err := s.findNextEmptyRow(ctx, worksheet)
+	return s.AddExpenses(ctx, worksheet, []*Expense{expense})
+}
+
+// AddExpenses adds expenses to the column pairs of their categories
+// Rows are claimed before anything is written, so concurrent writers never overwrite each other
+// Expenses whose update was already recorded in the worksheet are skipped, so SQS redeliveries are harmless
+func (s *SheetsService) AddExpenses(ctx context.Context, worksheet string, expenses []*Expense) error {
+	return s.addExpenses(ctx, worksheet, expenses, nil)
+}
+
+// AddLinkedExpense adds an expense whose record links it to a bot message from the start
+// Returns ErrAlreadyLinked if an expense in the worksheet is linked to the message already,
+// so a suggestion confirmed twice is only added once
+func (s *SheetsService) AddLinkedExpense(ctx context.Context, worksheet string, expense *Expense, chatID int64, messageID int) error {
+	return s.addExpenses(ctx, worksheet, []*Expense{expense}, &messageLink{chatID: chatID, messageID: messageID, once: true})
+}
+
+// A bot message the records of new rows are linked to
+type messageLink struct {
+	chatID    int64
+	messageID int
+	once      bool // Nothing is added if an expense is already linked to the message
+}
+
+// Adds expenses to free rows, linking their records to the message if one is given
+// Linked expenses replace rows of the same update, so they are never skipped as already recorded
+func (s *SheetsService) addExpenses(ctx context.Context, worksheet string, expenses []*Expense, link *messageLink) error {
+	sheetID, err := s.getSheetID(ctx, worksheet)
 	if err != nil {
-		return fmt.Errorf("find next empty row: %w", err)
+		return fmt.Errorf("get sheet id: %w", err)
 	}
 
-	// Update cells: description in column A, amount in column B
-	valueRange := &sheets.ValueRange{
-		Values: [][]any{
-			{expense.Desc, expense.Amount},
-		},
+	for attempt := 1; attempt <= maxClaimAttempts; attempt++ {
+		table, err := s.readExpenseTable(ctx, worksheet, sheetID)
+		if err != nil {
+			return err
+		}
+
+		if link == nil {
+			expenses = s.skipRecordedExpenses(worksheet, table, expenses)
+		} else if link.once && table.linked(link) {
+			return ErrAlreadyLinked
+		}
+		if len(expenses) == 0 {
+			return nil
+		}
+
+		rows, stale := table.allocate(expenses, time.Now())
+		claims, err := s.claimRows(ctx, sheetID, rows, expenses, stale, link)
+		if err != nil {
+			return fmt.Errorf("claim rows: %w", err)
+		}
+
+		won, err := s.awaitClaims(ctx, sheetID, claims)
+		if err != nil {
+			s.releaseClaims(ctx, claims)
+			return err
+		}
+		if won {
+			// Claims stay if the write fails: they expire, and a redelivery sees the rows are still empty
+			return s.writeExpenseRows(ctx, worksheet, rows, expenses)
+		}
+
+		s.releaseClaims(ctx, claims)
+		s.logger.Info("expense rows taken by another writer, retrying",
+			slog.String("worksheet", worksheet),
+			slog.Any("rows", rows),
+			slog.Int("attempt", attempt))
+
+		if err := s.waitBeforeClaim(ctx); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("no free rows after %d attempts", maxClaimAttempts)
+}
+
+// AddIncome writes income to the first empty row of the income section above "Total Net income"
+// Returns ErrNoIncomeSection if the worksheet has no income section, and ErrIncomeRowsFull if it has no empty row left
+// Income whose update was already recorded in the worksheet is skipped, so SQS redeliveries are harmless
+func (s *SheetsService) AddIncome(ctx context.Context, worksheet string, income *Income) error {
+	sheetID, err := s.getSheetID(ctx, worksheet)
+	if err != nil {
+		return fmt.Errorf("get sheet id: %w", err)
 	}
 
-	rangeStr := fmt.Sprintf("%s!A%d:B%d", worksheet, nextRow, nextRow)
-	_, err = s.service.Spreadsheets.Values.Update(s.spreadsheetID, rangeStr, valueRange).
-		ValueInputOption("RAW").
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
+		Ranges(fmt.Sprintf("%s!A:A", worksheet), fmt.Sprintf("%s!B:B", worksheet)).
 		Context(ctx).
 		Do()
+	if err != nil {
+		return fmt.Errorf("get column values: %w", err)
+	}
+	if len(resp.ValueRanges) < 2 {
+		return fmt.Errorf("expected 2 value ranges, got %d", len(resp.ValueRanges))
+	}
+
+	labels := flattenColumn(resp.ValueRanges[0].Values)
+	amounts := flattenColumn(resp.ValueRanges[1].Values)
+
+	if _, _, ok := incomeSection(labels); !ok {
+		return ErrNoIncomeSection
+	}
+
+	matches, err := s.searchMetadata(ctx, incomeMetadataKey, sheetID)
+	if err != nil {
+		return err
+	}
+
+	// Records on empty rows are left over from writes that failed, the row is free to reuse
+	recordsByRow := make(map[int][]int64)
+	for _, match := range matches {
+		row, record, ok := parseIncomeMetadata(match.DeveloperMetadata, sheetID)
+		if !ok {
+			continue
+		}
+		if row <= len(labels) && labels[row-1] != "" {
+			if income.UpdateID != 0 && record.UpdateID == income.UpdateID {
+				s.logger.Info("skipping already recorded income",
+					slog.String("worksheet", worksheet),
+					slog.Int64("update_id", income.UpdateID))
+				return nil
+			}
+			continue
+		}
+		recordsByRow[row] = append(recordsByRow[row], match.DeveloperMetadata.MetadataId)
+	}
+
+	row, ok := freeIncomeRow(labels, amounts)
+	if !ok {
+		return ErrIncomeRowsFull
+	}
+
+	// Messages are processed one at a time, so the row only needs to be tagged, not claimed
+	record, err := json.Marshal(incomeRecord{
+		UserID:   income.UserID,
+		AddedAt:  time.Now().UnixNano(),
+		UpdateID: income.UpdateID,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal income record: %w", err)
+	}
+
+	requests := append(deleteMetadataRequests(recordsByRow[row]), &sheets.Request{
+		CreateDeveloperMetadata: &sheets.CreateDeveloperMetadataRequest{
+			DeveloperMetadata: &sheets.DeveloperMetadata{
+				MetadataKey:   incomeMetadataKey,
+				MetadataValue: string(record),
+				Visibility:    "DOCUMENT",
+				Location: &sheets.DeveloperMetadataLocation{
+					DimensionRange: rowRange(sheetID, row),
+				},
+			},
+		},
+	})
+	_, err = s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: requests,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("create developer metadata: %w", err)
+	}
+
+	_, err = s.service.Spreadsheets.Values.Update(s.spreadsheetID, fmt.Sprintf("%s!A%d:B%d", worksheet, row, row), &sheets.ValueRange{
+		Values: [][]any{{income.Desc, income.Amount.sheetValue()}},
+	}).ValueInputOption("RAW").Context(ctx).Do()
 	if err != nil {
 		return fmt.Errorf("update cells: %w", err)
 	}
@@ -90,34 +544,862 @@ func (s *SheetsService) AddExpense(ctx context.Context, worksheet string, expens
 	return nil
 }
 
-// GetMonthlyTotal calculates the total expenses for the current month
-func (s *SheetsService) GetMonthlyTotal(ctx context.Context, worksheet string) (float64, error) {
-	// Get columns for fundamentals and fun expenses
-	colRanges := []string{
+// Writes description and amount into the category's column pair, and the date, original amount and receipt link into their own columns
+func (s *SheetsService) writeExpenseRows(ctx context.Context, worksheet string, rows []int, expenses []*Expense) error {
+	var data []*sheets.ValueRange
+	for i, expense := range expenses {
+		descCol, amountCol := categoryColumns(expense.Category)
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!%s%d:%s%d", worksheet, descCol, rows[i], amountCol, rows[i]),
+			Values: [][]any{{expense.Desc, expense.Amount.sheetValue()}},
+		})
+		if dateCol := s.dateColumn(expense.Category); dateCol != "" && !expense.Date.IsZero() {
+			data = append(data, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!%s%d", worksheet, dateCol, rows[i]),
+				Values: [][]any{{expense.Date.Format(time.DateOnly)}},
+			})
+		}
+		if origCol := s.originalColumn(expense.Category); origCol != "" && expense.Original.Currency != "" {
+			data = append(data, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!%s%d", worksheet, origCol, rows[i]),
+				Values: [][]any{{originalCellValue(expense.Original)}},
+			})
+		}
+		if receiptCol := s.receiptColumn(expense.Category); receiptCol != "" && expense.Receipt != "" {
+			data = append(data, &sheets.ValueRange{
+				Range:  fmt.Sprintf("%s!%s%d", worksheet, receiptCol, rows[i]),
+				Values: [][]any{{expense.Receipt}},
+			})
+		}
+	}
+
+	_, err := s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data:             data,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("update cells: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteLastExpense clears the most recent expense the user added to the given worksheet
+// Returns ErrNothingToUndo if there is no such expense
+func (s *SheetsService) DeleteLastExpense(ctx context.Context, worksheet string, userID int64) (*Expense, error) {
+	sheetID, err := s.getSheetID(ctx, worksheet)
+	if err != nil {
+		return nil, fmt.Errorf("get sheet id: %w", err)
+	}
+
+	matches, err := s.searchExpenseMetadata(ctx, sheetID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, record, ok := findLatestExpense(matches, sheetID, userID)
+	if !ok {
+		return nil, ErrNothingToUndo
+	}
+
+	return s.clearExpense(ctx, worksheet, claimedRow{
+		metadataID: metadata.MetadataId,
+		sheetID:    sheetID,
+		row:        int(metadata.Location.DimensionRange.StartIndex) + 1,
+		record:     record,
+	})
+}
+
+// Clears an expense row, including its date, original amount and receipt link, and removes its record
+// Returns the expense the row held
+func (s *SheetsService) clearExpense(ctx context.Context, worksheet string, claim claimedRow) (*Expense, error) {
+	descCol, amountCol := categoryColumns(claim.record.Category)
+	rangeStr := fmt.Sprintf("%s!%s%d:%s%d", worksheet, descCol, claim.row, amountCol, claim.row)
+
+	values, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("get expense row: %w", err)
+	}
+
+	clearRanges := []string{rangeStr}
+	if dateCol := s.dateColumn(claim.record.Category); dateCol != "" {
+		clearRanges = append(clearRanges, fmt.Sprintf("%s!%s%d", worksheet, dateCol, claim.row))
+	}
+	if origCol := s.originalColumn(claim.record.Category); origCol != "" {
+		clearRanges = append(clearRanges, fmt.Sprintf("%s!%s%d", worksheet, origCol, claim.row))
+	}
+	if receiptCol := s.receiptColumn(claim.record.Category); receiptCol != "" {
+		clearRanges = append(clearRanges, fmt.Sprintf("%s!%s%d", worksheet, receiptCol, claim.row))
+	}
+
+	_, err = s.service.Spreadsheets.Values.BatchClear(s.spreadsheetID, &sheets.BatchClearValuesRequest{
+		Ranges: clearRanges,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("clear cells: %w", err)
+	}
+
+	_, err = s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: deleteMetadataRequests([]int64{claim.metadataID}),
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("delete developer metadata: %w", err)
+	}
+
+	var rowValues []any
+	if len(values.Values) > 0 {
+		rowValues = values.Values[0]
+	}
+
+	return parseExpenseRow(rowValues, claim.record.Category, s.locale), nil
+}
+
+// LinkMessage links the expenses of a Telegram update in the given worksheet to the bot message that confirmed them,
+// so replies to that message can change them with UpdateExpense
+func (s *SheetsService) LinkMessage(ctx context.Context, worksheet string, updateID, chatID int64, messageID int) error {
+	if updateID == 0 {
+		return nil
+	}
+
+	sheetID, err := s.getSheetID(ctx, worksheet)
+	if err != nil {
+		return fmt.Errorf("get sheet id: %w", err)
+	}
+
+	matches, err := s.searchExpenseMetadata(ctx, sheetID)
+	if err != nil {
+		return err
+	}
+
+	var requests []*sheets.Request
+	for _, match := range matches {
+		claim, ok := parseExpenseMetadata(match.DeveloperMetadata)
+		if !ok || claim.record.UpdateID != updateID {
+			continue
+		}
+
+		claim.record.ChatID = chatID
+		claim.record.MessageID = messageID
+		record, err := json.Marshal(claim.record)
+		if err != nil {
+			return fmt.Errorf("marshal expense record: %w", err)
+		}
+
+		requests = append(requests, &sheets.Request{
+			UpdateDeveloperMetadata: &sheets.UpdateDeveloperMetadataRequest{
+				DataFilters: []*sheets.DataFilter{{
+					DeveloperMetadataLookup: &sheets.DeveloperMetadataLookup{MetadataId: claim.metadataID},
+				}},
+				DeveloperMetadata: &sheets.DeveloperMetadata{MetadataValue: string(record)},
+				Fields:            "metadataValue",
+			},
+		})
+	}
+
+	if len(requests) == 0 {
+		return nil
+	}
+
+	_, err = s.service.Spreadsheets.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: requests,
+	}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("update developer metadata: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateExpense overwrites the description and amount of an expense linked to a bot message
+// If the message confirmed several expenses, the one with the description of the correction is changed
+// An empty description keeps the current one
+// Returns the expense as it was and the title of its worksheet
+func (s *SheetsService) UpdateExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, expense *Expense) (*Expense, string, error) {
+	linked, err := s.findLinkedExpenses(ctx, chatID, messageID, sentAt, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	current := linkedExpenseValues(linked)
+	i, ok := chooseLinkedExpense(current, expense.Desc)
+	if !ok {
+		// A message with expenses in several months may have the one to change outside the current month
+		linked, err = s.findLinkedExpenses(ctx, chatID, messageID, sentAt, true)
+		if err != nil {
+			return nil, "", err
+		}
+		current = linkedExpenseValues(linked)
+		if i, ok = chooseLinkedExpense(current, expense.Desc); !ok {
+			return nil, "", ErrAmbiguousExpense
+		}
+	}
+
+	desc := expense.Desc
+	if desc == "" {
+		desc = current[i].Desc
+	}
+
+	data := []*sheets.ValueRange{{
+		Range:  linked[i].cells,
+		Values: [][]any{{desc, expense.Amount.sheetValue()}},
+	}}
+	// The original amount of the old value must not outlive the correction
+	if origCol := s.originalColumn(linked[i].claim.record.Category); origCol != "" {
+		var original any = ""
+		if expense.Original.Currency != "" {
+			original = originalCellValue(expense.Original)
+		}
+		data = append(data, &sheets.ValueRange{
+			Range:  fmt.Sprintf("%s!%s%d", linked[i].worksheet, origCol, linked[i].claim.row),
+			Values: [][]any{{original}},
+		})
+	}
+
+	_, err = s.service.Spreadsheets.Values.BatchUpdate(s.spreadsheetID, &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data:             data,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, "", fmt.Errorf("update cells: %w", err)
+	}
+
+	return current[i], linked[i].worksheet, nil
+}
+
+// DeleteExpense clears the expense linked to a bot message
+// Returns the removed expense and the title of its worksheet
+func (s *SheetsService) DeleteExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time) (*Expense, string, error) {
+	linked, err := s.findLinkedExpenses(ctx, chatID, messageID, sentAt, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(linked) > 1 {
+		return nil, "", ErrAmbiguousExpense
+	}
+
+	expense, err := s.clearExpense(ctx, linked[0].worksheet, linked[0].claim)
+	if err != nil {
+		return nil, "", err
+	}
+	return expense, linked[0].worksheet, nil
+}
+
+// MoveExpense moves the expense linked to a bot message to the column pair of another category
+// The moved row stays linked to the message, and moving it again to the same category does nothing
+// Returns the expense in its new category and the title of its worksheet
+func (s *SheetsService) MoveExpense(ctx context.Context, chatID int64, messageID int, sentAt time.Time, category Category) (*Expense, string, error) {
+	linked, err := s.findLinkedExpenses(ctx, chatID, messageID, sentAt, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var from, to []linkedExpense
+	for _, l := range linked {
+		if l.claim.record.Category == category {
+			to = append(to, l)
+		} else {
+			from = append(from, l)
+		}
+	}
+	if len(from) > 1 || len(to) > 1 {
+		return nil, "", ErrAmbiguousExpense
+	}
+	if len(from) == 0 {
+		// Already moved by an earlier delivery of the same action
+		return to[0].expense, to[0].worksheet, nil
+	}
+
+	source := from[0]
+	moved := &Expense{
+		Desc:     source.expense.Desc,
+		Amount:   source.expense.Amount,
+		Category: category,
+		UserID:   source.claim.record.UserID,
+		UpdateID: source.claim.record.UpdateID,
+	}
+
+	// A move interrupted after writing the new row only has the old row left to clear
+	if len(to) == 0 {
+		moved.Date, err = s.readExpenseDate(ctx, source.worksheet, source.claim)
+		if err != nil {
+			return nil, "", err
+		}
+		moved.Original, err = s.readExpenseOriginal(ctx, source.worksheet, source.claim)
+		if err != nil {
+			return nil, "", err
+		}
+		moved.Receipt, err = s.readExpenseCell(ctx, source.worksheet, s.receiptColumn(source.claim.record.Category), source.claim.row)
+		if err != nil {
+			return nil, "", fmt.Errorf("get expense receipt: %w", err)
+		}
+
+		link := &messageLink{chatID: chatID, messageID: messageID}
+		if err := s.addExpenses(ctx, source.worksheet, []*Expense{moved}, link); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if _, err := s.clearExpense(ctx, source.worksheet, source.claim); err != nil {
+		return nil, "", err
+	}
+
+	return moved, source.worksheet, nil
+}
+
+// Reads the date written next to an expense, zero if there is no date column or no date
+func (s *SheetsService) readExpenseDate(ctx context.Context, worksheet string, claim claimedRow) (time.Time, error) {
+	value, err := s.readExpenseCell(ctx, worksheet, s.dateColumn(claim.record.Category), claim.row)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get expense date: %w", err)
+	}
+
+	date, err := time.ParseInLocation(time.DateOnly, value, s.location)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	return date, nil
+}
+
+// Reads the original amount written next to an expense, zero if there is no original column or no amount
+func (s *SheetsService) readExpenseOriginal(ctx context.Context, worksheet string, claim claimedRow) (Money, error) {
+	value, err := s.readExpenseCell(ctx, worksheet, s.originalColumn(claim.record.Category), claim.row)
+	if err != nil {
+		return Money{}, fmt.Errorf("get expense original amount: %w", err)
+	}
+
+	original, _ := parseOriginalCell(value)
+	return original, nil
+}
+
+// Reads a single cell of an expense row, empty if the column is not configured
+func (s *SheetsService) readExpenseCell(ctx context.Context, worksheet, column string, row int) (string, error) {
+	if column == "" {
+		return "", nil
+	}
+
+	values, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, fmt.Sprintf("%s!%s%d", worksheet, column, row)).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return "", err
+	}
+	if len(values.Values) == 0 || len(values.Values[0]) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("%v", values.Values[0][0]), nil
+}
+
+// An expense row linked to a bot message
+type linkedExpense struct {
+	claim     claimedRow
+	worksheet string
+	cells     string // Description and amount range
+	expense   *Expense
+}
+
+// Finds the expense rows linked to a bot message sent at sentAt and reads them
+// Expenses are mostly in the month the message was sent, so only that month is searched,
+// unless nothing in it is linked to the message or everywhere is set
+// Returns ErrExpenseNotFound if there are none
+func (s *SheetsService) findLinkedExpenses(ctx context.Context, chatID int64, messageID int, sentAt time.Time, everywhere bool) ([]linkedExpense, error) {
+	props, err := s.listWorksheets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims []claimedRow
+	current := findWorksheet(props, worksheetTitle(sentAt, s.titleFormat, s.location))
+	if current != nil && !everywhere {
+		matches, err := s.searchExpenseMetadata(ctx, current.SheetId)
+		if err != nil {
+			return nil, err
+		}
+		claims = linkedClaims(matches, chatID, messageID)
+	}
+	if len(claims) == 0 {
+		matches, err := s.searchAllExpenseMetadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		claims = linkedClaims(matches, chatID, messageID)
+	}
+	if len(claims) == 0 {
+		return nil, ErrExpenseNotFound
+	}
+
+	titles := make(map[int64]string, len(props))
+	for _, p := range props {
+		titles[p.SheetId] = p.Title
+	}
+
+	linked := make([]linkedExpense, len(claims))
+	ranges := make([]string, len(claims))
+	for i, claim := range claims {
+		descCol, amountCol := categoryColumns(claim.record.Category)
+		worksheet := titles[claim.sheetID]
+		ranges[i] = fmt.Sprintf("%s!%s%d:%s%d", worksheet, descCol, claim.row, amountCol, claim.row)
+		linked[i] = linkedExpense{claim: claim, worksheet: worksheet, cells: ranges[i]}
+	}
+
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
+		Ranges(ranges...).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("get expense rows: %w", err)
+	}
+	if len(resp.ValueRanges) != len(linked) {
+		return nil, fmt.Errorf("expected %d value ranges, got %d", len(linked), len(resp.ValueRanges))
+	}
+
+	for i := range linked {
+		var row []any
+		if values := resp.ValueRanges[i].Values; len(values) > 0 {
+			row = values[0]
+		}
+		linked[i].expense = parseExpenseRow(row, linked[i].claim.record.Category, s.locale)
+	}
+
+	return linked, nil
+}
+
+// Returns the records of the rows linked to a bot message
+func linkedClaims(matches []*sheets.MatchedDeveloperMetadata, chatID int64, messageID int) []claimedRow {
+	var claims []claimedRow
+	for _, match := range matches {
+		claim, ok := parseExpenseMetadata(match.DeveloperMetadata)
+		if ok && claim.record.ChatID == chatID && claim.record.MessageID == messageID {
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+// Returns the expenses read from linked rows
+func linkedExpenseValues(linked []linkedExpense) []*Expense {
+	expenses := make([]*Expense, len(linked))
+	for i, l := range linked {
+		expenses[i] = l.expense
+	}
+	return expenses
+}
+
+func (s *SheetsService) searchExpenseMetadata(ctx context.Context, sheetID int64) ([]*sheets.MatchedDeveloperMetadata, error) {
+	return s.searchMetadata(ctx, expenseMetadataKey, sheetID)
+}
+
+// Searches the expense records of every worksheet, which gets slower as months are added
+func (s *SheetsService) searchAllExpenseMetadata(ctx context.Context) ([]*sheets.MatchedDeveloperMetadata, error) {
+	return s.searchDeveloperMetadata(ctx, &sheets.DeveloperMetadataLookup{MetadataKey: expenseMetadataKey})
+}
+
+// Searches the records with the given key on the rows of a worksheet
+// The Sheets API does the filtering, so the records of other months are never sent
+func (s *SheetsService) searchMetadata(ctx context.Context, key string, sheetID int64) ([]*sheets.MatchedDeveloperMetadata, error) {
+	return s.searchDeveloperMetadata(ctx, &sheets.DeveloperMetadataLookup{
+		MetadataKey:              key,
+		LocationType:             "ROW",
+		LocationMatchingStrategy: "INTERSECTING_LOCATION",
+		MetadataLocation: &sheets.DeveloperMetadataLocation{
+			SheetId: sheetID,
+			// The first sheet has ID 0, which would otherwise be omitted
+			ForceSendFields: []string{"SheetId"},
+		},
+	})
+}
+
+func (s *SheetsService) searchDeveloperMetadata(ctx context.Context, lookup *sheets.DeveloperMetadataLookup) ([]*sheets.MatchedDeveloperMetadata, error) {
+	resp, err := s.service.Spreadsheets.DeveloperMetadata.Search(s.spreadsheetID, &sheets.SearchDeveloperMetadataRequest{
+		DataFilters: []*sheets.DataFilter{{DeveloperMetadataLookup: lookup}},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("search developer metadata: %w", err)
+	}
+
+	return resp.MatchedDeveloperMetadata, nil
+}
+
+// Returns the properties of all worksheets in tab order
+func (s *SheetsService) listWorksheets(ctx context.Context) ([]*sheets.SheetProperties, error) {
+	spreadsheet, err := s.service.Spreadsheets.Get(s.spreadsheetID).
+		Fields("sheets.properties").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("get spreadsheet: %w", err)
+	}
+
+	props := make([]*sheets.SheetProperties, 0, len(spreadsheet.Sheets))
+	for _, sheet := range spreadsheet.Sheets {
+		props = append(props, sheet.Properties)
+	}
+
+	return props, nil
+}
+
+func (s *SheetsService) getSheetID(ctx context.Context, worksheet string) (int64, error) {
+	props, err := s.listWorksheets(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range props {
+		if p.Title == worksheet {
+			return p.SheetId, nil
+		}
+	}
+
+	return 0, &WorksheetNotFoundError{Title: worksheet}
+}
+
+// Formats the expected worksheet title for the month of date in the given timezone
+func worksheetTitle(date time.Time, format string, location *time.Location) string {
+	return date.In(location).Format(format)
+}
+
+// Returns the first day of the month before date in the given timezone
+func previousMonth(date time.Time, location *time.Location) time.Time {
+	date = date.In(location)
+	return time.Date(date.Year(), date.Month()-1, 1, 0, 0, 0, 0, location)
+}
+
+// Finds the worksheet matching title, ignoring case and surrounding whitespace
+func findWorksheet(props []*sheets.SheetProperties, title string) *sheets.SheetProperties {
+	for _, p := range props {
+		if strings.EqualFold(strings.TrimSpace(p.Title), title) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Picks the worksheet to copy for a new month and the tab index to insert the copy at
+// The copy goes in front of the previous month so the newest month stays first
+// Returns a nil source if there is neither a template nor a previous month
+func chooseWorksheetSource(props []*sheets.SheetProperties, template, previousTitle string) (*sheets.SheetProperties, int64, bool, error) {
+	previous := findWorksheet(props, previousTitle)
+
+	var insertIndex int64
+	if previous != nil {
+		insertIndex = previous.Index
+	}
+
+	if template != "" {
+		source := findWorksheet(props, template)
+		if source == nil {
+			return nil, 0, false, fmt.Errorf("template worksheet %q not found", template)
+		}
+		return source, insertIndex, false, nil
+	}
+
+	return previous, insertIndex, previous != nil, nil
+}
+
+// Returns a single-row dimension range for a 1-indexed row
+func rowRange(sheetID int64, row int) *sheets.DimensionRange {
+	return &sheets.DimensionRange{
+		SheetId:    sheetID,
+		Dimension:  "ROWS",
+		StartIndex: int64(row - 1),
+		EndIndex:   int64(row),
+		// The first sheet has ID 0, which would otherwise be omitted
+		ForceSendFields: []string{"SheetId", "StartIndex"},
+	}
+}
+
+// Finds the most recently added expense row of the user in the given sheet
+func findLatestExpense(matches []*sheets.MatchedDeveloperMetadata, sheetID, userID int64) (*sheets.DeveloperMetadata, expenseRecord, bool) {
+	var latest *sheets.DeveloperMetadata
+	var latestRecord expenseRecord
+
+	for _, match := range matches {
+		metadata := match.DeveloperMetadata
+		claim, ok := parseExpenseMetadata(metadata)
+		if !ok || claim.sheetID != sheetID || claim.record.UserID != userID {
+			continue
+		}
+		record := claim.record
+
+		if latest == nil || record.AddedAt > latestRecord.AddedAt {
+			latest = metadata
+			latestRecord = record
+		}
+	}
+
+	return latest, latestRecord, latest != nil
+}
+
+// Decodes the expense record of a metadata entry and the row it is attached to
+func parseExpenseMetadata(metadata *sheets.DeveloperMetadata) (claimedRow, bool) {
+	if metadata == nil || metadata.MetadataKey != expenseMetadataKey {
+		return claimedRow{}, false
+	}
+	if metadata.Location == nil || metadata.Location.DimensionRange == nil {
+		return claimedRow{}, false
+	}
+
+	var record expenseRecord
+	if err := json.Unmarshal([]byte(metadata.MetadataValue), &record); err != nil {
+		return claimedRow{}, false
+	}
+
+	return claimedRow{
+		metadataID: metadata.MetadataId,
+		sheetID:    metadata.Location.DimensionRange.SheetId,
+		row:        int(metadata.Location.DimensionRange.StartIndex) + 1,
+		record:     record,
+	}, true
+}
+
+// Stored as developer metadata on income rows so redelivered updates are not written twice
+type incomeRecord struct {
+	UserID   int64 `json:"user_id"`
+	AddedAt  int64 `json:"added_at"`            // Unix nanoseconds
+	UpdateID int64 `json:"update_id,omitempty"` // Telegram update the income came from
+}
+
+// Reads an income record and the 1-indexed row it is attached to, if it belongs to the given sheet
+func parseIncomeMetadata(metadata *sheets.DeveloperMetadata, sheetID int64) (int, incomeRecord, bool) {
+	if metadata == nil || metadata.MetadataKey != incomeMetadataKey {
+		return 0, incomeRecord{}, false
+	}
+	if metadata.Location == nil || metadata.Location.DimensionRange == nil || metadata.Location.DimensionRange.SheetId != sheetID {
+		return 0, incomeRecord{}, false
+	}
+
+	var record incomeRecord
+	if err := json.Unmarshal([]byte(metadata.MetadataValue), &record); err != nil {
+		return 0, incomeRecord{}, false
+	}
+
+	return int(metadata.Location.DimensionRange.StartIndex) + 1, record, true
+}
+
+// Picks the expense a correction refers to: the only one, or the first with the same description
+func chooseLinkedExpense(expenses []*Expense, desc string) (int, bool) {
+	if len(expenses) == 1 {
+		return 0, true
+	}
+	for i, expense := range expenses {
+		if strings.EqualFold(expense.Desc, desc) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Converts a description/amount row read from the sheet back into an Expense
+func parseExpenseRow(row []any, category Category, locale AmountLocale) *Expense {
+	expense := &Expense{Category: category}
+	if len(row) > 0 {
+		expense.Desc = strings.TrimSpace(fmt.Sprintf("%v", row[0]))
+	}
+	if len(row) > 1 {
+		if amount, ok := parseSheetAmount(row[1], locale); ok {
+			expense.Amount = amount
+		}
+	}
+	return expense
+}
+
+// GetMonthlyTotals calculates the Fundamentals and Fun expenses for the current month
+func (s *SheetsService) GetMonthlyTotals(ctx context.Context, worksheet string) (MonthlyTotals, error) {
+	values, err := s.readExpenseColumns(ctx, worksheet)
+	if err != nil {
+		return MonthlyTotals{}, err
+	}
+
+	totals, invalid := calculateMonthlyTotals(values[0].Values, values[1].Values, values[2].Values, values[3].Values, s.locale)
+	s.warnInvalidAmounts(worksheet, invalid)
+
+	return totals, nil
+}
+
+// GetMonthlyExpenses returns the expense rows of a worksheet, Fundamentals first
+// Rows without a description or a valid amount are left out, like in the totals
+func (s *SheetsService) GetMonthlyExpenses(ctx context.Context, worksheet string) ([]*Expense, error) {
+	values, err := s.readExpenseColumns(ctx, worksheet)
+	if err != nil {
+		return nil, err
+	}
+	expenses, invalid := parseMonthlyExpenses(values[0].Values, values[1].Values, values[2].Values, values[3].Values, s.locale)
+	s.warnInvalidAmounts(worksheet, invalid)
+
+	return expenses, nil
+}
+
+// Reads the columns listed by expenseColumnRanges
+// Amounts are read unformatted, so currency and thousands formats don't get in the way of parsing
+func (s *SheetsService) readExpenseColumns(ctx context.Context, worksheet string) ([]*sheets.ValueRange, error) {
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
+		Ranges(expenseColumnRanges(worksheet)...).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("batch get values: %w", err)
+	}
+
+	if len(resp.ValueRanges) < 4 {
+		return nil, fmt.Errorf("expected 4 value ranges, got %d", len(resp.ValueRanges))
+	}
+
+	return resp.ValueRanges, nil
+}
+
+// GetMonthlyHistory returns the totals of the month of date and the months before it, newest first
+// Earlier months without a worksheet are marked as not found, a missing first month is an error
+func (s *SheetsService) GetMonthlyHistory(ctx context.Context, date time.Time, months int) ([]MonthTotals, error) {
+	props, err := s.listWorksheets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]MonthTotals, months)
+	var colRanges []string
+	for i := range history {
+		history[i].Title = worksheetTitle(date, s.titleFormat, s.location)
+		if sheet := findWorksheet(props, history[i].Title); sheet != nil {
+			history[i].Title = sheet.Title
+			history[i].Found = true
+			colRanges = append(colRanges, expenseColumnRanges(sheet.Title)...)
+		}
+		date = previousMonth(date, s.location)
+	}
+
+	if months == 0 {
+		return history, nil
+	}
+	if !history[0].Found {
+		return nil, &WorksheetNotFoundError{Title: history[0].Title}
+	}
+
+	// All months are read in one request
+	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
+		Ranges(colRanges...).
+		ValueRenderOption("UNFORMATTED_VALUE").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("batch get values: %w", err)
+	}
+
+	if len(resp.ValueRanges) < len(colRanges) {
+		return nil, fmt.Errorf("expected %d value ranges, got %d", len(colRanges), len(resp.ValueRanges))
+	}
+
+	values := resp.ValueRanges
+	for i := range history {
+		if !history[i].Found {
+			continue
+		}
+		var invalid []invalidAmount
+		history[i].Totals, invalid = calculateMonthlyTotals(values[0].Values, values[1].Values, values[2].Values, values[3].Values, s.locale)
+		s.warnInvalidAmounts(history[i].Title, invalid)
+		values = values[4:]
+	}
+
+	return history, nil
+}
+
+// Logs the amount cells left out of a worksheet's totals, so a wrong total can be traced to its cells
+func (s *SheetsService) warnInvalidAmounts(worksheet string, invalid []invalidAmount) {
+	for _, amount := range invalid {
+		s.logger.Warn("skipping amount that is not a number",
+			slog.String("worksheet", worksheet),
+			slog.String("cell", amount.cell),
+			slog.Int("row", amount.row),
+			slog.String("value", amount.value))
+	}
+}
+
+// Returns the Fundamentals and Fun description and amount columns of a worksheet
+func expenseColumnRanges(worksheet string) []string {
+	return []string{
 		fmt.Sprintf("%s!A:A", worksheet), // Fundamentals descriptions
 		fmt.Sprintf("%s!B:B", worksheet), // Fundamentals amounts
 		fmt.Sprintf("%s!C:C", worksheet), // Fun descriptions
 		fmt.Sprintf("%s!D:D", worksheet), // Fun amounts
 	}
+}
+
+// Returns the description and amount columns for a category
+// Fundamentals live in columns A/B and Fun in columns C/D
+func categoryColumns(category Category) (string, string) {
+	if category == CategoryFun {
+		return "C", "D"
+	}
+	return "A", "B"
+}
+
+// Returns the configured columns written next to expenses besides their description and amount
+func (s *SheetsService) expenseDetailColumns() []string {
+	var columns []string
+	for _, column := range []string{s.fundDateCol, s.funDateCol, s.fundOrigCol, s.funOrigCol, s.fundRcptCol, s.funRcptCol} {
+		if column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// Returns the configured date column for a category, or an empty string if dates are not written
+func (s *SheetsService) dateColumn(category Category) string {
+	if category == CategoryFun {
+		return s.funDateCol
+	}
+	return s.fundDateCol
+}
+
+// Returns the configured original amount column for a category, or an empty string if it is not written
+func (s *SheetsService) originalColumn(category Category) string {
+	if category == CategoryFun {
+		return s.funOrigCol
+	}
+	return s.fundOrigCol
+}
+
+// Returns the configured receipt link column for a category, or an empty string if links are not written
+func (s *SheetsService) receiptColumn(category Category) string {
+	if category == CategoryFun {
+		return s.funRcptCol
+	}
+	return s.fundRcptCol
+}
+
+// GetBudget returns the budget set in the worksheet, falling back to the configured defaults
+func (s *SheetsService) GetBudget(ctx context.Context, worksheet string) (Budget, error) {
+	colRanges := []string{
+		fmt.Sprintf("%s!A:A", worksheet), // Labels
+		fmt.Sprintf("%s!B:B", worksheet), // Amounts
+	}
 
 	resp, err := s.service.Spreadsheets.Values.BatchGet(s.spreadsheetID).
 		Ranges(colRanges...).
+		ValueRenderOption("UNFORMATTED_VALUE").
 		Context(ctx).
 		Do()
 	if err != nil {
-		return 0, fmt.Errorf("batch get values: %w", err)
+		return Budget{}, fmt.Errorf("batch get values: %w", err)
 	}
 
-	if len(resp.ValueRanges) < 4 {
-		return 0, fmt.Errorf("expected 4 value ranges, got %d", len(resp.ValueRanges))
+	if len(resp.ValueRanges) < 2 {
+		return Budget{}, fmt.Errorf("expected 2 value ranges, got %d", len(resp.ValueRanges))
 	}
 
-	return calculateMonthlyTotal(
-		resp.ValueRanges[0].Values,
-		resp.ValueRanges[1].Values,
-		resp.ValueRanges[2].Values,
-		resp.ValueRanges[3].Values,
-	), nil
+	labels := flattenColumn(resp.ValueRanges[0].Values)
+	amounts := columnCells(resp.ValueRanges[1].Values)
+
+	startRow, ok := findExpenseStartRow(labels)
+	if !ok {
+		return s.defaultBudget, nil
+	}
+
+	return parseBudget(labels, amounts, startRow, s.locale).Merge(s.defaultBudget), nil
 }
 
 // Converts a Sheets API column into a []string
@@ -131,6 +1413,31 @@ func flattenColumn(col [][]any) []string {
 	return result
 }
 
+// Returns the first cell of each row as read, so numbers stay apart from text
+// Text is trimmed and empty cells are nil
+func columnCells(col [][]any) []any {
+	result := make([]any, len(col))
+	for i, row := range col {
+		if len(row) == 0 {
+			continue
+		}
+		if text, ok := row[0].(string); ok {
+			if text = strings.TrimSpace(text); text != "" {
+				result[i] = text
+			}
+			continue
+		}
+		result[i] = row[0]
+	}
+	return result
+}
+
+// Reports whether a cell read unformatted holds nothing
+func isEmptyCell(value any) bool {
+	text, ok := value.(string)
+	return value == nil || ok && strings.TrimSpace(text) == ""
+}
+
 func findExpenseStartRow(colValues []string) (int, bool) {
 	for i, value := range colValues {
 		if strings.Contains(value, "Total Net income") {
@@ -141,63 +1448,103 @@ func findExpenseStartRow(colValues []string) (int, bool) {
 	return 0, false
 }
 
-func (s *SheetsService) findNextEmptyRow(ctx context.Context, worksheet string) (int, error) {
-	rangeStr := fmt.Sprintf("%s!A:A", worksheet)
-	resp, err := s.service.Spreadsheets.Values.Get(s.spreadsheetID, rangeStr).Context(ctx).Do()
-	if err != nil {
-		return 0, fmt.Errorf("get column values: %w", err)
-	}
+// Picks n empty rows below the header at startRow, filling gaps before appending to the end
+func allocateRows(colValues []string, startRow, n int) []int {
+	values := append([]string(nil), colValues...)
 
-	colValues := flattenColumn(resp.Values)
+	// The Sheets API trims trailing empty cells, so a sparse column may end above the table
+	for len(values) < startRow {
+		values = append(values, "")
+	}
 
-	startRow, ok := findExpenseStartRow(colValues)
-	if !ok {
-		return 0, fmt.Errorf("could not find expense start row")
+	rows := make([]int, 0, n)
+	for range n {
+		row := nextEmptyRow(values, startRow+1)
+		for len(values) < row {
+			values = append(values, "")
+		}
+		values[row-1] = "allocated"
+		rows = append(rows, row)
 	}
 
-	return nextEmptyRow(colValues, startRow), nil
+	return rows
 }
 
 // Finds the first empty row at or after startRow
 // Returns a 1-indexed row number for the Sheets API
 func nextEmptyRow(colValues []string, startRow int) int {
 	for i := startRow; i < len(colValues)+1; i++ {
-		if i > len(colValues) || colValues[i-1] == "" {
-			return i + 1
+		if colValues[i-1] == "" {
+			return i
 		}
 	}
 	// If all rows are filled, append to the end
 	return len(colValues) + 1
 }
 
-func calculateMonthlyTotal(fundamentalsDescRaw, fundamentalsAmountsRaw, funDescRaw, funAmountsRaw [][]any) float64 {
+// Returns the totals and the amount cells that were left out because they are not numbers
+func calculateMonthlyTotals(fundamentalsDescRaw, fundamentalsAmountsRaw, funDescRaw, funAmountsRaw [][]any, locale AmountLocale) (MonthlyTotals, []invalidAmount) {
+	expenses, invalid := parseMonthlyExpenses(fundamentalsDescRaw, fundamentalsAmountsRaw, funDescRaw, funAmountsRaw, locale)
+	totals := totalExpenses(expenses)
+
+	// Income shares the Fundamentals columns above the expense table
+	income, invalidIncome := sumIncome(flattenColumn(fundamentalsDescRaw), columnCells(fundamentalsAmountsRaw), locale)
+	totals.Income = income
+
+	return totals, append(invalidIncome, invalid...)
+}
+
+// Reads the expense rows below the header of both column pairs
+// Also returns the amount cells of described rows that are not numbers
+func parseMonthlyExpenses(fundamentalsDescRaw, fundamentalsAmountsRaw, funDescRaw, funAmountsRaw [][]any, locale AmountLocale) ([]*Expense, []invalidAmount) {
 	fundamentalsDesc := flattenColumn(fundamentalsDescRaw)
-	fundamentalsAmounts := flattenColumn(fundamentalsAmountsRaw)
+	fundamentalsAmounts := columnCells(fundamentalsAmountsRaw)
 	funDesc := flattenColumn(funDescRaw)
-	funAmounts := flattenColumn(funAmountsRaw)
+	funAmounts := columnCells(funAmountsRaw)
 
 	startRow, ok := findExpenseStartRow(fundamentalsDesc)
 	if !ok {
-		return 0
+		return nil, nil
 	}
 
-	fundamentalsTotal := sumColumnAmounts(fundamentalsAmounts, fundamentalsDesc, startRow)
-	funTotal := sumColumnAmounts(funAmounts, funDesc, startRow)
+	expenses, invalid := columnExpenses(fundamentalsAmounts, fundamentalsDesc, startRow, CategoryFundamentals, locale)
+	funExpenses, funInvalid := columnExpenses(funAmounts, funDesc, startRow, CategoryFun, locale)
 
-	return fundamentalsTotal + funTotal
+	return append(expenses, funExpenses...), append(invalid, funInvalid...)
 }
 
-func sumColumnAmounts(amounts, descriptions []string, startRow int) float64 {
-	total := 0.0
+// Sums expenses per category
+func totalExpenses(expenses []*Expense) MonthlyTotals {
+	var totals MonthlyTotals
+	for _, expense := range expenses {
+		if expense.Category == CategoryFun {
+			totals.Fun = totals.Fun.Add(expense.Amount)
+		} else {
+			totals.Fundamentals = totals.Fundamentals.Add(expense.Amount)
+		}
+	}
+	return totals
+}
+
+// Collects the rows of a column pair that have both a description and an amount
+// Amounts that are not numbers are returned separately instead of being dropped silently
+func columnExpenses(amounts []any, descriptions []string, startRow int, category Category, locale AmountLocale) ([]*Expense, []invalidAmount) {
+	_, amountCol := categoryColumns(category)
 
+	var expenses []*Expense
+	var invalid []invalidAmount
 	for i := startRow - 1; i < len(amounts); i++ {
-		if i < len(descriptions) && descriptions[i] != "" && amounts[i] != "" {
-			amountStr := strings.ReplaceAll(amounts[i], ",", ".")
-			if amount, err := strconv.ParseFloat(amountStr, 64); err == nil {
-				total += amount
-			}
+		if i >= len(descriptions) || descriptions[i] == "" || isEmptyCell(amounts[i]) {
+			continue
+		}
+
+		amount, ok := parseSheetAmount(amounts[i], locale)
+		if !ok {
+			invalid = append(invalid, invalidAmount{cell: fmt.Sprintf("%s%d", amountCol, i+1), row: i + 1, value: fmt.Sprintf("%v", amounts[i])})
+			continue
 		}
+		expenses = append(expenses, &Expense{Desc: descriptions[i], Amount: amount, Category: category})
 	}
 
-	return total
+	return expenses, invalid
 }
@@ -1,9 +1,47 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"google.golang.org/api/sheets/v4"
 )
 
+func TestCategoryColumns(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		category   Category
+		wantDesc   string
+		wantAmount string
+	}{
+		{CategoryFundamentals, "A", "B"},
+		{CategoryFun, "C", "D"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.category.String(), func(t *testing.T) {
+			t.Parallel()
+
+			desc, amount := categoryColumns(tt.category)
+			if desc != tt.wantDesc || amount != tt.wantAmount {
+				t.Errorf("categoryColumns(%v) = %q, %q, want %q, %q", tt.category, desc, amount, tt.wantDesc, tt.wantAmount)
+			}
+		})
+	}
+}
+
 func TestFlattenColumn(t *testing.T) {
 	t.Parallel()
 
@@ -132,13 +170,13 @@ func TestNextEmptyRow(t *testing.T) {
 			name:      "first row empty",
 			colValues: []string{"Total Net income", "Header", ""},
 			startRow:  3,
-			want:      4, // index 2 is empty, so row 3+1=4 in sheets API
+			want:      3, // index 2 is empty, which is row 3 in sheets API
 		},
 		{
 			name:      "gap in middle",
 			colValues: []string{"Total Net income", "Header", "Rent", "", "Coffee"},
 			startRow:  3,
-			want:      5, // index 3 is empty, so row 4+1=5
+			want:      4, // index 3 is empty, which is row 4
 		},
 		{
 			name:      "all rows filled",
@@ -166,7 +204,80 @@ func TestNextEmptyRow(t *testing.T) {
 	}
 }
 
-func TestCalculateMonthlyTotal(t *testing.T) {
+func TestAllocateRows(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		colValues []string
+		startRow  int
+		n         int
+		want      []int
+	}{
+		{
+			name:      "appends below last row",
+			colValues: []string{"Total Net income", "Header", "Rent"},
+			startRow:  2,
+			n:         2,
+			want:      []int{4, 5},
+		},
+		{
+			name:      "fills gaps first",
+			colValues: []string{"Total Net income", "Header", "Rent", "", "Coffee", ""},
+			startRow:  2,
+			n:         3,
+			want:      []int{4, 6, 7},
+		},
+		{
+			name:      "empty table",
+			colValues: []string{"Total Net income", "Header"},
+			startRow:  2,
+			n:         1,
+			want:      []int{3},
+		},
+		{
+			name:      "sparse column ending above table skips header row",
+			colValues: []string{"Fun"},
+			startRow:  4,
+			n:         2,
+			want:      []int{5, 6},
+		},
+		{
+			name:      "does not modify input",
+			colValues: []string{"Total Net income", "Header", ""},
+			startRow:  2,
+			n:         1,
+			want:      []int{3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			input := append([]string(nil), tt.colValues...)
+			got := allocateRows(input, tt.startRow, tt.n)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("allocateRows() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("allocateRows() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			for i := range input {
+				if input[i] != tt.colValues[i] {
+					t.Errorf("allocateRows() modified input: %v", input)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateMonthlyTotals(t *testing.T) {
 	t.Parallel()
 
 	t.Run("sums fundamentals and fun", func(t *testing.T) {
@@ -177,10 +288,66 @@ func TestCalculateMonthlyTotal(t *testing.T) {
 		funDesc := [][]any{{""}, {""}, {""}, {"Movies"}, {"Games"}}
 		funAmounts := [][]any{{""}, {""}, {""}, {"15.00"}, {"30.00"}}
 
-		got := calculateMonthlyTotal(fundDesc, fundAmounts, funDesc, funAmounts)
-		want := 645.0
+		got, invalid := calculateMonthlyTotals(fundDesc, fundAmounts, funDesc, funAmounts, LocaleEuropean)
+		want := MonthlyTotals{Fundamentals: Cents(60000), Fun: Cents(4500)}
+		if len(invalid) != 0 {
+			t.Errorf("calculateMonthlyTotals() invalid = %v, want none", invalid)
+		}
 		if got != want {
-			t.Errorf("calculateMonthlyTotal() = %v, want %v", got, want)
+			t.Errorf("calculateMonthlyTotals() = %+v, want %+v", got, want)
+		}
+		if got.Total() != Cents(64500) {
+			t.Errorf("calculateMonthlyTotals().Total() = %v, want 645", got.Total())
+		}
+	})
+
+	t.Run("hundreds of small amounts sum exactly", func(t *testing.T) {
+		t.Parallel()
+
+		fundDesc := [][]any{{"Total Net income"}, {"Expenses"}}
+		fundAmounts := [][]any{{""}, {""}}
+		funDesc := [][]any{{""}, {""}}
+		funAmounts := [][]any{{""}, {""}}
+		for range 1000 {
+			fundDesc = append(fundDesc, []any{"Candy"})
+			fundAmounts = append(fundAmounts, []any{0.1})
+		}
+		for range 300 {
+			funDesc = append(funDesc, []any{"Gum"})
+			funAmounts = append(funAmounts, []any{"0,07"})
+		}
+
+		got, _ := calculateMonthlyTotals(fundDesc, fundAmounts, funDesc, funAmounts, LocaleEuropean)
+		if want := (MonthlyTotals{Fundamentals: Cents(10000), Fun: Cents(2100)}); got != want {
+			t.Errorf("calculateMonthlyTotals() = %+v, want %+v", got, want)
+		}
+		if got := formatAmount(got.Total()); got != "121,00" {
+			t.Errorf("formatAmount(Total()) = %q, want 121,00", got)
+		}
+	})
+
+	t.Run("rows match the totals", func(t *testing.T) {
+		t.Parallel()
+
+		fundDesc := [][]any{{"Total Net income"}, {"Expenses"}, {"Rent"}, {""}, {"Food"}}
+		fundAmounts := [][]any{{""}, {""}, {"500,00"}, {"3"}, {"100.00"}}
+		funDesc := [][]any{{""}, {""}, {"Movies"}, {"Broken"}}
+		funAmounts := [][]any{{""}, {""}, {"15.00"}, {"n/a"}}
+
+		got, invalid := parseMonthlyExpenses(fundDesc, fundAmounts, funDesc, funAmounts, LocaleEuropean)
+		want := []*Expense{
+			{Desc: "Rent", Amount: Cents(50000)},
+			{Desc: "Food", Amount: Cents(10000)},
+			{Desc: "Movies", Amount: Cents(1500), Category: CategoryFun},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("parseMonthlyExpenses() = %v, want %v", got, want)
+		}
+		if wantInvalid := []invalidAmount{{cell: "D4", row: 4, value: "n/a"}}; !reflect.DeepEqual(invalid, wantInvalid) {
+			t.Errorf("parseMonthlyExpenses() invalid = %v, want %v", invalid, wantInvalid)
+		}
+		if totals, _ := calculateMonthlyTotals(fundDesc, fundAmounts, funDesc, funAmounts, LocaleEuropean); totals != totalExpenses(got) {
+			t.Errorf("calculateMonthlyTotals() = %+v, want %+v", totals, totalExpenses(got))
 		}
 	})
 
@@ -192,80 +359,88 @@ func TestCalculateMonthlyTotal(t *testing.T) {
 		funDesc := [][]any{{}, {}}
 		funAmounts := [][]any{{}, {}}
 
-		got := calculateMonthlyTotal(fundDesc, fundAmounts, funDesc, funAmounts)
-		if got != 0 {
-			t.Errorf("calculateMonthlyTotal() = %v, want 0", got)
+		got, _ := calculateMonthlyTotals(fundDesc, fundAmounts, funDesc, funAmounts, LocaleEuropean)
+		if got != (MonthlyTotals{}) {
+			t.Errorf("calculateMonthlyTotals() = %+v, want zero", got)
 		}
 	})
 
 	t.Run("empty columns", func(t *testing.T) {
 		t.Parallel()
 
-		got := calculateMonthlyTotal(nil, nil, nil, nil)
-		if got != 0 {
-			t.Errorf("calculateMonthlyTotal() = %v, want 0", got)
+		got, _ := calculateMonthlyTotals(nil, nil, nil, nil, LocaleEuropean)
+		if got != (MonthlyTotals{}) {
+			t.Errorf("calculateMonthlyTotals() = %+v, want zero", got)
 		}
 	})
 }
 
-func TestSumColumnAmounts(t *testing.T) {
+func TestColumnExpenses(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		name         string
-		amounts      []string
+		amounts      []any
 		descriptions []string
 		startRow     int
-		want         float64
+		want         Money
+		wantInvalid  []string
 	}{
 		{
 			name:         "basic sum",
-			amounts:      []string{"", "", "10.00", "20.50", "5.00"},
+			amounts:      []any{"", "", "10.00", "20.50", "5.00"},
 			descriptions: []string{"", "", "Rent", "Food", "Coffee"},
 			startRow:     3,
-			want:         35.50,
+			want:         Cents(3550),
 		},
 		{
 			name:         "comma decimal separator",
-			amounts:      []string{"10,50", "20,00"},
+			amounts:      []any{"10,50", "20,00"},
 			descriptions: []string{"Rent", "Food"},
 			startRow:     1,
-			want:         30.50,
+			want:         Cents(3050),
 		},
 		{
 			name:         "skips empty descriptions",
-			amounts:      []string{"10.00", "20.00", "30.00"},
+			amounts:      []any{"10.00", "20.00", "30.00"},
 			descriptions: []string{"Rent", "", "Food"},
 			startRow:     1,
-			want:         40.00,
+			want:         Cents(4000),
 		},
 		{
 			name:         "skips empty amounts",
-			amounts:      []string{"10.00", ""},
+			amounts:      []any{"10.00", ""},
 			descriptions: []string{"Rent", "Food"},
 			startRow:     1,
-			want:         10.00,
+			want:         Cents(1000),
 		},
 		{
 			name:         "empty input",
-			amounts:      []string{},
+			amounts:      []any{},
 			descriptions: []string{},
 			startRow:     1,
-			want:         0,
 		},
 		{
 			name:         "skips unparseable amounts",
-			amounts:      []string{"10.00", "abc", "20.00"},
+			amounts:      []any{"10.00", "abc", "20.00"},
 			descriptions: []string{"Rent", "Bad", "Food"},
 			startRow:     1,
-			want:         30.00,
+			want:         Cents(3000),
+			wantInvalid:  []string{"B2"},
+		},
+		{
+			name:         "formatted amounts",
+			amounts:      []any{"1 234,50", "€12,00", "1.234,50", "12,00 EUR"},
+			descriptions: []string{"Rent", "Food", "Laptop", "Books"},
+			startRow:     1,
+			want:         Cents(249300),
 		},
 		{
 			name:         "amounts shorter than descriptions",
-			amounts:      []string{"10.00"},
+			amounts:      []any{"10.00"},
 			descriptions: []string{"Rent", "Food", "Coffee"},
 			startRow:     1,
-			want:         10.00,
+			want:         Cents(1000),
 		},
 	}
 
@@ -273,10 +448,1043 @@ func TestSumColumnAmounts(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
 
-			got := sumColumnAmounts(tt.amounts, tt.descriptions, tt.startRow)
-			if got != tt.want {
-				t.Errorf("sumColumnAmounts() = %v, want %v", got, tt.want)
+			expenses, invalid := columnExpenses(tt.amounts, tt.descriptions, tt.startRow, CategoryFundamentals, LocaleEuropean)
+			if got := totalExpenses(expenses).Fundamentals; got != tt.want {
+				t.Errorf("columnExpenses() total = %v, want %v", got, tt.want)
+			}
+
+			var cells []string
+			for _, amount := range invalid {
+				cells = append(cells, amount.cell)
+			}
+			if !reflect.DeepEqual(cells, tt.wantInvalid) {
+				t.Errorf("columnExpenses() invalid cells = %v, want %v", cells, tt.wantInvalid)
 			}
 		})
 	}
 }
+
+func TestFindLatestExpense(t *testing.T) {
+	t.Parallel()
+
+	match := func(id, sheetID, row int64, value string) *sheets.MatchedDeveloperMetadata {
+		return &sheets.MatchedDeveloperMetadata{
+			DeveloperMetadata: &sheets.DeveloperMetadata{
+				MetadataId:    id,
+				MetadataKey:   expenseMetadataKey,
+				MetadataValue: value,
+				Location: &sheets.DeveloperMetadataLocation{
+					DimensionRange: &sheets.DimensionRange{SheetId: sheetID, StartIndex: row, EndIndex: row + 1},
+				},
+			},
+		}
+	}
+
+	matches := []*sheets.MatchedDeveloperMetadata{
+		match(1, 0, 10, `{"user_id":42,"category":0,"added_at":100}`),
+		match(2, 0, 8, `{"user_id":42,"category":1,"added_at":300}`),
+		match(3, 0, 12, `{"user_id":7,"category":0,"added_at":500}`),
+		match(4, 9, 5, `{"user_id":42,"category":0,"added_at":900}`),
+		match(5, 0, 6, `not json`),
+	}
+
+	tests := []struct {
+		name     string
+		sheetID  int64
+		userID   int64
+		wantID   int64
+		wantCat  Category
+		wantFind bool
+	}{
+		{
+			name:     "latest by added time, not row",
+			sheetID:  0,
+			userID:   42,
+			wantID:   2,
+			wantCat:  CategoryFun,
+			wantFind: true,
+		},
+		{
+			name:     "other user",
+			sheetID:  0,
+			userID:   7,
+			wantID:   3,
+			wantCat:  CategoryFundamentals,
+			wantFind: true,
+		},
+		{
+			name:     "filters by sheet",
+			sheetID:  9,
+			userID:   42,
+			wantID:   4,
+			wantCat:  CategoryFundamentals,
+			wantFind: true,
+		},
+		{
+			name:    "unknown user",
+			sheetID: 0,
+			userID:  99,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			metadata, record, found := findLatestExpense(matches, tt.sheetID, tt.userID)
+
+			if found != tt.wantFind {
+				t.Fatalf("findLatestExpense() found = %v, want %v", found, tt.wantFind)
+			}
+			if !found {
+				return
+			}
+			if metadata.MetadataId != tt.wantID {
+				t.Errorf("findLatestExpense() id = %d, want %d", metadata.MetadataId, tt.wantID)
+			}
+			if record.Category != tt.wantCat {
+				t.Errorf("findLatestExpense() category = %v, want %v", record.Category, tt.wantCat)
+			}
+		})
+	}
+}
+
+func TestChooseLinkedExpense(t *testing.T) {
+	t.Parallel()
+
+	receipt := []*Expense{{Desc: "Milk"}, {Desc: "Bread"}, {Desc: "Cheese"}}
+
+	tests := []struct {
+		name     string
+		expenses []*Expense
+		desc     string
+		want     int
+		wantOK   bool
+	}{
+		{
+			name:     "single expense is changed whatever the description",
+			expenses: []*Expense{{Desc: "Lunch"}},
+			desc:     "Dinner",
+			want:     0,
+			wantOK:   true,
+		},
+		{
+			name:     "description picks from several",
+			expenses: receipt,
+			desc:     "bread",
+			want:     1,
+			wantOK:   true,
+		},
+		{
+			name:     "unknown description is ambiguous",
+			expenses: receipt,
+			desc:     "Eggs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, ok := chooseLinkedExpense(tt.expenses, tt.desc)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("chooseLinkedExpense() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestUpdateLinkedExpense(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	s.fundOrigCol, s.funOrigCol = "G", "H"
+	ctx := context.Background()
+	sentAt := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	err := s.AddExpenses(ctx, "March 2026", []*Expense{
+		{Desc: "Milk", Amount: Cents(120), UpdateID: 7},
+		{Desc: "Movies", Amount: Cents(1200), Category: CategoryFun, UpdateID: 7},
+	})
+	if err != nil {
+		t.Fatalf("AddExpenses() unexpected error: %v", err)
+	}
+
+	if _, _, err := s.UpdateExpense(ctx, 1, 50, sentAt, &Expense{Desc: "Milk", Amount: Cents(140)}); !errors.Is(err, ErrExpenseNotFound) {
+		t.Fatalf("UpdateExpense() before linking error = %v, want ErrExpenseNotFound", err)
+	}
+
+	if err := s.LinkMessage(ctx, "March 2026", 7, 1, 50); err != nil {
+		t.Fatalf("LinkMessage() unexpected error: %v", err)
+	}
+
+	if _, _, err := s.UpdateExpense(ctx, 1, 50, sentAt, &Expense{Desc: "Eggs", Amount: Cents(300)}); !errors.Is(err, ErrAmbiguousExpense) {
+		t.Fatalf("UpdateExpense() with unknown description error = %v, want ErrAmbiguousExpense", err)
+	}
+
+	previous, worksheet, err := s.UpdateExpense(ctx, 1, 50, sentAt, &Expense{Desc: "movies", Amount: Cents(950), Original: Money{Cents: 1100, Currency: "USD"}})
+	if err != nil {
+		t.Fatalf("UpdateExpense() unexpected error: %v", err)
+	}
+	if worksheet != "March 2026" {
+		t.Errorf("UpdateExpense() worksheet = %q, want March 2026", worksheet)
+	}
+	if previous.Desc != "Movies" || previous.Amount != Cents(1200) || previous.Category != CategoryFun {
+		t.Errorf("UpdateExpense() previous = %+v, want Movies 12 Fun", previous)
+	}
+	if got := fake.cell("C4"); got != "movies" {
+		t.Errorf("C4 = %v, want movies", got)
+	}
+	if got := fake.cell("D4"); got != 9.5 {
+		t.Errorf("D4 = %v, want 9.5", got)
+	}
+	if got := fake.cell("B4"); got != 1.2 {
+		t.Errorf("B4 = %v, want the Milk amount to stay 1.2", got)
+	}
+	if got := fake.cell("H4"); got != "11.00 USD" {
+		t.Errorf("H4 = %v, want 11.00 USD", got)
+	}
+
+	if _, _, err := s.UpdateExpense(ctx, 1, 50, sentAt, &Expense{Desc: "movies", Amount: Cents(900)}); err != nil {
+		t.Fatalf("UpdateExpense() unexpected error: %v", err)
+	}
+	if got := fake.cell("H4"); got != "" {
+		t.Errorf("H4 = %v, want the original amount cleared", got)
+	}
+}
+
+func TestMoveAndDeleteLinkedExpense(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	s.fundDateCol, s.funDateCol = "E", "F"
+	s.fundOrigCol, s.funOrigCol = "G", "H"
+	s.fundRcptCol, s.funRcptCol = "I", "J"
+	ctx := context.Background()
+	sentAt := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	date := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	original := Money{Cents: 13800, Currency: "SEK"}
+	receipt := "https://files.example.com/receipts/2026-03/AQAD1.jpg"
+	expense := &Expense{Desc: "Lunch", Amount: Cents(1200), Original: original, Date: date, Receipt: receipt, UserID: 42, UpdateID: 7}
+	if err := s.AddExpense(ctx, "March 2026", expense); err != nil {
+		t.Fatalf("AddExpense() unexpected error: %v", err)
+	}
+	if err := s.LinkMessage(ctx, "March 2026", 7, 1, 50); err != nil {
+		t.Fatalf("LinkMessage() unexpected error: %v", err)
+	}
+
+	// Pressing the button twice, e.g. after an SQS redelivery, moves the expense once
+	for i := range 2 {
+		moved, worksheet, err := s.MoveExpense(ctx, 1, 50, sentAt, CategoryFun)
+		if err != nil {
+			t.Fatalf("MoveExpense() unexpected error: %v", err)
+		}
+		if worksheet != "March 2026" || moved.Desc != "Lunch" || moved.Amount != Cents(1200) || moved.Category != CategoryFun {
+			t.Errorf("MoveExpense() = %+v in %q, want Lunch 12 Fun in March 2026", moved, worksheet)
+		}
+		if i == 0 && (moved.Original != original || moved.Receipt != receipt) {
+			t.Errorf("MoveExpense() = %+v, want original %v and receipt %q", moved, original, receipt)
+		}
+	}
+
+	for cell, want := range map[string]any{"A4": nil, "B4": nil, "E4": nil, "G4": nil, "I4": nil, "C4": "Lunch", "D4": 12.0, "F4": "2026-03-02", "H4": "138.00 SEK", "J4": receipt} {
+		if got := fake.cell(cell); got != want {
+			t.Errorf("%s = %v, want %v", cell, got, want)
+		}
+	}
+	fake.assertExpenses(t, CategoryFun, 4, 1)
+	fake.assertExpenses(t, CategoryFundamentals, 4, 0)
+
+	removed, _, err := s.DeleteExpense(ctx, 1, 50, sentAt)
+	if err != nil {
+		t.Fatalf("DeleteExpense() unexpected error: %v", err)
+	}
+	if removed.Desc != "Lunch" || removed.Category != CategoryFun {
+		t.Errorf("DeleteExpense() = %+v, want Lunch in Fun", removed)
+	}
+	for _, cell := range []string{"C4", "D4", "F4", "H4", "J4"} {
+		if got := fake.cell(cell); got != nil {
+			t.Errorf("%s = %v, want empty", cell, got)
+		}
+	}
+
+	if _, _, err := s.DeleteExpense(ctx, 1, 50, sentAt); !errors.Is(err, ErrExpenseNotFound) {
+		t.Errorf("second DeleteExpense() error = %v, want ErrExpenseNotFound", err)
+	}
+}
+
+func TestGetMonthlyHistory(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	history, err := s.GetMonthlyHistory(ctx, time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC), 3)
+	if err != nil {
+		t.Fatalf("GetMonthlyHistory() unexpected error: %v", err)
+	}
+	want := []MonthTotals{
+		{Title: "March 2026", Totals: MonthlyTotals{Fundamentals: Cents(90000), Fun: Cents(4000)}, Found: true},
+		{Title: "February 2026"},
+		{Title: "January 2026"},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("GetMonthlyHistory() = %+v, want %+v", history, want)
+	}
+
+	_, err = s.GetMonthlyHistory(ctx, time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), 3)
+	var notFound *WorksheetNotFoundError
+	if !errors.As(err, &notFound) || notFound.Title != "April 2026" {
+		t.Errorf("GetMonthlyHistory() error = %v, want April 2026 not found", err)
+	}
+}
+
+func TestAddIncome(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	fake.cells = map[string]any{
+		"A1": "Income",
+		"A2": "Salary",
+		"B2": 3000.0,
+		"A4": "Budget",
+		"B4": 2500.0,
+		"A5": "Total Net income",
+		"A6": "Fundamentals",
+		"C6": "Fun",
+		"A7": "Rent",
+		"B7": 900.0,
+		"C7": "Concert",
+		"D7": 40.0,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	// A redelivered update is written once
+	for range 2 {
+		if err := s.AddIncome(ctx, "March 2026", &Income{Desc: "Refund", Amount: Cents(1250), UpdateID: 7}); err != nil {
+			t.Fatalf("AddIncome() unexpected error: %v", err)
+		}
+	}
+	if got := fake.cell("A3"); got != "Refund" {
+		t.Errorf("A3 = %v, want Refund", got)
+	}
+	if got := fake.cell("B3"); got != 12.5 {
+		t.Errorf("B3 = %v, want 12.5", got)
+	}
+
+	if err := s.AddIncome(ctx, "March 2026", &Income{Desc: "Gift", Amount: Cents(5000), UpdateID: 8}); !errors.Is(err, ErrIncomeRowsFull) {
+		t.Errorf("AddIncome() error = %v, want ErrIncomeRowsFull", err)
+	}
+
+	totals, err := s.GetMonthlyTotals(ctx, "March 2026")
+	if err != nil {
+		t.Fatalf("GetMonthlyTotals() unexpected error: %v", err)
+	}
+	want := MonthlyTotals{Fundamentals: Cents(90000), Fun: Cents(4000), Income: Cents(301250)}
+	if totals != want {
+		t.Errorf("GetMonthlyTotals() = %+v, want %+v", totals, want)
+	}
+	if net := totals.Net(); net != Cents(207250) {
+		t.Errorf("Net() = %v, want 2072.5", net)
+	}
+
+	// Income records don't count as expenses
+	matches, err := s.searchExpenseMetadata(ctx, 0)
+	if err != nil {
+		t.Fatalf("searchExpenseMetadata() unexpected error: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("found %d expense records, want 0", len(matches))
+	}
+}
+
+func TestAddExpensesSumsExactly(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	expenses := make([]*Expense, 300)
+	for i := range expenses {
+		expenses[i] = &Expense{Desc: fmt.Sprintf("Candy %d", i), Amount: Cents(10), UpdateID: 7}
+	}
+	if err := s.AddExpenses(ctx, "March 2026", expenses); err != nil {
+		t.Fatalf("AddExpenses() unexpected error: %v", err)
+	}
+	if got := fake.cell("B4"); got != 0.1 {
+		t.Errorf("B4 = %v, want 0.1", got)
+	}
+
+	totals, err := s.GetMonthlyTotals(ctx, "March 2026")
+	if err != nil {
+		t.Fatalf("GetMonthlyTotals() unexpected error: %v", err)
+	}
+	if want := (MonthlyTotals{Fundamentals: Cents(93000), Fun: Cents(4000)}); totals != want {
+		t.Errorf("GetMonthlyTotals() = %+v, want %+v", totals, want)
+	}
+}
+
+func TestGetMonthlyTotalsWarnsAboutInvalidAmounts(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	fake.cells["A4"] = "Groceries"
+	fake.cells["B4"] = "1 234,50 €"
+	fake.cells["A5"] = "Dentist"
+	fake.cells["B5"] = "ask Anna"
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	var logs bytes.Buffer
+	s := newFakeSheetsService(t, server)
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	totals, err := s.GetMonthlyTotals(context.Background(), "March 2026")
+	if err != nil {
+		t.Fatalf("GetMonthlyTotals() unexpected error: %v", err)
+	}
+
+	if want := (MonthlyTotals{Fundamentals: Cents(213450), Fun: Cents(4000)}); totals != want {
+		t.Errorf("GetMonthlyTotals() = %+v, want %+v", totals, want)
+	}
+	for _, s := range []string{"level=WARN", "cell=B5", "row=5", `value="ask Anna"`} {
+		if !strings.Contains(logs.String(), s) {
+			t.Errorf("log should contain %q, got %q", s, logs.String())
+		}
+	}
+}
+
+func TestParseExpenseRow(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		row        []any
+		wantDesc   string
+		wantAmount Money
+	}{
+		{
+			name:       "numeric amount",
+			row:        []any{"Lunch", 12.5},
+			wantDesc:   "Lunch",
+			wantAmount: Cents(1250),
+		},
+		{
+			name:       "comma string amount",
+			row:        []any{"Lunch", "12,50"},
+			wantDesc:   "Lunch",
+			wantAmount: Cents(1250),
+		},
+		{
+			name:     "missing amount",
+			row:      []any{"Lunch"},
+			wantDesc: "Lunch",
+		},
+		{
+			name: "empty row",
+			row:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := parseExpenseRow(tt.row, CategoryFun, LocaleEuropean)
+			if got.Desc != tt.wantDesc || got.Amount != tt.wantAmount || got.Category != CategoryFun {
+				t.Errorf("parseExpenseRow() = %+v, want desc %q amount %v", got, tt.wantDesc, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestWorksheetTitle(t *testing.T) {
+	t.Parallel()
+
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		date     time.Time
+		format   string
+		location *time.Location
+		want     string
+	}{
+		{
+			name:     "default format",
+			date:     time.Date(2026, time.February, 14, 12, 0, 0, 0, time.UTC),
+			format:   "January 2006",
+			location: time.UTC,
+			want:     "February 2026",
+		},
+		{
+			name:     "timezone moves date into next month",
+			date:     time.Date(2026, time.February, 28, 23, 30, 0, 0, time.UTC),
+			format:   "January 2006",
+			location: helsinki,
+			want:     "March 2026",
+		},
+		{
+			name:     "custom format",
+			date:     time.Date(2026, time.February, 14, 12, 0, 0, 0, time.UTC),
+			format:   "2006-01",
+			location: time.UTC,
+			want:     "2026-02",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := worksheetTitle(tt.date, tt.format, tt.location); got != tt.want {
+				t.Errorf("worksheetTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindWorksheet(t *testing.T) {
+	t.Parallel()
+
+	props := []*sheets.SheetProperties{
+		{Title: "March 2026"},
+		{Title: "february 2026 "},
+		{Title: "January 2026"},
+	}
+
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{
+			name:  "exact match regardless of tab order",
+			title: "January 2026",
+			want:  "January 2026",
+		},
+		{
+			name:  "case and whitespace insensitive",
+			title: "February 2026",
+			want:  "february 2026 ",
+		},
+		{
+			name:  "missing month",
+			title: "April 2026",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := findWorksheet(props, tt.title)
+			var gotTitle string
+			if got != nil {
+				gotTitle = got.Title
+			}
+			if gotTitle != tt.want {
+				t.Errorf("findWorksheet(%q) = %q, want %q", tt.title, gotTitle, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviousMonth(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		date time.Time
+		want time.Time
+	}{
+		{
+			name: "end of month does not overflow",
+			date: time.Date(2026, time.March, 31, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "january wraps to previous year",
+			date: time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC),
+			want: time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := previousMonth(tt.date, time.UTC); !got.Equal(tt.want) {
+				t.Errorf("previousMonth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseWorksheetSource(t *testing.T) {
+	t.Parallel()
+
+	props := []*sheets.SheetProperties{
+		{Title: "February 2026", SheetId: 11, Index: 0},
+		{Title: "January 2026", SheetId: 10, Index: 1},
+		{Title: "Template", SheetId: 1, Index: 2},
+	}
+
+	tests := []struct {
+		name          string
+		template      string
+		previousTitle string
+		wantSourceID  int64
+		wantNilSource bool
+		wantIndex     int64
+		wantClear     bool
+		wantErr       bool
+	}{
+		{
+			name:          "copies previous month and clears it",
+			previousTitle: "February 2026",
+			wantSourceID:  11,
+			wantIndex:     0,
+			wantClear:     true,
+		},
+		{
+			name:          "template is placed before previous month",
+			template:      "Template",
+			previousTitle: "January 2026",
+			wantSourceID:  1,
+			wantIndex:     1,
+		},
+		{
+			name:          "template without previous month goes first",
+			template:      "Template",
+			previousTitle: "June 2025",
+			wantSourceID:  1,
+			wantIndex:     0,
+		},
+		{
+			name:          "no template and no previous month",
+			previousTitle: "June 2025",
+			wantNilSource: true,
+		},
+		{
+			name:          "missing template",
+			template:      "Blank",
+			previousTitle: "February 2026",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			source, index, fromPrevious, err := chooseWorksheetSource(props, tt.template, tt.previousTitle)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("chooseWorksheetSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (source == nil) != tt.wantNilSource {
+				t.Fatalf("chooseWorksheetSource() source = %v, want nil %v", source, tt.wantNilSource)
+			}
+			if source != nil && source.SheetId != tt.wantSourceID {
+				t.Errorf("chooseWorksheetSource() source id = %d, want %d", source.SheetId, tt.wantSourceID)
+			}
+			if index != tt.wantIndex {
+				t.Errorf("chooseWorksheetSource() index = %d, want %d", index, tt.wantIndex)
+			}
+			if fromPrevious != tt.wantClear {
+				t.Errorf("chooseWorksheetSource() fromPrevious = %v, want %v", fromPrevious, tt.wantClear)
+			}
+		})
+	}
+}
+
+func TestEnsureWorksheetCopiesPreviousMonth(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	s.fundDateCol, s.funDateCol = "E", "F"
+	s.fundOrigCol, s.funOrigCol = "G", "H"
+	s.fundRcptCol, s.funRcptCol = "I", "J"
+	ctx := context.Background()
+
+	expense := &Expense{Desc: "Lunch", Amount: Cents(1200), Original: Money{Cents: 13800, Currency: "SEK"}, Receipt: "https://example.com/receipt.jpg", Date: time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC), UserID: 42, UpdateID: 7}
+	if err := s.AddExpense(ctx, "March 2026", expense); err != nil {
+		t.Fatalf("AddExpense() unexpected error: %v", err)
+	}
+
+	april := time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC)
+	worksheet, err := s.EnsureWorksheet(ctx, april)
+	if err != nil {
+		t.Fatalf("EnsureWorksheet() unexpected error: %v", err)
+	}
+	if worksheet != "April 2026" {
+		t.Errorf("EnsureWorksheet() = %q, want April 2026", worksheet)
+	}
+	if got, want := fake.worksheetTitles(), []string{"April 2026", "March 2026"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("worksheets = %v, want %v", got, want)
+	}
+
+	for cell, want := range map[string]any{"A1": "Total Net income", "A2": "Fundamentals", "C2": "Fun", "A3": nil, "B3": nil, "C3": nil, "D3": nil, "A4": nil, "B4": nil, "E4": nil, "G4": nil, "I4": nil} {
+		if got := fake.worksheetCell("April 2026", cell); got != want {
+			t.Errorf("April 2026 %s = %v, want %v", cell, got, want)
+		}
+	}
+	if got := fake.cell("A4"); got != "Lunch" {
+		t.Errorf("March 2026 A4 = %v, want Lunch to stay", got)
+	}
+	if got := fake.cell("G4"); got == nil {
+		t.Error("March 2026 G4 is empty, want the original amount to stay")
+	}
+	if got := fake.cell("I4"); got == nil {
+		t.Error("March 2026 I4 is empty, want the receipt link to stay")
+	}
+
+	// The copied record must not make /undo or redeliveries see last month's expense in the new month
+	if _, err := s.DeleteLastExpense(ctx, "April 2026", 42); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("DeleteLastExpense() error = %v, want ErrNothingToUndo", err)
+	}
+
+	// An existing worksheet is returned as is
+	if worksheet, err := s.EnsureWorksheet(ctx, april); err != nil || worksheet != "April 2026" {
+		t.Errorf("second EnsureWorksheet() = %q, %v, want April 2026", worksheet, err)
+	}
+}
+
+func TestEnsureWorksheetClearsCopiedIncome(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	fake.cells = map[string]any{
+		"A1": "Income",
+		"A2": "Salary",
+		"B2": 3000.0,
+		"A4": "Budget",
+		"B4": 2500.0,
+		"A5": "Total Net income",
+		"A6": "Fundamentals",
+		"C6": "Fun",
+		"A7": "Rent",
+		"B7": 900.0,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	if err := s.AddIncome(ctx, "March 2026", &Income{Desc: "Refund", Amount: Cents(1250), UpdateID: 7}); err != nil {
+		t.Fatalf("AddIncome() unexpected error: %v", err)
+	}
+
+	if _, err := s.EnsureWorksheet(ctx, time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("EnsureWorksheet() unexpected error: %v", err)
+	}
+
+	for cell, want := range map[string]any{"A1": "Income", "A2": nil, "B2": nil, "A3": nil, "B3": nil, "A4": "Budget", "B4": 2500.0, "A5": "Total Net income", "A7": nil} {
+		if got := fake.worksheetCell("April 2026", cell); got != want {
+			t.Errorf("April 2026 %s = %v, want %v", cell, got, want)
+		}
+	}
+	if got := fake.cell("A3"); got != "Refund" {
+		t.Errorf("March 2026 A3 = %v, want Refund to stay", got)
+	}
+
+	sheetID, err := s.getSheetID(ctx, "April 2026")
+	if err != nil {
+		t.Fatalf("getSheetID() unexpected error: %v", err)
+	}
+	matches, err := s.searchMetadata(ctx, incomeMetadataKey, sheetID)
+	if err != nil {
+		t.Fatalf("searchMetadata() unexpected error: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("found %d income records in April 2026, want 0", len(matches))
+	}
+
+	// The new month only counts its own income
+	if err := s.AddIncome(ctx, "April 2026", &Income{Desc: "Gift", Amount: Cents(5000), UpdateID: 9}); err != nil {
+		t.Fatalf("AddIncome() unexpected error: %v", err)
+	}
+	totals, err := s.GetMonthlyTotals(ctx, "April 2026")
+	if err != nil {
+		t.Fatalf("GetMonthlyTotals() unexpected error: %v", err)
+	}
+	if want := (MonthlyTotals{Income: Cents(5000)}); totals != want {
+		t.Errorf("GetMonthlyTotals() = %+v, want %+v", totals, want)
+	}
+}
+
+func TestWorksheetWithoutIncomeSection(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	fake.cells = map[string]any{
+		"A1": "Household 2026",
+		"A2": "Savings goal",
+		"B2": 5000.0,
+		"A3": "Total Net income",
+		"A4": "Fundamentals",
+		"C4": "Fun",
+		"A5": "Rent",
+		"B5": 900.0,
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	if err := s.AddIncome(ctx, "March 2026", &Income{Desc: "Salary", Amount: Cents(300000), UpdateID: 7}); !errors.Is(err, ErrNoIncomeSection) {
+		t.Errorf("AddIncome() error = %v, want ErrNoIncomeSection", err)
+	}
+
+	totals, err := s.GetMonthlyTotals(ctx, "March 2026")
+	if err != nil {
+		t.Fatalf("GetMonthlyTotals() unexpected error: %v", err)
+	}
+	if want := (MonthlyTotals{Fundamentals: Cents(90000)}); totals != want {
+		t.Errorf("GetMonthlyTotals() = %+v, want %+v", totals, want)
+	}
+
+	// The rows above the table are titles and notes, not income to clear
+	if _, err := s.EnsureWorksheet(ctx, time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("EnsureWorksheet() unexpected error: %v", err)
+	}
+	for cell, want := range map[string]any{"A1": "Household 2026", "A2": "Savings goal", "B2": 5000.0, "A5": nil} {
+		if got := fake.worksheetCell("April 2026", cell); got != want {
+			t.Errorf("April 2026 %s = %v, want %v", cell, got, want)
+		}
+	}
+}
+
+func TestEnsureWorksheetDeletesCopyThatCouldNotBeCleared(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	fake.intercept = func(r *http.Request) error {
+		if strings.Contains(strings.ToLower(r.URL.Path), "clear") {
+			return fmt.Errorf("backend unavailable")
+		}
+		return nil
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	april := time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := s.EnsureWorksheet(ctx, april); err == nil {
+		t.Fatal("EnsureWorksheet() expected error when the copy can't be cleared")
+	}
+	if got, want := fake.worksheetTitles(), []string{"March 2026"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("worksheets = %v, want %v", got, want)
+	}
+
+	// The retry copies the previous month again instead of finding a half-made worksheet
+	fake.intercept = nil
+	if _, err := s.EnsureWorksheet(ctx, april); err != nil {
+		t.Fatalf("EnsureWorksheet() retry unexpected error: %v", err)
+	}
+	if got := fake.worksheetCell("April 2026", "A3"); got != nil {
+		t.Errorf("April 2026 A3 = %v, want empty", got)
+	}
+}
+
+func TestEnsureWorksheetCreatedConcurrently(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	// Another invocation creates the worksheet just before this one tries to
+	fake.intercept = func(r *http.Request) error {
+		if !strings.HasSuffix(r.URL.Path, ":batchUpdate") {
+			return nil
+		}
+		fake.intercept = nil
+		fake.batchUpdate(&sheets.BatchUpdateSpreadsheetRequest{Requests: []*sheets.Request{{
+			DuplicateSheet: &sheets.DuplicateSheetRequest{NewSheetName: "April 2026"},
+		}}})
+		return fmt.Errorf("a sheet with the name \"April 2026\" already exists")
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+
+	worksheet, err := s.EnsureWorksheet(context.Background(), time.Date(2026, time.April, 1, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("EnsureWorksheet() unexpected error: %v", err)
+	}
+	if worksheet != "April 2026" {
+		t.Errorf("EnsureWorksheet() = %q, want April 2026", worksheet)
+	}
+	if got, want := fake.worksheetTitles(), []string{"April 2026", "March 2026"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("worksheets = %v, want %v", got, want)
+	}
+}
+
+func TestExpenseLookupsSearchTheirWorksheet(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+	month := worksheetTitle(now, "January 2006", time.UTC)
+	fake := newFakeSheets(month)
+
+	// Counts the searches that would send the records of every month
+	var mu sync.Mutex
+	unfiltered := 0
+	fake.intercept = func(r *http.Request) error {
+		if !strings.HasSuffix(r.URL.Path, "/developerMetadata:search") {
+			return nil
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !strings.Contains(string(body), `"metadataLocation"`) {
+			mu.Lock()
+			unfiltered++
+			mu.Unlock()
+		}
+		return nil
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+
+	if err := s.AddExpense(ctx, month, &Expense{Desc: "Lunch", Amount: Cents(1200), UserID: 42, UpdateID: 7}); err != nil {
+		t.Fatalf("AddExpense() unexpected error: %v", err)
+	}
+	if err := s.LinkMessage(ctx, month, 7, 1, 50); err != nil {
+		t.Fatalf("LinkMessage() unexpected error: %v", err)
+	}
+	if _, _, err := s.UpdateExpense(ctx, 1, 50, now, &Expense{Amount: Cents(1400)}); err != nil {
+		t.Fatalf("UpdateExpense() unexpected error: %v", err)
+	}
+	if _, _, err := s.MoveExpense(ctx, 1, 50, now, CategoryFun); err != nil {
+		t.Fatalf("MoveExpense() unexpected error: %v", err)
+	}
+	if _, err := s.DeleteLastExpense(ctx, month, 42); err != nil {
+		t.Fatalf("DeleteLastExpense() unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	if unfiltered != 0 {
+		t.Errorf("%d searches were not limited to the worksheet", unfiltered)
+	}
+	mu.Unlock()
+
+	// A message sent in another month is looked up in the worksheet of that month
+	nextMonth := now.AddDate(0, 1, 0)
+	next, err := s.EnsureWorksheet(ctx, nextMonth)
+	if err != nil {
+		t.Fatalf("EnsureWorksheet() unexpected error: %v", err)
+	}
+	err = s.AddExpenses(ctx, next, []*Expense{
+		{Desc: "Flights", Amount: Cents(20000), UserID: 42, UpdateID: 8},
+		{Desc: "Hotel", Amount: Cents(30000), UserID: 42, UpdateID: 9},
+	})
+	if err != nil {
+		t.Fatalf("AddExpenses() unexpected error: %v", err)
+	}
+	if err := s.LinkMessage(ctx, next, 8, 1, 60); err != nil {
+		t.Fatalf("LinkMessage() unexpected error: %v", err)
+	}
+	if err := s.LinkMessage(ctx, next, 9, 1, 61); err != nil {
+		t.Fatalf("LinkMessage() unexpected error: %v", err)
+	}
+	removed, worksheet, err := s.DeleteExpense(ctx, 1, 60, nextMonth)
+	if err != nil {
+		t.Fatalf("DeleteExpense() unexpected error: %v", err)
+	}
+	if removed.Desc != "Flights" || worksheet != next {
+		t.Errorf("DeleteExpense() = %+v in %q, want Flights in %q", removed, worksheet, next)
+	}
+
+	mu.Lock()
+	if unfiltered != 0 {
+		t.Errorf("%d searches were not limited to the worksheet of the message", unfiltered)
+	}
+	mu.Unlock()
+
+	// An expense outside the month of its message is still found, by searching every worksheet
+	removed, worksheet, err = s.DeleteExpense(ctx, 1, 61, now)
+	if err != nil {
+		t.Fatalf("DeleteExpense() unexpected error: %v", err)
+	}
+	if removed.Desc != "Hotel" || worksheet != next {
+		t.Errorf("DeleteExpense() = %+v in %q, want Hotel in %q", removed, worksheet, next)
+	}
+}
+
+func TestAddLinkedExpenseOnce(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeSheets("March 2026")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	s := newFakeSheetsService(t, server)
+	ctx := context.Background()
+	sentAt := time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+	// Two taps on the same suggestion arrive as different updates
+	if err := s.AddLinkedExpense(ctx, "March 2026", &Expense{Desc: "K-Market", Amount: Cents(490), UserID: 42, UpdateID: 7}, 1, 31); err != nil {
+		t.Fatalf("AddLinkedExpense() unexpected error: %v", err)
+	}
+	err := s.AddLinkedExpense(ctx, "March 2026", &Expense{Desc: "K-Market", Amount: Cents(490), UserID: 42, UpdateID: 8}, 1, 31)
+	if !errors.Is(err, ErrAlreadyLinked) {
+		t.Errorf("second AddLinkedExpense() error = %v, want ErrAlreadyLinked", err)
+	}
+	fake.assertExpenses(t, CategoryFundamentals, 4, 1)
+
+	// Another suggestion in the chat is added
+	if err := s.AddLinkedExpense(ctx, "March 2026", &Expense{Desc: "Kiosk", Amount: Cents(240), UserID: 42, UpdateID: 9}, 1, 32); err != nil {
+		t.Fatalf("AddLinkedExpense() unexpected error: %v", err)
+	}
+	fake.assertExpenses(t, CategoryFundamentals, 4, 2)
+
+	// The record links the expense without a separate LinkMessage
+	removed, _, err := s.DeleteExpense(ctx, 1, 31, sentAt)
+	if err != nil {
+		t.Fatalf("DeleteExpense() unexpected error: %v", err)
+	}
+	if removed.Desc != "K-Market" {
+		t.Errorf("DeleteExpense() = %+v, want K-Market", removed)
+	}
+}
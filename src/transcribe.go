@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Transcriber turns speech into text
+type Transcriber interface {
+	// Transcribe returns the text spoken in an audio file, such as a Telegram voice message in OGG/Opus
+	Transcribe(ctx context.Context, audio []byte, fileName string) (string, error)
+}
+
+// WhisperServer transcribes with a whisper.cpp server, which can run on the local network
+type WhisperServer struct {
+	url      string // Base URL of the server, e.g. "http://localhost:8080"
+	language string // Spoken language such as "en", detected by the server if empty
+	client   *http.Client
+}
+
+func NewWhisperServer(url, language string) *WhisperServer {
+	return &WhisperServer{url: url, language: language, client: &http.Client{Timeout: 20 * time.Second}}
+}
+
+func (w *WhisperServer) Transcribe(ctx context.Context, audio []byte, fileName string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		return "", fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("write form file: %w", err)
+	}
+	fields := map[string]string{"response_format": "json"}
+	if w.language != "" {
+		fields["language"] = w.language
+	}
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return "", fmt.Errorf("write form field: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("close form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(w.url, "/")+"/inference", &body)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send audio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("transcribe: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("parse transcription: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+var (
+	// Commas between spoken words, but not decimal commas such as "12,50"
+	spokenCommaPattern = regexp.MustCompile(`,(\s|$)`)
+	// A spoken currency name after the amount, which the parser does not know
+	spokenEuroPattern = regexp.MustCompile(`(?i)\s+euros?$`)
+)
+
+// Cleans up the punctuation a transcription adds to speech, e.g. "Lunch, 12.50 euros." becomes "Lunch 12.50"
+func cleanTranscript(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.TrimRight(text, ".!?")
+	text = spokenCommaPattern.ReplaceAllString(text, "$1")
+	text = spokenEuroPattern.ReplaceAllString(text, "")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Returns the file name to send a voice message to a transcriber under, keeping the extension of the Telegram file
+func voiceFileName(serverPath string) string {
+	if ext := path.Ext(serverPath); ext != "" {
+		return "voice" + ext
+	}
+	return "voice.ogg"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWhisperServerTranscribe(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/inference" {
+			http.NotFound(w, r)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		audio, _ := io.ReadAll(file)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text":" %s %s %s %s\n"}`,
+			header.Filename, audio, r.FormValue("language"), r.FormValue("response_format"))
+	}))
+	defer server.Close()
+
+	whisper := NewWhisperServer(server.URL+"/", "fi")
+	got, err := whisper.Transcribe(context.Background(), []byte("opus"), "voice.oga")
+	if err != nil {
+		t.Fatalf("Transcribe() unexpected error: %v", err)
+	}
+	if want := "voice.oga opus fi json"; got != want {
+		t.Errorf("Transcribe() = %q, want %q", got, want)
+	}
+
+	missing := NewWhisperServer(server.URL+"/missing", "")
+	if _, err := missing.Transcribe(context.Background(), nil, "voice.ogg"); err == nil {
+		t.Error("Transcribe() expected error for an unexpected status")
+	}
+}
+
+func TestCleanTranscript(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Lunch 12.50", "Lunch 12.50"},
+		{" Lunch, 12.50.", "Lunch 12.50"},
+		{"Lunch 12,50 euros.", "Lunch 12,50"},
+		{"Fun, cinema, 15 Euro!", "Fun cinema 15"},
+		{"Taxi 20 USD.", "Taxi 20 USD"},
+		{"Groceries  for   the week 43.20?", "Groceries for the week 43.20"},
+		{"...", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel()
+
+			if got := cleanTranscript(tt.input); got != tt.want {
+				t.Errorf("cleanTranscript(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoiceFileName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		serverPath string
+		want       string
+	}{
+		{"voice/file_7.oga", "voice.oga"},
+		{"voice/file_8", "voice.ogg"},
+		{"", "voice.ogg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverPath, func(t *testing.T) {
+			t.Parallel()
+
+			if got := voiceFileName(tt.serverPath); got != tt.want {
+				t.Errorf("voiceFileName(%q) = %q, want %q", tt.serverPath, got, tt.want)
+			}
+		})
+	}
+}